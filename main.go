@@ -1,11 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	routes "github.com/ericklikan/dollar-coffee-backend/pkg/api"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/health"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/background"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/config"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/mailer"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/metrics"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -15,63 +25,144 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
-	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
 )
 
 func main() {
-	// Setup environment
-	err := godotenv.Load() //Load .env file
+	// Setup environment, fails on missing secrets
+	cfg, err := config.Load()
 	if err != nil {
-		log.Warn(err)
+		log.Fatal(err)
+	}
+
+	if cfg.Server.Debug {
+		log.Info("running in debug mode")
+		log.SetLevel(log.DebugLevel)
 	}
 
-	db, err := setupDatabase()
+	db, err := setupDatabase(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
-
-	port := os.Getenv("PORT")
+	db.LogMode(cfg.Server.Debug)
 
-	if port == "" {
-		log.Info("running in debug mode: port 5000")
-		log.SetLevel(log.DebugLevel)
-		db.LogMode(true)
-		port = "5000"
+	redis, err := setupCache(cfg.Redis)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	redis := setupCache()
+	// receipts and other work that outlives requests
+	workers := background.NewWorkers()
 
 	router := mux.NewRouter()
-	err = routes.NewServer(router, db, redis)
+	err = routes.NewServer(cfg, router, db, redis, setupMailer(cfg.Mail), workers)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// CORS
-	headersOk := handlers.AllowedHeaders([]string{"X-Requested-With"})
-	originsOk := handlers.AllowedOrigins([]string{"localhost:3000"})
-	methodsOk := handlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "OPTIONS"})
+	// CORS wraps the router so preflight requests are answered for every route
+	handler := routes.CORS(cfg.CORS)(router)
+
+	// Behind a load balancer client addresses come from X-Forwarded-For,
+	// only trust it when a proxy sets it or clients can spoof their address
+	if cfg.Server.TrustProxyHeaders {
+		handler = handlers.ProxyHeaders(handler)
+	}
+
+	// Timeouts keep slow or idle clients from holding connections forever
+	server := &http.Server{
+		Addr:              cfg.Server.Addr(),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	servers := []*http.Server{server}
+
+	// metrics have their own listener so they aren't exposed with the API
+	if cfg.Server.MetricsPort != "" {
+		servers = append(servers, &http.Server{
+			Addr:              cfg.Server.MetricsAddr(),
+			Handler:           health.MetricsHandler(),
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		})
+	}
+
+	serverErr := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			log.Infof("Started server on %s", server.Addr)
+			serverErr <- server.ListenAndServe()
+		}(server)
+	}
+
+	// Deploys send SIGTERM, requests in flight (e.g. purchases that are being
+	// committed) get the shutdown timeout to finish before connections are closed
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	var listenErr error
+	select {
+	case listenErr = <-serverErr:
+		log.WithError(listenErr).Error("Server stopped")
+	case sig := <-stop:
+		log.Infof("Received %s, shutting down", sig)
+	}
+	signal.Stop(stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	shutdown(ctx, servers, workers, redis, db)
+	cancel()
 
-	log.Infof("Started server on port %s", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), handlers.CORS(originsOk, headersOk, methodsOk)(router)))
+	if listenErr != nil {
+		os.Exit(1)
+	}
 }
 
-func setupDatabase() (*gorm.DB, error) {
-	dbUri := os.Getenv("DATABASE_URL")
+// shutdown stops accepting requests and waits for the ones in flight, then
+// for background work, and only then closes the clients they use
+func shutdown(ctx context.Context, servers []*http.Server, workers *background.Workers, redis *redis.Client, db *gorm.DB) {
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.WithError(err).Warn("Error draining connections")
+		}
+	}
+	if err := workers.Shutdown(ctx); err != nil {
+		log.WithError(err).Warn("Error waiting for background work")
+	}
+	if redis != nil {
+		if err := redis.Close(); err != nil {
+			log.WithError(err).Warn("Error closing redis")
+		}
+	}
+	if err := db.Close(); err != nil {
+		log.WithError(err).Warn("Error closing database")
+	}
+	log.Info("Server stopped")
+}
 
-	log.Infof("Connecting to postgresdb: %s", dbUri)
-	dbConn, err := gorm.Open("postgres", dbUri)
+func setupDatabase(cfg *config.Config) (*gorm.DB, error) {
+	log.Info("Connecting to postgresdb")
+	dbConn, err := gorm.Open("postgres", cfg.Database.URL)
 	if err != nil {
 		return nil, err
 	}
+	metrics.InstrumentDB(dbConn)
 
 	// Database migrations
 	// TODO: Add migration history
 	dbConn = dbConn.AutoMigrate(
+		models.APIKey{},
+		models.AuditEvent{},
 		models.Coffee{},
+		models.Payment{},
 		models.PurchaseItem{},
+		models.RecoveryCode{},
 		models.Transaction{},
 		models.User{},
 	)
@@ -85,39 +176,87 @@ func setupDatabase() (*gorm.DB, error) {
 		log.WithError(dbConn.Error).Warn()
 	}
 
+	dbConn = dbConn.Model(&models.Payment{}).AddForeignKey("transaction_id", "transactions(id)", "RESTRICT", "RESTRICT")
+	if dbConn.Error != nil {
+		// Will error if foreign key is already set up
+		log.WithError(dbConn.Error).Warn()
+	}
+
 	dbConn = dbConn.Model(&models.Transaction{}).AddForeignKey("user_id", "users(id)", "RESTRICT", "RESTRICT")
 	if dbConn.Error != nil {
 		// Will error if foreign key is already set up
 		log.WithError(dbConn.Error).Warn()
 	}
 
+	dbConn = dbConn.Model(&models.RecoveryCode{}).AddForeignKey("user_id", "users(id)", "CASCADE", "RESTRICT")
+	if dbConn.Error != nil {
+		// Will error if foreign key is already set up
+		log.WithError(dbConn.Error).Warn()
+	}
+
+	// Audit events are append only, updates and deletes are ignored
+	for _, rule := range []string{"UPDATE", "DELETE"} {
+		err = dbConn.Exec(fmt.Sprintf("CREATE OR REPLACE RULE audit_events_no_%s AS ON %s TO audit_events DO INSTEAD NOTHING", strings.ToLower(rule), rule)).Error
+		if err != nil {
+			log.WithError(err).Warn()
+		}
+	}
+
 	// Create default admin if table is empty
 	var user models.User
 	err = dbConn.Find(&user).Error
 	if err == gorm.ErrRecordNotFound {
+		// the password has to be changed on first login, it's never logged
+		if cfg.Auth.AdminPassword == "" {
+			return nil, errors.New("ADMIN_PASSWORD is required to create the first admin")
+		}
 
-		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("OneTwo34%"), bcrypt.DefaultCost)
-		user.Password = string(hashedPassword)
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(cfg.Auth.AdminPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
 		newId, _ := uuid.NewRandom()
 
 		dbConn.Create(&models.User{
-			ID:        newId,
-			FirstName: "Admin",
-			LastName:  "User",
-			Email:     "admin@test.com",
-			Password:  string(hashedPassword),
-			Role:      "admin",
+			ID:                 newId,
+			FirstName:          "Admin",
+			LastName:           "User",
+			Email:              "admin@test.com",
+			Password:           string(hashedPassword),
+			Role:               models.RoleAdmin,
+			MustChangePassword: true,
 		})
 	}
 
 	return dbConn, nil
 }
 
-func setupCache() *redis.Client {
-	redisEnv := os.Getenv("REDIS_URL")
-	redisOptions, err := redis.ParseURL(redisEnv)
+// setupCache returns nil if no redis server is configured, the cache and rate
+// limits are then kept in memory
+func setupCache(cfg config.Redis) (*redis.Client, error) {
+	if cfg.URL == "" {
+		log.Info("REDIS_URL isn't set, caching and counting rate limits in memory")
+		return nil, nil
+	}
+
+	redisOptions, err := redis.ParseURL(cfg.URL)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("invalid REDIS_URL: %v", err)
 	}
-	return redis.NewClient(redisOptions)
+	return redis.NewClient(redisOptions), nil
+}
+
+// setupMailer returns nil if no SMTP server is configured, disabling emails
+func setupMailer(cfg config.Mail) mailer.Mailer {
+	if cfg.SMTPHost == "" {
+		return nil
+	}
+
+	return mailer.NewSMTPMailer(
+		cfg.SMTPHost,
+		cfg.SMTPPort,
+		cfg.SMTPUsername,
+		cfg.SMTPPassword,
+		cfg.From,
+	)
 }
@@ -0,0 +1,151 @@
+// Package audit records administrative and security sensitive changes as
+// append only audit events.
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// Actor is who made a change, both are nil for anonymous requests
+type Actor struct {
+	UserId   *uuid.UUID
+	APIKeyId *uint
+}
+
+// ActorFunc finds the actor of an authenticated request
+type ActorFunc func(r *http.Request) Actor
+
+// Event is a change to record, Before is nil for creations and After is nil
+// for deletions
+type Event struct {
+	Action     string
+	EntityType string
+	EntityId   string
+	Before     interface{}
+	After      interface{}
+}
+
+type Recorder struct {
+	auditRepository repository_interfaces.AuditRepository
+	actor           ActorFunc
+}
+
+func NewRecorder(auditRepository repository_interfaces.AuditRepository, actor ActorFunc) *Recorder {
+	return &Recorder{
+		auditRepository: auditRepository,
+		actor:           actor,
+	}
+}
+
+// Record writes event in tx, so it's only kept if the change it describes is
+// committed
+func (rec *Recorder) Record(tx *gorm.DB, r *http.Request, event *Event) error {
+	changes, err := Diff(event.Before, event.After)
+	if err != nil {
+		return err
+	}
+	changesJson, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	actor := rec.actor(r)
+	return rec.auditRepository.CreateAuditEvent(tx, &models.AuditEvent{
+		ActorId:       actor.UserId,
+		ActorAPIKeyId: actor.APIKeyId,
+		Action:        event.Action,
+		EntityType:    event.EntityType,
+		EntityId:      event.EntityId,
+		Changes:       postgres.Jsonb{RawMessage: changesJson},
+		RequestId:     util.RequestIDFromContext(r.Context()),
+		IP:            util.ClientIP(r),
+	})
+}
+
+// Change is the value of a field before and after an event
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+const redacted = "[redacted]"
+
+// fields that are recorded as changed without their values
+var redactedFields = map[string]bool{
+	"password": true,
+	"token":    true,
+}
+
+// fields every update touches
+var ignoredFields = map[string]bool{
+	"UpdatedAt": true,
+}
+
+// Diff compares the JSON fields of before and after, either can be nil
+func Diff(before interface{}, after interface{}) (map[string]Change, error) {
+	beforeFields, err := toFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := toFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]Change{}
+	addChange := func(field string) {
+		if ignoredFields[field] {
+			return
+		}
+		beforeValue, afterValue := beforeFields[field], afterFields[field]
+		if reflect.DeepEqual(beforeValue, afterValue) {
+			return
+		}
+		if redactedFields[field] {
+			beforeValue, afterValue = redactValue(beforeValue), redactValue(afterValue)
+		}
+		changes[field] = Change{Before: beforeValue, After: afterValue}
+	}
+
+	for field := range beforeFields {
+		addChange(field)
+	}
+	for field := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			addChange(field)
+		}
+	}
+	return changes, nil
+}
+
+func redactValue(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+	return redacted
+}
+
+func toFields(value interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	before := models.User{
+		FirstName: "Test",
+		Email:     "test@test.com",
+		Password:  "old hash",
+		Role:      models.RoleUser,
+	}
+	before.UpdatedAt = time.Now()
+	after := before
+	after.Role = models.RoleAdmin
+	after.Password = "new hash"
+	after.UpdatedAt = before.UpdatedAt.Add(time.Minute)
+
+	changes, err := Diff(&before, &after)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Change{
+		"Role":     {Before: models.RoleUser, After: models.RoleAdmin},
+		"password": {Before: redacted, After: redacted},
+	}, changes)
+
+	changes, err = Diff(nil, &models.Coffee{Name: "Latte", Price: 2})
+	require.NoError(t, err)
+	assert.Equal(t, Change{Before: nil, After: "Latte"}, changes["name"])
+	assert.Equal(t, Change{Before: nil, After: 2.0}, changes["price"])
+
+	var deleted *models.Coffee
+	changes, err = Diff(&models.Coffee{Name: "Latte"}, deleted)
+	require.NoError(t, err)
+	assert.Equal(t, Change{Before: "Latte", After: nil}, changes["name"])
+}
+
+type fakeAuditRepository struct {
+	events []*models.AuditEvent
+}
+
+func (repo *fakeAuditRepository) CreateAuditEvent(tx *gorm.DB, event *models.AuditEvent) error {
+	repo.events = append(repo.events, event)
+	return nil
+}
+
+func (repo *fakeAuditRepository) GetAuditEventsPaginated(tx *gorm.DB, query *repository_interfaces.AuditPageQuery) ([]*models.AuditEvent, *repository_interfaces.PageInfo, error) {
+	return repo.events, &repository_interfaces.PageInfo{TotalCount: len(repo.events)}, nil
+}
+
+func TestRecord(t *testing.T) {
+	actorId := uuid.New()
+	repo := &fakeAuditRepository{}
+	recorder := NewRecorder(repo, func(r *http.Request) Actor {
+		return Actor{UserId: &actorId}
+	})
+
+	r := httptest.NewRequest("PATCH", "/internal/users/1/role", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set(util.RequestIDHeader, "request-1")
+
+	var recordErr error
+	util.RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recordErr = recorder.Record(nil, r, &Event{
+			Action:     models.AuditUserRole,
+			EntityType: models.AuditEntityUser,
+			EntityId:   "1",
+			Before:     &models.User{Role: models.RoleUser},
+			After:      &models.User{Role: models.RoleBarista},
+		})
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	require.NoError(t, recordErr)
+
+	require.Len(t, repo.events, 1)
+	event := repo.events[0]
+	assert.Equal(t, &actorId, event.ActorId)
+	assert.Nil(t, event.ActorAPIKeyId)
+	assert.Equal(t, models.AuditUserRole, event.Action)
+	assert.Equal(t, "1", event.EntityId)
+	assert.Equal(t, "request-1", event.RequestId)
+	assert.Equal(t, "10.0.0.1", event.IP)
+
+	var changes map[string]Change
+	require.NoError(t, json.Unmarshal(event.Changes.RawMessage, &changes))
+	assert.Equal(t, Change{Before: models.RoleUser, After: models.RoleBarista}, changes["Role"])
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// API keys look like `dck_{prefix}_{secret}`, the prefix is stored in plain
+// text so the key can be found and the whole key is stored hashed
+const apiKeyPrefix = "dck"
+
+func randomString(length int) (string, error) {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// GenerateAPIKey returns a new key and its prefix, the key is only ever
+// shown once
+func GenerateAPIKey() (key string, prefix string, err error) {
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", err
+	}
+	prefix = hex.EncodeToString(prefixBytes)
+
+	secret, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	return apiKeyPrefix + "_" + prefix + "_" + secret, prefix, nil
+}
+
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// ParseAPIKeyPrefix returns false for strings that aren't API keys
+func ParseAPIKeyPrefix(key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+func apiKeyMatches(key string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(hash)) == 1
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, err := GenerateAPIKey()
+	require.NoError(t, err)
+
+	parsedPrefix, ok := ParseAPIKeyPrefix(key)
+	require.True(t, ok)
+	assert.Equal(t, prefix, parsedPrefix)
+
+	otherKey, otherPrefix, err := GenerateAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, otherKey)
+	assert.NotEqual(t, prefix, otherPrefix)
+
+	hash := HashAPIKey(key)
+	assert.Len(t, hash, 64)
+	assert.True(t, apiKeyMatches(key, hash))
+	assert.False(t, apiKeyMatches(otherKey, hash))
+}
+
+func TestParseAPIKeyPrefix(t *testing.T) {
+	_, ok := ParseAPIKeyPrefix("")
+	assert.False(t, ok)
+	_, ok = ParseAPIKeyPrefix("dck_abc")
+	assert.False(t, ok)
+	_, ok = ParseAPIKeyPrefix("xyz_abc_secret")
+	assert.False(t, ok)
+
+	prefix, ok := ParseAPIKeyPrefix("dck_abc_sec_ret")
+	assert.True(t, ok)
+	assert.Equal(t, "abc", prefix)
+}
@@ -1,16 +1,23 @@
 package auth
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/audit"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/authtypes"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/config"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/dbtx"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/oidc"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/ratelimit"
 	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -25,29 +32,113 @@ const prefix = "/auth"
 type authSubrouter struct {
 	util.CommonSubrouter
 
-	userRepository repository_interfaces.UserRepository
+	userRepository  repository_interfaces.UserRepository
+	oidcProviders   map[string]*oidc.Provider
+	tokenSecret     []byte
+	tokenTTL        time.Duration
+	requireAdmin2FA bool
+	totpIssuer      string
+	loginLimiter    *LoginLimiter
+	auditRecorder   *audit.Recorder
 }
 
-func Setup(router *mux.Router, db *gorm.DB, userRepository repository_interfaces.UserRepository) error {
-	if db == nil || router == nil {
-		err := errors.New("db or router is nil")
+func Setup(router *mux.Router, db *gorm.DB, authMiddleware mux.MiddlewareFunc, rateLimiter *ratelimit.Limiter, spec *openapi.Spec,
+	userRepository repository_interfaces.UserRepository,
+	oidcProviders map[string]*oidc.Provider,
+	loginLimiter *LoginLimiter,
+	auditRecorder *audit.Recorder,
+	cfg *config.Config,
+) error {
+	if db == nil || router == nil || authMiddleware == nil || rateLimiter == nil || spec == nil || loginLimiter == nil || auditRecorder == nil || cfg == nil {
+		err := errors.New("a required setup argument is nil")
 		log.WithError(err).Warn()
 		return err
 	}
 
 	auth := authSubrouter{
-		userRepository: userRepository,
+		userRepository:  userRepository,
+		oidcProviders:   oidcProviders,
+		tokenSecret:     []byte(cfg.Auth.TokenSecret),
+		tokenTTL:        cfg.Auth.TokenTTL,
+		requireAdmin2FA: cfg.Auth.RequireAdmin2FA,
+		totpIssuer:      cfg.Shop.Name,
+		loginLimiter:    loginLimiter,
+		auditRecorder:   auditRecorder,
 	}
 	auth.Router = router.
 		PathPrefix(prefix).
 		Subrouter()
 	auth.Db = db
+	// most routes here are used before logging in, so limits are per address
+	auth.Router.Use(rateLimiter.Middleware("auth", ratelimit.PerMinute(30)))
+
+	spec.Describe(auth.Router.HandleFunc("/login", auth.LoginHandler).Methods("POST"), openapi.Route{
+		Summary:  "Log in with an email and password",
+		Request:  authtypes.LoginRequest{},
+		Response: openapi.OneOf{authtypes.LoginResponse{}, authtypes.TwoFactorChallengeResponse{}},
+	})
+	spec.Describe(auth.Router.HandleFunc("/register", auth.RegisterHandler).Methods("POST"), openapi.Route{
+		Summary:  "Create an account",
+		Request:  authtypes.RegisterRequest{},
+		Status:   http.StatusCreated,
+		Response: authtypes.RegisterResponse{},
+	})
+
+	// Second step of the login for users with two-factor authentication
+	// Requires params: "challengeToken" and "code" or "recoveryCode" in body
+	spec.Describe(auth.Router.HandleFunc("/login/2fa", auth.TwoFactorLoginHandler).Methods("POST"), openapi.Route{
+		Summary:  "Finish logging in with a second factor",
+		Request:  authtypes.TwoFactorLoginRequest{},
+		Response: authtypes.TwoFactorLoginResponse{},
+	})
+
+	// Single sign on, login redirects to the provider which redirects back to
+	// the callback with a code that is exchanged for an auth token
+	spec.Describe(auth.Router.HandleFunc("/oidc/{provider}/login", auth.OIDCLoginHandler).Methods("GET"), openapi.Route{
+		Summary: "Start logging in with a single sign on provider",
+		Status:  http.StatusFound,
+	})
+	spec.Describe(auth.Router.HandleFunc("/oidc/{provider}/callback", auth.OIDCCallbackHandler).Methods("GET"), openapi.Route{
+		Summary:     "Finish logging in with a single sign on provider",
+		Description: "Called by the provider. Returns 201 when the account was created by this login.",
+		Query: []*openapi.Parameter{
+			openapi.Query("code", "string", "Authorization code"),
+			openapi.Query("state", "string", "State passed to the provider"),
+			openapi.Query("error", "string", "Set by the provider when the login failed"),
+		},
+		Response: openapi.OneOf{authtypes.LoginResponse{}, authtypes.TwoFactorChallengeResponse{}},
+	})
+
+	// Routes to set up and turn off two-factor authentication for the logged in user
+	twoFactorRouter := auth.Router.PathPrefix("/2fa").Subrouter()
+	twoFactorRouter.Use(authMiddleware)
+	spec.Describe(twoFactorRouter.HandleFunc("/enroll", auth.TwoFactorEnrollHandler).Methods("POST"), openapi.Route{
+		Summary:  "Start setting up two-factor authentication",
+		Auth:     true,
+		Response: authtypes.TwoFactorEnrollResponse{},
+	})
+	spec.Describe(twoFactorRouter.HandleFunc("/confirm", auth.TwoFactorConfirmHandler).Methods("POST"), openapi.Route{
+		Summary:  "Turn on two-factor authentication with a code from the authenticator app",
+		Auth:     true,
+		Request:  authtypes.TwoFactorConfirmRequest{},
+		Response: authtypes.RecoveryCodesResponse{},
+	})
+	spec.Describe(twoFactorRouter.HandleFunc("/disable", auth.TwoFactorDisableHandler).Methods("POST"), openapi.Route{
+		Summary:  "Turn off two-factor authentication",
+		Auth:     true,
+		Request:  authtypes.TwoFactorCodeRequest{},
+		Response: utiltypes.MessageResponse{},
+	})
 
-	auth.Router.HandleFunc("/login", auth.LoginHandler).Methods("POST")
-	auth.Router.HandleFunc("/register", auth.RegisterHandler).Methods("POST")
 	usersRouter := auth.Router.PathPrefix("/users").Subrouter()
-	usersRouter.Use(util.AuthMiddleware)
-	usersRouter.HandleFunc("/{userId}", auth.UpdateUserHandler).Methods("PATCH")
+	usersRouter.Use(authMiddleware)
+	spec.Describe(usersRouter.Handle("/{userId}", RequireSelfOrAdmin("userId")(http.HandlerFunc(auth.UpdateUserHandler))).Methods("PATCH").Name(passwordChangeRoute), openapi.Route{
+		Summary:     "Update a user's profile or password",
+		Description: "Users can update themselves, admins can update anyone. Users that must change their password can't use other routes until they do.",
+		Auth:        true,
+		Request:     authtypes.UpdateUserRequest{},
+		Response:    utiltypes.MessageResponse{},
+	})
 	return nil
 }
 
@@ -60,63 +151,103 @@ func (sr *authSubrouter) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Login requires 2 pieces of data:
 	// - email
 	// - password
-	decoder := json.NewDecoder(r.Body)
-	var userInfo models.User
-	err := decoder.Decode(&userInfo)
-	if err != nil {
+	var userInfo authtypes.LoginRequest
+	if err := util.DecodeJSON(w, r, &userInfo); err != nil {
 		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+		util.RespondError(w, err)
 		return
 	}
-	if len(userInfo.Email) == 0 || len(userInfo.Password) == 0 {
-		logger.Warn("Missing email or password")
-		util.Respond(w, http.StatusBadRequest, util.Message("missing user"))
+
+	if retryAfter := sr.loginLimiter.RetryAfter(util.ClientIP(r), userInfo.Email); retryAfter > 0 {
+		respondTooManyAttempts(w, retryAfter)
 		return
 	}
 
 	tx := sr.Db.Begin()
 	user, err := sr.userRepository.GetUserByEmail(tx, userInfo.Email)
-	if err != nil {
+	if err != nil && err != gorm.ErrRecordNotFound {
 		tx.Rollback()
 		logger.WithError(err).Warn()
-		if err == gorm.ErrRecordNotFound {
-			util.Respond(w, http.StatusNotFound, util.Message(err.Error()))
-			return
-		}
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	// unknown emails get the same response as wrong passwords, any error
+	// counts as a mismatch since users created through single sign on don't
+	// have a password
+	if user == nil {
+		compareDummyPassword(userInfo.Password)
+		err = bcrypt.ErrMismatchedHashAndPassword
+	} else {
+		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(userInfo.Password))
+	}
+	if err != nil {
+		sr.recordLoginFailure(r, userInfo.Email)
+		util.RespondError(w, util.Unauthorized("Invalid email or password"))
 		return
 	}
-	tx.Commit()
+	sr.loginLimiter.Succeeded(userInfo.Email)
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(userInfo.Password))
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		util.Respond(w, http.StatusUnauthorized, util.Message("Could not verify user password"))
+	if user.IsDeactivated() {
+		logger.Warnf("Deactivated user %s tried to log in", user.ID)
+		util.RespondError(w, util.Forbidden("Account is deactivated"))
 		return
 	}
 
 	// Queried user is now valid
 	user.Password = ""
 
-	//Create JWT token
-	tk := &models.Token{
-		UserId: user.ID,
-		Role:   user.Role,
+	// Users with two-factor authentication get a short lived challenge token
+	// to exchange for an auth token at /auth/login/2fa
+	if user.TOTPEnabled {
+		challengeToken, err := issueChallengeToken(sr.tokenSecret, user)
+		if err != nil {
+			util.RespondError(w, util.InternalError())
+			return
+		}
+
+		util.Respond(w, http.StatusOK, &authtypes.TwoFactorChallengeResponse{
+			Message:           "Two-factor authentication required",
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
-	tokenString, err := token.SignedString([]byte(os.Getenv("token_password")))
+	//Create JWT token
+	tokenString, err := issueToken(sr.tokenSecret, user, false, sr.tokenTTL)
 	if err != nil {
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, util.InternalError())
 		return
 	}
 
 	user.Token = tokenString //Store the token in the response
 
-	response := util.Message(fmt.Sprintf("Logged In as %s", user.FirstName))
-	response["token"] = user.Token
-	response["userId"] = user.ID
+	util.Respond(w, http.StatusOK, &authtypes.LoginResponse{
+		Message:                     fmt.Sprintf("Logged In as %s", user.FirstName),
+		Token:                       user.Token,
+		UserId:                      user.ID,
+		MustChangePassword:          user.MustChangePassword,
+		TwoFactorEnrollmentRequired: sr.requireAdmin2FA && user.Role == models.RoleAdmin,
+	})
+}
 
-	util.Respond(w, http.StatusOK, response)
+// issueToken creates the JWT used to authenticate as user signed with secret,
+// it expires after ttl. mfa is set for logins with a second factor.
+func issueToken(secret []byte, user *models.User, mfa bool, ttl time.Duration) (string, error) {
+	tk := &models.Token{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+		UserId: user.ID,
+		Role:   user.Role,
+		MFA:    mfa,
+	}
+
+	// HS256 is a symmetric key encryption algorithm. The same token password that is used to sign the token is used to verify the token
+	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
+	return token.SignedString(secret)
 }
 
 func (sr *authSubrouter) RegisterHandler(w http.ResponseWriter, r *http.Request) {
@@ -131,61 +262,58 @@ func (sr *authSubrouter) RegisterHandler(w http.ResponseWriter, r *http.Request)
 	// - email
 	// - password
 	// - phone (OPTIONAL)
-	decoder := json.NewDecoder(r.Body)
-	var userInfo *models.User
-	err := decoder.Decode(&userInfo)
-	if err != nil {
+	var reqData authtypes.RegisterRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
 		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+		util.RespondError(w, err)
 		return
 	}
 
-	// make email to lower
-	userInfo.Email = strings.ToLower(userInfo.Email)
-
-	if err := userInfo.Validate(); err != nil || len(userInfo.FirstName) == 0 || len(userInfo.LastName) == 0 {
-		logger.Warn("you must have a first name and a last name")
-		util.Respond(w, http.StatusBadRequest, util.Message("Invalid first or last name"))
+	userInfo := &models.User{
+		// Generate UUID
+		ID:          uuid.New(),
+		FirstName:   reqData.FirstName,
+		LastName:    reqData.LastName,
+		Email:       strings.ToLower(reqData.Email),
+		PhoneNumber: reqData.PhoneNumber,
+		Password:    reqData.Password,
+		// registered accounts always default to role type as user
+		Role: models.RoleUser,
+	}
+	if err := userInfo.Validate(); err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
 		return
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userInfo.Password), bcrypt.DefaultCost)
 	if err != nil {
 		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, err)
+		return
 	}
 	userInfo.Password = string(hashedPassword)
 
-	// Generate UUID
-	userInfo.ID = uuid.New()
-
 	tx := sr.Db.Begin()
 	if err := sr.userRepository.CreateUser(tx, userInfo); err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+		util.RespondError(w, err)
 		return
 	}
-	tx.Commit()
+	dbtx.Commit(tx)
 
-	//Create new JWT token for the newly registered account and default to role type as user
-	tk := &models.Token{
-		UserId: userInfo.ID,
-		Role:   "user",
-	}
-
-	// HS256 is a symmetric key encryption algorithm. The same token password that is used to sign the token is used to verify the token
-	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
-	tokenString, _ := token.SignedString([]byte(os.Getenv("token_password")))
+	//Create new JWT token for the newly registered account
+	tokenString, _ := issueToken(sr.tokenSecret, userInfo, false, sr.tokenTTL)
 	userInfo.Token = tokenString
 
 	userInfo.Password = "" //delete password
 
-	response := util.Message("Created User")
-	response["token"] = userInfo.Token
-	response["userId"] = userInfo.ID
-
-	util.Respond(w, http.StatusCreated, response)
+	util.Respond(w, http.StatusCreated, &authtypes.RegisterResponse{
+		Message: "Created User",
+		Token:   userInfo.Token,
+		UserId:  userInfo.ID,
+	})
 }
 
 func (sr *authSubrouter) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -200,19 +328,14 @@ func (sr *authSubrouter) UpdateUserHandler(w http.ResponseWriter, r *http.Reques
 		"method":  r.Method,
 	})
 
+	// only the user or an admin can get here, see RequireSelfOrAdmin
 	vars := mux.Vars(r)
 	requestedUser := vars["userId"]
-	if r.Context().Value("role") != "admin" && r.Context().Value("user") != requestedUser {
-		logger.Warnf("Forbidden user %s", r.Context().Value("user"))
-		util.Respond(w, http.StatusForbidden, util.Message("Forbidden"))
-		return
-	}
 
-	var userInfo *models.User
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&userInfo); err != nil {
+	var userInfo authtypes.UpdateUserRequest
+	if err := util.DecodeJSON(w, r, &userInfo); err != nil {
 		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+		util.RespondError(w, err)
 		return
 	}
 
@@ -222,7 +345,7 @@ func (sr *authSubrouter) UpdateUserHandler(w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn("Database Error")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, err)
 		return
 	}
 
@@ -231,10 +354,11 @@ func (sr *authSubrouter) UpdateUserHandler(w http.ResponseWriter, r *http.Reques
 	if user, doesUserExist = usersMap[requestedUser]; !doesUserExist {
 		tx.Rollback()
 		logger.WithError(err).Warn("user not found")
-		util.Respond(w, http.StatusNotFound, util.Message("User not found"))
+		util.RespondError(w, util.NotFound("User not found"))
 		return
 	}
 
+	before := *user
 	if userInfo.Email != "" {
 		user.Email = strings.ToLower(userInfo.Email)
 	}
@@ -246,12 +370,14 @@ func (sr *authSubrouter) UpdateUserHandler(w http.ResponseWriter, r *http.Reques
 	}
 	if userInfo.Password != "" {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userInfo.Password), bcrypt.DefaultCost)
-		if err != nil || len(userInfo.Password) < 8 {
+		if err != nil {
+			tx.Rollback()
 			logger.WithError(err).Warn()
-			util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+			util.RespondError(w, err)
 			return
 		}
 		user.Password = string(hashedPassword)
+		user.MustChangePassword = false
 	}
 	if userInfo.PhoneNumber != nil && *userInfo.PhoneNumber != "" {
 		user.PhoneNumber = userInfo.PhoneNumber
@@ -260,10 +386,22 @@ func (sr *authSubrouter) UpdateUserHandler(w http.ResponseWriter, r *http.Reques
 	if err := sr.userRepository.UpdateUser(tx, user); err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn("Database Error")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditUserUpdate,
+		EntityType: models.AuditEntityUser,
+		EntityId:   requestedUser,
+		Before:     &before,
+		After:      user,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
 		return
 	}
 
-	tx.Commit()
+	dbtx.Commit(tx)
 	util.Respond(w, http.StatusOK, util.Message("Successfully updated user"))
 }
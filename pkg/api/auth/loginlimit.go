@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/audit"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/dbtx"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/ratelimit"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LoginLimits are the failed login attempts allowed before further attempts
+// are refused
+type LoginLimits struct {
+	// failures per email before the account is locked
+	MaxAccountFailures int
+	// failures per IP address before the address is blocked
+	MaxIPFailures int
+	// how long failures are counted for
+	Window time.Duration
+	// how long accounts and addresses are locked for
+	Lockout time.Duration
+}
+
+func DefaultLoginLimits() LoginLimits {
+	return LoginLimits{
+		MaxAccountFailures: 5,
+		MaxIPFailures:      20,
+		Window:             15 * time.Minute,
+		Lockout:            15 * time.Minute,
+	}
+}
+
+// LoginLimiter counts failed logins per account and IP address. Accounts are
+// keyed by email whether or not a user exists, so lockouts don't reveal
+// which emails are registered.
+type LoginLimiter struct {
+	store  ratelimit.Store
+	limits LoginLimits
+}
+
+func NewLoginLimiter(store ratelimit.Store, limits LoginLimits) *LoginLimiter {
+	return &LoginLimiter{
+		store:  store,
+		limits: limits,
+	}
+}
+
+func normalizeAccount(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func accountFailuresKey(account string) string { return "login:failures:account:" + account }
+func accountLockKey(account string) string     { return "login:lock:account:" + account }
+func ipFailuresKey(ip string) string           { return "login:failures:ip:" + ip }
+func ipLockKey(ip string) string               { return "login:lock:ip:" + ip }
+
+// RetryAfter returns how long until ip or account can log in again, 0 if
+// they aren't locked. Store errors don't block logins.
+func (l *LoginLimiter) RetryAfter(ip string, email string) time.Duration {
+	account := normalizeAccount(email)
+
+	var retryAfter time.Duration
+	for _, key := range []string{accountLockKey(account), ipLockKey(ip)} {
+		ttl, err := l.store.TTL(key)
+		if err != nil {
+			log.WithError(err).Warn("Error checking login lockout")
+			continue
+		}
+		if ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+	return retryAfter
+}
+
+// Failed records a failed attempt and returns true if it locked the account
+func (l *LoginLimiter) Failed(ip string, email string) bool {
+	account := normalizeAccount(email)
+
+	ipFailures, err := l.store.Increment(ipFailuresKey(ip), l.limits.Window)
+	if err != nil {
+		log.WithError(err).Warn("Error counting failed login")
+	} else if ipFailures >= int64(l.limits.MaxIPFailures) {
+		l.lock(ipLockKey(ip), ipFailuresKey(ip))
+	}
+
+	accountFailures, err := l.store.Increment(accountFailuresKey(account), l.limits.Window)
+	if err != nil {
+		log.WithError(err).Warn("Error counting failed login")
+		return false
+	}
+	if accountFailures >= int64(l.limits.MaxAccountFailures) {
+		l.lock(accountLockKey(account), accountFailuresKey(account))
+		return true
+	}
+	return false
+}
+
+// the failures are cleared so the count starts over once the lock expires
+func (l *LoginLimiter) lock(lockKey string, failuresKey string) {
+	if err := l.store.Set(lockKey, l.limits.Lockout); err != nil {
+		log.WithError(err).Warn("Error locking login")
+	}
+	if err := l.store.Delete(failuresKey); err != nil {
+		log.WithError(err).Warn("Error clearing failed logins")
+	}
+}
+
+// Succeeded clears the failures of the account
+func (l *LoginLimiter) Succeeded(email string) {
+	if err := l.store.Delete(accountFailuresKey(normalizeAccount(email))); err != nil {
+		log.WithError(err).Warn("Error clearing failed logins")
+	}
+}
+
+// recordLoginFailure counts a failed login and audits lockouts, the failed
+// login itself has no transaction so the event gets its own
+func (sr *authSubrouter) recordLoginFailure(r *http.Request, email string) {
+	ip := util.ClientIP(r)
+	if !sr.loginLimiter.Failed(ip, email) {
+		return
+	}
+
+	account := normalizeAccount(email)
+	logger := log.WithFields(log.Fields{
+		"event":   "login_lockout",
+		"account": account,
+		"ip":      ip,
+	})
+	logger.Warn("Account locked after failed logins")
+
+	tx := sr.Db.Begin()
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditLoginLockout,
+		EntityType: models.AuditEntityAccount,
+		EntityId:   account,
+		After: map[string]interface{}{
+			"lockedFor": sr.loginLimiter.limits.Lockout.String(),
+		},
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		return
+	}
+	dbtx.Commit(tx)
+}
+
+func respondTooManyAttempts(w http.ResponseWriter, retryAfter time.Duration) {
+	// round up so clients don't retry just before the lock expires
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	util.RespondError(w, util.TooManyRequests("Too many failed login attempts, try again later"))
+}
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+// compareDummyPassword takes as long as checking a real password so response
+// times don't reveal whether an email is registered
+func compareDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginLimiterLocksAccount(t *testing.T) {
+	limits := DefaultLoginLimits()
+	limiter := NewLoginLimiter(ratelimit.NewMemoryStore(), limits)
+
+	for i := 1; i < limits.MaxAccountFailures; i++ {
+		assert.False(t, limiter.Failed("10.0.0.1", "user@test.com"))
+		assert.Zero(t, limiter.RetryAfter("10.0.0.1", "user@test.com"))
+	}
+	assert.True(t, limiter.Failed("10.0.0.1", "User@Test.com "))
+
+	// the lock is on the account, not the address
+	assert.True(t, limiter.RetryAfter("10.0.0.2", "user@test.com") > 0)
+	assert.True(t, limiter.RetryAfter("10.0.0.2", "user@test.com") <= limits.Lockout)
+	assert.Zero(t, limiter.RetryAfter("10.0.0.1", "other@test.com"))
+}
+
+func TestLoginLimiterSuccessClearsFailures(t *testing.T) {
+	limits := DefaultLoginLimits()
+	limiter := NewLoginLimiter(ratelimit.NewMemoryStore(), limits)
+
+	for i := 1; i < limits.MaxAccountFailures; i++ {
+		limiter.Failed("10.0.0.1", "user@test.com")
+	}
+	limiter.Succeeded("user@test.com")
+
+	assert.False(t, limiter.Failed("10.0.0.1", "user@test.com"))
+	assert.Zero(t, limiter.RetryAfter("10.0.0.1", "user@test.com"))
+}
+
+func TestLoginLimiterBlocksIP(t *testing.T) {
+	limits := LoginLimits{
+		MaxAccountFailures: 100,
+		MaxIPFailures:      3,
+		Window:             time.Minute,
+		Lockout:            time.Minute,
+	}
+	limiter := NewLoginLimiter(ratelimit.NewMemoryStore(), limits)
+
+	// spreading attempts over many emails still blocks the address
+	limiter.Failed("10.0.0.1", "a@test.com")
+	limiter.Failed("10.0.0.1", "b@test.com")
+	assert.Zero(t, limiter.RetryAfter("10.0.0.1", "c@test.com"))
+	limiter.Failed("10.0.0.1", "c@test.com")
+
+	assert.True(t, limiter.RetryAfter("10.0.0.1", "d@test.com") > 0)
+	assert.Zero(t, limiter.RetryAfter("10.0.0.2", "d@test.com"))
+}
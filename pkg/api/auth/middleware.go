@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/audit"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/config"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/dbtx"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewMiddleware authenticates requests with either an auth token or an API
+// key and makes sure the user they belong to still exists and hasn't been
+// deactivated, the principal is then available to handlers through
+// PrincipalFromContext
+//
+// API keys are accepted through `X-API-Key: {key}` or
+// `Authorization: ApiKey {key}`, auth tokens through `Authorization: Bearer {token}`
+//
+// Tokens are verified with the secret in cfg. With RequireAdmin2FA admins only
+// get the permissions of regular users until they log in with a second factor,
+// API keys never have one
+//
+// Users that must change their password can only use the route to update
+// their own profile until they do
+func NewMiddleware(db *gorm.DB, userRepository repository_interfaces.UserRepository, apiKeyRepository repository_interfaces.APIKeyRepository, cfg config.Auth) mux.MiddlewareFunc {
+	tokenSecret := []byte(cfg.TokenSecret)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := log.WithFields(log.Fields{
+				"request": "AuthMiddleware",
+				"method":  r.Method,
+			})
+
+			apiKey := r.Header.Get("X-API-Key")
+			tokenHeader := r.Header.Get("Authorization")
+
+			// token header: `Bearer {token-body}` or `ApiKey {key}`
+			splitted := strings.Split(tokenHeader, " ")
+			if apiKey == "" && len(splitted) == 2 && splitted[0] == "ApiKey" {
+				apiKey = splitted[1]
+			}
+			if apiKey == "" && (tokenHeader == "" || len(splitted) != 2) {
+				util.RespondError(w, util.NewError(http.StatusForbidden, utiltypes.CodeInvalidToken, "Missing/Invalid/Malformed auth token"))
+				return
+			}
+
+			tx := db.Begin()
+			var principal *Principal
+			var err error
+			if apiKey != "" {
+				principal, err = principalFromAPIKey(tx, userRepository, apiKeyRepository, apiKey, cfg.RequireAdmin2FA)
+			} else {
+				principal, err = principalFromToken(tx, userRepository, tokenSecret, splitted[1], cfg.RequireAdmin2FA)
+			}
+			if err != nil {
+				tx.Rollback()
+				if authErr, ok := err.(authError); ok {
+					util.RespondError(w, authErr.apiError())
+					return
+				}
+				logger.WithError(err).Warn("Database Error")
+				util.RespondError(w, err)
+				return
+			}
+			dbtx.Commit(tx)
+
+			if passwordChangePending(r, principal) {
+				util.RespondError(w, util.NewError(http.StatusForbidden, utiltypes.CodePasswordChange, "Password must be changed first"))
+				return
+			}
+
+			r = r.WithContext(WithPrincipal(r.Context(), principal))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// passwordChangeRoute names the route users that must change their password
+// are limited to
+const passwordChangeRoute = "auth.updateUser"
+
+// passwordChangePending is true when the principal must change their password
+// and the request isn't changing it. The route is identified by name so it
+// doesn't depend on where the API is mounted.
+func passwordChangePending(r *http.Request, principal *Principal) bool {
+	if !principal.MustChangePassword {
+		return false
+	}
+	route := mux.CurrentRoute(r)
+	return route == nil || route.GetName() != passwordChangeRoute || !principal.IsSelf(mux.Vars(r)["userId"])
+}
+
+// authError is returned for credentials that should be rejected, its text is
+// sent back to the client
+type authError string
+
+func (err authError) Error() string {
+	return string(err)
+}
+
+func (err authError) apiError() *utiltypes.APIError {
+	if err == errDeactivatedAccount {
+		return util.NewError(http.StatusForbidden, utiltypes.CodeAccountDisabled, string(err))
+	}
+	return util.NewError(http.StatusForbidden, utiltypes.CodeInvalidToken, string(err))
+}
+
+const (
+	errInvalidToken       = authError("Something was wrong with auth token")
+	errInvalidAPIKey      = authError("Invalid API key")
+	errDeactivatedAccount = authError("Account is deactivated")
+)
+
+// activeUser returns the user unless they were deleted or deactivated
+func activeUser(tx *gorm.DB, userRepository repository_interfaces.UserRepository, userId string) (*models.User, error) {
+	usersMap, err := userRepository.GetUsersByIds(tx, []string{userId})
+	if err != nil {
+		return nil, err
+	}
+
+	// deleted users are filtered out by the query
+	user, doesUserExist := usersMap[userId]
+	if !doesUserExist || user.IsDeactivated() {
+		return nil, errDeactivatedAccount
+	}
+	return user, nil
+}
+
+func principalFromToken(tx *gorm.DB, userRepository repository_interfaces.UserRepository, secret []byte, tokenString string, requireAdmin2FA bool) (*Principal, error) {
+	tk, err := parseToken(secret, tokenString)
+	// tokens issued for other purposes, like two-factor challenges, can't be
+	// used to authenticate
+	if err != nil || tk.Purpose != "" {
+		return nil, errInvalidToken
+	}
+
+	user, err := activeUser(tx, userRepository, tk.UserId.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// use the stored role so role changes apply without logging in again
+	return &Principal{
+		UserId:             user.ID,
+		Role:               grantedRole(user, tk.MFA, requireAdmin2FA),
+		MustChangePassword: user.MustChangePassword,
+	}, nil
+}
+
+// grantedRole is the role of the user, except for admins that have to but
+// didn't authenticate with a second factor, who only get the user role. The
+// second factor only counts while it is still enabled, so tokens from before
+// it was disabled lose admin permissions.
+func grantedRole(user *models.User, mfa bool, requireAdmin2FA bool) string {
+	if requireAdmin2FA && user.Role == models.RoleAdmin && !(mfa && user.TOTPEnabled) {
+		return models.RoleUser
+	}
+	return user.Role
+}
+
+// parseToken verifies the signature of tokenString with secret
+func parseToken(secret []byte, tokenString string) (*models.Token, error) {
+	tk := &models.Token{}
+
+	token, err := jwt.ParseWithClaims(tokenString, tk, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errInvalidToken
+		}
+		return secret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errInvalidToken
+	}
+	return tk, nil
+}
+
+func principalFromAPIKey(tx *gorm.DB, userRepository repository_interfaces.UserRepository, apiKeyRepository repository_interfaces.APIKeyRepository, apiKey string, requireAdmin2FA bool) (*Principal, error) {
+	prefix, ok := ParseAPIKeyPrefix(apiKey)
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	key, err := apiKeyRepository.GetAPIKeyByPrefix(tx, prefix)
+	if err == gorm.ErrRecordNotFound {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !apiKeyMatches(apiKey, key.Hash) || key.IsRevoked() {
+		return nil, errInvalidAPIKey
+	}
+
+	principal := &Principal{
+		APIKeyId: key.ID,
+		Scopes:   key.Permissions(),
+	}
+	if key.UserId != nil {
+		user, err := activeUser(tx, userRepository, key.UserId.String())
+		if err != nil {
+			return nil, err
+		}
+		principal.UserId = user.ID
+		principal.Role = grantedRole(user, false, requireAdmin2FA)
+		principal.MustChangePassword = user.MustChangePassword
+	}
+
+	if err := apiKeyRepository.TouchAPIKey(tx, key, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return principal, nil
+}
+
+// RequirePermission only lets through requests whose role has the permission,
+// it has to run after the auth middleware
+func RequirePermission(permission models.Permission) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok || !principal.HasPermission(permission) {
+				log.WithField("permission", permission).Warn("Missing permission")
+				util.RespondError(w, util.Forbidden("Invalid role type"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSelfOrPermission only lets through requests for the principal's own
+// user, taken from the userIdVar route variable, or with the permission
+func RequireSelfOrPermission(userIdVar string, permission models.Permission) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok || (!principal.IsSelf(mux.Vars(r)[userIdVar]) && !principal.HasPermission(permission)) {
+				log.WithField("permission", permission).Warn("Forbidden user")
+				util.RespondError(w, util.Forbidden("Forbidden"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSelfOrAdmin is RequireSelfOrPermission for admins managing users
+func RequireSelfOrAdmin(userIdVar string) mux.MiddlewareFunc {
+	return RequireSelfOrPermission(userIdVar, models.PermissionUsersManage)
+}
+
+// RateLimitKey counts requests against the API key or user once
+// authenticated, and against the client address otherwise
+func RateLimitKey(r *http.Request) string {
+	if principal, ok := PrincipalFromContext(r.Context()); ok {
+		if principal.IsAPIKey() {
+			return fmt.Sprintf("apikey:%d", principal.APIKeyId)
+		}
+		if principal.HasUser() {
+			return "user:" + principal.UserId.String()
+		}
+	}
+	return "ip:" + util.ClientIP(r)
+}
+
+// AuditActor records changes against the user and API key of the principal
+func AuditActor(r *http.Request) audit.Actor {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		return audit.Actor{}
+	}
+
+	var actor audit.Actor
+	if principal.HasUser() {
+		userId := principal.UserId
+		actor.UserId = &userId
+	}
+	if principal.IsAPIKey() {
+		apiKeyId := principal.APIKeyId
+		actor.APIKeyId = &apiKeyId
+	}
+	return actor
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/authtypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/dbtx"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/oidc"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	// how long users have to log in with the provider
+	oidcStateTTL = 10 * time.Minute
+)
+
+var errInvalidState = errors.New("invalid oidc state")
+
+// oidcState is kept in a signed cookie between the login redirect and the
+// callback, tying the callback to the browser that started the login
+type oidcState struct {
+	Provider  string `json:"p"`
+	State     string `json:"s"`
+	Nonce     string `json:"n"`
+	ExpiresAt int64  `json:"e"`
+}
+
+func signState(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func encodeState(secret []byte, state *oidcState) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signState(secret, payload), nil
+}
+
+func decodeState(secret []byte, value string) (*oidcState, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signState(secret, parts[0]))) {
+		return nil, errInvalidState
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errInvalidState
+	}
+	var state oidcState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errInvalidState
+	}
+	if time.Now().Unix() > state.ExpiresAt {
+		return nil, errInvalidState
+	}
+	return &state, nil
+}
+
+func (sr *authSubrouter) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "OIDCLoginHandler",
+		"method":  r.Method,
+	})
+
+	vars := mux.Vars(r)
+	provider, ok := sr.oidcProviders[vars["provider"]]
+	if !ok {
+		util.RespondError(w, util.NotFound("Unknown provider"))
+		return
+	}
+
+	stateValue, err := randomString(24)
+	if err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
+		return
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
+		return
+	}
+
+	state := &oidcState{
+		Provider:  provider.Name(),
+		State:     stateValue,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().Add(oidcStateTTL).Unix(),
+	}
+	cookieValue, err := encodeState(sr.tokenSecret, state)
+	if err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state.State, state.Nonce)
+	if err != nil {
+		logger.WithError(err).Warn("Error reaching provider")
+		util.RespondError(w, util.BadGateway("Could not reach login provider"))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    cookieValue,
+		Path:     prefix + "/oidc",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   provider.SecureCallback(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (sr *authSubrouter) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "OIDCCallbackHandler",
+		"method":  r.Method,
+	})
+
+	vars := mux.Vars(r)
+	provider, ok := sr.oidcProviders[vars["provider"]]
+	if !ok {
+		util.RespondError(w, util.NotFound("Unknown provider"))
+		return
+	}
+
+	params := r.URL.Query()
+	if providerError := params.Get("error"); providerError != "" {
+		logger.Warnf("Provider returned error %s", providerError)
+		util.RespondError(w, util.Unauthorized("Login was not completed"))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		util.RespondError(w, util.BadRequest("Missing login state"))
+		return
+	}
+	// the state can only be used once
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     prefix + "/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   provider.SecureCallback(),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	state, err := decodeState(sr.tokenSecret, cookie.Value)
+	if err != nil || state.Provider != provider.Name() || state.State != params.Get("state") {
+		logger.Warn("Invalid login state")
+		util.RespondError(w, util.BadRequest("Invalid login state"))
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), params.Get("code"), state.Nonce)
+	if err == oidc.ErrInvalidIDToken || err == oidc.ErrNonceMismatch {
+		logger.WithError(err).Warn()
+		util.RespondError(w, util.Unauthorized("Could not verify login"))
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Warn("Error reaching provider")
+		util.RespondError(w, util.BadGateway("Could not reach login provider"))
+		return
+	}
+
+	// only verified emails can be linked to accounts
+	if claims.Email == "" || !claims.EmailVerified {
+		util.RespondError(w, util.Forbidden("Login provider has not verified your email"))
+		return
+	}
+
+	tx := sr.Db.Begin()
+	user, created, err := sr.findOrCreateOIDCUser(tx, claims)
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	if user.DeletedAt != nil || user.IsDeactivated() {
+		logger.Warnf("Deactivated user %s tried to log in", user.ID)
+		util.RespondError(w, util.Forbidden("Account is deactivated"))
+		return
+	}
+
+	// single sign on doesn't skip our own second factor
+	if user.TOTPEnabled {
+		challengeToken, err := issueChallengeToken(sr.tokenSecret, user)
+		if err != nil {
+			util.RespondError(w, util.InternalError())
+			return
+		}
+
+		util.Respond(w, http.StatusOK, &authtypes.TwoFactorChallengeResponse{
+			Message:           "Two-factor authentication required",
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
+		return
+	}
+
+	tokenString, err := issueToken(sr.tokenSecret, user, false, sr.tokenTTL)
+	if err != nil {
+		util.RespondError(w, util.InternalError())
+		return
+	}
+
+	response := &authtypes.LoginResponse{
+		Message:                     fmt.Sprintf("Logged In as %s", user.FirstName),
+		Token:                       tokenString,
+		UserId:                      user.ID,
+		MustChangePassword:          false,
+		TwoFactorEnrollmentRequired: sr.requireAdmin2FA && user.Role == models.RoleAdmin,
+	}
+
+	if created {
+		util.Respond(w, http.StatusCreated, response)
+		return
+	}
+	util.Respond(w, http.StatusOK, response)
+}
+
+// findOrCreateOIDCUser links the login to the user with the same email, or
+// creates a user without a password
+func (sr *authSubrouter) findOrCreateOIDCUser(tx *gorm.DB, claims *oidc.Claims) (*models.User, bool, error) {
+	email := strings.ToLower(claims.Email)
+
+	// deleted users keep their email, so include them and reject them later
+	user, err := sr.userRepository.GetUserByEmail(tx.Unscoped(), email)
+	if err == nil {
+		return user, false, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, false, err
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		names := strings.SplitN(strings.TrimSpace(claims.Name), " ", 2)
+		firstName = names[0]
+		if len(names) == 2 {
+			lastName = names[1]
+		}
+	}
+	if firstName == "" {
+		firstName = strings.SplitN(email, "@", 2)[0]
+	}
+
+	// a random password nobody knows, password login stays disabled until
+	// the user sets one
+	password, err := randomString(32)
+	if err != nil {
+		return nil, false, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, false, err
+	}
+
+	user = &models.User{
+		ID:        uuid.New(),
+		FirstName: firstName,
+		LastName:  lastName,
+		Email:     email,
+		Password:  string(hashedPassword),
+		Role:      models.RoleUser,
+	}
+	if err := sr.userRepository.CreateUser(tx, user); err != nil {
+		return nil, false, err
+	}
+	return user, true, nil
+}
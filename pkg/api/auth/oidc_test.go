@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/oidc"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/test"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSecret signs the tokens and state cookies in tests
+var testSecret = []byte("test secret")
+
+func TestOIDCState(t *testing.T) {
+	state := &oidcState{
+		Provider:  "test",
+		State:     "state",
+		Nonce:     "nonce",
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	}
+
+	encoded, err := encodeState(testSecret, state)
+	require.NoError(t, err)
+
+	decoded, err := decodeState(testSecret, encoded)
+	require.NoError(t, err)
+	assert.Equal(t, state, decoded)
+
+	// tampered payload
+	_, err = decodeState(testSecret, "e30"+encoded[3:])
+	assert.Equal(t, errInvalidState, err)
+
+	// signed with another secret
+	_, err = decodeState([]byte("other secret"), encoded)
+	assert.Equal(t, errInvalidState, err)
+
+	state.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	expired, err := encodeState(testSecret, state)
+	require.NoError(t, err)
+	_, err = decodeState(testSecret, expired)
+	assert.Equal(t, errInvalidState, err)
+}
+
+func TestOIDCLoginHandler(t *testing.T) {
+	server := test.NewOIDCServer(t)
+	defer server.Close()
+
+	sr := authSubrouter{
+		tokenSecret: testSecret,
+		oidcProviders: map[string]*oidc.Provider{
+			"test": oidc.NewProvider(oidc.Config{
+				Name:         "test",
+				Issuer:       server.URL,
+				ClientID:     test.OIDCClientID,
+				ClientSecret: test.OIDCClientSecret,
+				RedirectURL:  "http://localhost:5000/auth/oidc/test/callback",
+			}, server.Client()),
+		},
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/oidc/{provider}/login", sr.OIDCLoginHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/unknown/login", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/test/login", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, oidcStateCookie, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	// the redirect url is http
+	assert.False(t, cookies[0].Secure)
+
+	// the cookie ties the provider redirect to this browser
+	state, err := decodeState(testSecret, cookies[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, "test", state.Provider)
+	assert.Equal(t, state.State, location.Query().Get("state"))
+	assert.Equal(t, state.Nonce, location.Query().Get("nonce"))
+}
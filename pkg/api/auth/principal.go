@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated user a request is made on behalf of. For
+// API keys that aren't bound to a user UserId is uuid.Nil and Role is empty.
+type Principal struct {
+	UserId uuid.UUID
+	Role   string
+	// MustChangePassword limits the user to changing their password
+	MustChangePassword bool
+
+	// set when authenticated with an API key, limiting the principal to Scopes
+	APIKeyId uint
+	Scopes   []models.Permission
+}
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFromContext returns false for requests that didn't go through the
+// auth middleware
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
+func (principal *Principal) IsAPIKey() bool {
+	return principal.APIKeyId != 0
+}
+
+// HasUser is false for API keys that aren't bound to a user
+func (principal *Principal) HasUser() bool {
+	return principal.UserId != uuid.Nil
+}
+
+// HasPermission checks the role, API keys also need the permission in scope
+// and unbound keys only have their scopes
+func (principal *Principal) HasPermission(permission models.Permission) bool {
+	if principal.IsAPIKey() {
+		inScope := false
+		for _, scope := range principal.Scopes {
+			if scope == permission {
+				inScope = true
+				break
+			}
+		}
+		if !inScope {
+			return false
+		}
+		if !principal.HasUser() {
+			return true
+		}
+	}
+	return models.RoleHasPermission(principal.Role, permission)
+}
+
+func (principal *Principal) IsAdmin() bool {
+	return principal.HasPermission(models.PermissionUsersManage)
+}
+
+// IsSelf compares against user ids in any casing, as they come from the url
+func (principal *Principal) IsSelf(userId string) bool {
+	parsed, err := uuid.Parse(userId)
+	return err == nil && principal.HasUser() && parsed == principal.UserId
+}
+
+// CanAccess reports whether the principal owns a resource or has the
+// permission to access resources of other users
+func (principal *Principal) CanAccess(ownerId uuid.UUID, permission models.Permission) bool {
+	return (principal.HasUser() && principal.UserId == ownerId) || principal.HasPermission(permission)
+}
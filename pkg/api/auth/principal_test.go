@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrincipalFromContext(t *testing.T) {
+	_, ok := PrincipalFromContext(context.Background())
+	assert.False(t, ok)
+
+	// raw string keys don't collide with the principal key
+	ctx := context.WithValue(context.Background(), "user", uuid.New())
+	_, ok = PrincipalFromContext(ctx)
+	assert.False(t, ok)
+
+	principal := &Principal{UserId: uuid.New(), Role: models.RoleUser}
+	fromContext, ok := PrincipalFromContext(WithPrincipal(ctx, principal))
+	assert.True(t, ok)
+	assert.Equal(t, principal, fromContext)
+}
+
+func TestPrincipalIsSelf(t *testing.T) {
+	principal := &Principal{UserId: uuid.New(), Role: models.RoleUser}
+
+	assert.True(t, principal.IsSelf(principal.UserId.String()))
+	assert.True(t, principal.IsSelf(strings.ToUpper(principal.UserId.String())))
+	assert.False(t, principal.IsSelf(uuid.New().String()))
+	assert.False(t, principal.IsSelf("not-a-uuid"))
+}
+
+func TestPrincipalAPIKeyPermissions(t *testing.T) {
+	unbound := &Principal{
+		APIKeyId: 1,
+		Scopes:   []models.Permission{models.PermissionOrdersRead},
+	}
+	assert.True(t, unbound.HasPermission(models.PermissionOrdersRead))
+	assert.False(t, unbound.HasPermission(models.PermissionOrdersUpdate))
+	assert.False(t, unbound.IsSelf(uuid.Nil.String()))
+	assert.False(t, unbound.CanAccess(uuid.Nil, models.PermissionOrdersUpdate))
+
+	// bound keys are limited by both their scopes and the user's role
+	bound := &Principal{
+		UserId:   uuid.New(),
+		Role:     models.RoleBarista,
+		APIKeyId: 2,
+		Scopes:   []models.Permission{models.PermissionOrdersCreate, models.PermissionMenuEdit},
+	}
+	assert.True(t, bound.HasPermission(models.PermissionOrdersCreate))
+	assert.False(t, bound.HasPermission(models.PermissionOrdersUpdate))
+	assert.False(t, bound.HasPermission(models.PermissionMenuEdit))
+	assert.True(t, bound.IsSelf(bound.UserId.String()))
+}
+
+func TestRequireSelfOrAdmin(t *testing.T) {
+	router := mux.NewRouter()
+	router.Handle("/users/{userId}", RequireSelfOrAdmin("userId")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	user := &Principal{UserId: uuid.New(), Role: models.RoleUser}
+	admin := &Principal{UserId: uuid.New(), Role: models.RoleAdmin}
+	manager := &Principal{UserId: uuid.New(), Role: models.RoleManager}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		userId    uuid.UUID
+		expected  int
+	}{
+		{"self", user, user.UserId, http.StatusOK},
+		{"other user", user, admin.UserId, http.StatusForbidden},
+		{"admin", admin, user.UserId, http.StatusOK},
+		{"manager", manager, user.UserId, http.StatusForbidden},
+		{"unauthenticated", nil, user.UserId, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("PATCH", "/users/"+test.userId.String(), nil)
+			if test.principal != nil {
+				r = r.WithContext(WithPrincipal(r.Context(), test.principal))
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+			assert.Equal(t, test.expected, w.Code)
+		})
+	}
+}
+
+func TestPasswordChangePending(t *testing.T) {
+	router := mux.NewRouter()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromContext(r.Context())
+		if passwordChangePending(r, principal) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	router.HandleFunc("/api/auth/users/{userId}", handler).Methods("PATCH").Name(passwordChangeRoute)
+	router.HandleFunc("/api/purchase", handler).Methods("GET")
+
+	seeded := &Principal{UserId: uuid.New(), Role: models.RoleAdmin, MustChangePassword: true}
+	user := &Principal{UserId: uuid.New(), Role: models.RoleUser}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		method    string
+		path      string
+		expected  int
+	}{
+		{"change own password", seeded, "PATCH", "/api/auth/users/" + seeded.UserId.String(), http.StatusOK},
+		{"update other user", seeded, "PATCH", "/api/auth/users/" + user.UserId.String(), http.StatusForbidden},
+		{"other route", seeded, "GET", "/api/purchase", http.StatusForbidden},
+		{"password changed", user, "GET", "/api/purchase", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, nil)
+			r = r.WithContext(WithPrincipal(r.Context(), test.principal))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+			assert.Equal(t, test.expected, w.Code)
+		})
+	}
+}
+
+func TestGrantedRole(t *testing.T) {
+	admin := &models.User{Role: models.RoleAdmin, TOTPEnabled: true}
+	barista := &models.User{Role: models.RoleBarista}
+
+	assert.Equal(t, models.RoleAdmin, grantedRole(admin, false, false))
+	assert.Equal(t, models.RoleAdmin, grantedRole(admin, true, true))
+	// tokens issued before two-factor authentication was disabled
+	assert.Equal(t, models.RoleUser, grantedRole(&models.User{Role: models.RoleAdmin}, true, true))
+	// tokens without a second factor and API keys
+	assert.Equal(t, models.RoleUser, grantedRole(admin, false, true))
+	assert.Equal(t, models.RoleBarista, grantedRole(barista, false, true))
+}
+
+func TestExpiredToken(t *testing.T) {
+	secret := []byte("secret")
+	user := &models.User{ID: uuid.New(), Role: models.RoleUser}
+
+	token, err := issueToken(secret, user, false, time.Hour)
+	assert.NoError(t, err)
+	_, err = parseToken(secret, token)
+	assert.NoError(t, err)
+
+	token, err = issueToken(secret, user, false, -time.Minute)
+	assert.NoError(t, err)
+	_, err = parseToken(secret, token)
+	assert.Equal(t, errInvalidToken, err)
+}
+
+func TestRateLimitKey(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:4321"
+	assert.Equal(t, "ip:10.0.0.1", RateLimitKey(r))
+
+	userId := uuid.New()
+	withUser := r.WithContext(WithPrincipal(r.Context(), &Principal{UserId: userId, Role: models.RoleUser}))
+	assert.Equal(t, "user:"+userId.String(), RateLimitKey(withUser))
+
+	withAPIKey := r.WithContext(WithPrincipal(r.Context(), &Principal{UserId: userId, APIKeyId: 7}))
+	assert.Equal(t, "apikey:7", RateLimitKey(withAPIKey))
+}
+
+func TestAuthErrorCodes(t *testing.T) {
+	assert.Equal(t, utiltypes.CodeAccountDisabled, errDeactivatedAccount.apiError().Code)
+	assert.Equal(t, utiltypes.CodeInvalidToken, errInvalidToken.apiError().Code)
+	assert.Equal(t, utiltypes.CodeInvalidToken, errInvalidAPIKey.apiError().Code)
+	assert.Equal(t, http.StatusForbidden, errInvalidToken.apiError().Status)
+}
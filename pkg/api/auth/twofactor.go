@@ -0,0 +1,403 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/audit"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/authtypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/dbtx"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/totp"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// how long users have to enter their code after the password
+	challengeTokenTTL = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// issueChallengeToken creates a token that only proves the password was
+// correct, it can't be used to authenticate
+func issueChallengeToken(secret []byte, user *models.User) (string, error) {
+	tk := &models.Token{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(challengeTokenTTL).Unix(),
+		},
+		UserId:  user.ID,
+		Role:    user.Role,
+		Purpose: models.TokenPurposeTwoFactor,
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
+	return token.SignedString(secret)
+}
+
+// recovery codes are compared case insensitively and without dashes
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
+
+// generateRecoveryCodes returns codes formatted as xxxxx-xxxxx and their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// verifySecondFactor checks a TOTP code or uses up a recovery code, codes
+// can't be reused
+func (sr *authSubrouter) verifySecondFactor(tx *gorm.DB, user *models.User, request *authtypes.TwoFactorCodeRequest) (bool, error) {
+	if request.Code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, request.Code, time.Now())
+		if !ok || step <= user.TOTPLastStep {
+			return false, nil
+		}
+		user.TOTPLastStep = step
+		return true, sr.userRepository.UpdateUser(tx, user)
+	}
+
+	if request.RecoveryCode != "" {
+		return sr.userRepository.UseRecoveryCode(tx, user.ID.String(), hashRecoveryCode(request.RecoveryCode))
+	}
+
+	return false, nil
+}
+
+// principalUser loads the user behind the request, API keys can't manage
+// two-factor authentication
+func (sr *authSubrouter) principalUser(tx *gorm.DB, r *http.Request) (*models.User, error) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok || principal.IsAPIKey() || !principal.HasUser() {
+		return nil, errInvalidToken
+	}
+	return activeUser(tx, sr.userRepository, principal.UserId.String())
+}
+
+func (sr *authSubrouter) TwoFactorEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "TwoFactorEnrollHandler",
+		"method":  r.Method,
+	})
+
+	tx := sr.Db.Begin()
+	user, err := sr.principalUser(tx, r)
+	if err != nil {
+		tx.Rollback()
+		if _, ok := err.(authError); ok {
+			util.RespondError(w, util.Forbidden("Forbidden"))
+			return
+		}
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	if user.TOTPEnabled {
+		tx.Rollback()
+		util.RespondError(w, util.Conflict("Two-factor authentication is already enabled"))
+		return
+	}
+
+	// enrolling again replaces a secret that was never confirmed
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error generating secret")
+		util.RespondError(w, err)
+		return
+	}
+	user.TOTPSecret = secret
+
+	if err := sr.userRepository.UpdateUser(tx, user); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusOK, &authtypes.TwoFactorEnrollResponse{
+		Message:         "Scan the provisioning uri and confirm with a code",
+		Secret:          secret,
+		ProvisioningUri: totp.ProvisioningURI(sr.totpIssuer, user.Email, secret),
+	})
+}
+
+func (sr *authSubrouter) TwoFactorConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "TwoFactorConfirmHandler",
+		"method":  r.Method,
+	})
+
+	var reqData authtypes.TwoFactorConfirmRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
+		util.RespondError(w, err)
+		return
+	}
+
+	tx := sr.Db.Begin()
+	user, err := sr.principalUser(tx, r)
+	if err != nil {
+		tx.Rollback()
+		if _, ok := err.(authError); ok {
+			util.RespondError(w, util.Forbidden("Forbidden"))
+			return
+		}
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	if user.TOTPEnabled {
+		tx.Rollback()
+		util.RespondError(w, util.Conflict("Two-factor authentication is already enabled"))
+		return
+	}
+	if user.TOTPSecret == "" {
+		tx.Rollback()
+		util.RespondError(w, util.BadRequest("Enroll before confirming"))
+		return
+	}
+
+	// recovery codes don't exist yet, only the code proves the app is set up
+	verified, err := sr.verifySecondFactor(tx, user, &authtypes.TwoFactorCodeRequest{Code: reqData.Code})
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if !verified {
+		tx.Rollback()
+		util.RespondError(w, util.Unauthorized("Invalid code"))
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error generating recovery codes")
+		util.RespondError(w, err)
+		return
+	}
+
+	before := *user
+	user.TOTPEnabled = true
+	if err := sr.userRepository.UpdateUser(tx, user); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.userRepository.ReplaceRecoveryCodes(tx, user.ID, hashes); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditUser2FAEnable,
+		EntityType: models.AuditEntityUser,
+		EntityId:   user.ID.String(),
+		Before:     &before,
+		After:      user,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusOK, &authtypes.RecoveryCodesResponse{
+		Message:       "Two-factor authentication enabled, store the recovery codes somewhere safe",
+		RecoveryCodes: codes,
+	})
+}
+
+func (sr *authSubrouter) TwoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "TwoFactorDisableHandler",
+		"method":  r.Method,
+	})
+
+	var reqData authtypes.TwoFactorCodeRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
+		util.RespondError(w, err)
+		return
+	}
+
+	tx := sr.Db.Begin()
+	user, err := sr.principalUser(tx, r)
+	if err != nil {
+		tx.Rollback()
+		if _, ok := err.(authError); ok {
+			util.RespondError(w, util.Forbidden("Forbidden"))
+			return
+		}
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		tx.Rollback()
+		util.RespondError(w, util.Conflict("Two-factor authentication is not enabled"))
+		return
+	}
+
+	verified, err := sr.verifySecondFactor(tx, user, &reqData)
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if !verified {
+		tx.Rollback()
+		util.RespondError(w, util.Unauthorized("Invalid code"))
+		return
+	}
+
+	before := *user
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	if err := sr.userRepository.UpdateUser(tx, user); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.userRepository.DeleteRecoveryCodes(tx, user.ID.String()); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditUser2FADisable,
+		EntityType: models.AuditEntityUser,
+		EntityId:   user.ID.String(),
+		Before:     &before,
+		After:      user,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusOK, util.Message("Two-factor authentication disabled"))
+}
+
+func (sr *authSubrouter) TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "TwoFactorLoginHandler",
+		"method":  r.Method,
+	})
+
+	var reqData authtypes.TwoFactorLoginRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
+		util.RespondError(w, err)
+		return
+	}
+
+	tk, err := parseToken(sr.tokenSecret, reqData.ChallengeToken)
+	if err != nil || tk.Purpose != models.TokenPurposeTwoFactor {
+		util.RespondError(w, util.Unauthorized("Invalid or expired challenge token"))
+		return
+	}
+
+	tx := sr.Db.Begin()
+	user, err := activeUser(tx, sr.userRepository, tk.UserId.String())
+	if err != nil {
+		tx.Rollback()
+		if authErr, ok := err.(authError); ok {
+			util.RespondError(w, authErr.apiError())
+			return
+		}
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		tx.Rollback()
+		util.RespondError(w, util.BadRequest("Two-factor authentication is not enabled"))
+		return
+	}
+
+	// wrong codes count towards the same lockout as wrong passwords
+	if retryAfter := sr.loginLimiter.RetryAfter(util.ClientIP(r), user.Email); retryAfter > 0 {
+		tx.Rollback()
+		respondTooManyAttempts(w, retryAfter)
+		return
+	}
+
+	verified, err := sr.verifySecondFactor(tx, user, &authtypes.TwoFactorCodeRequest{
+		Code:         reqData.Code,
+		RecoveryCode: reqData.RecoveryCode,
+	})
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if !verified {
+		tx.Rollback()
+		logger.Warnf("Invalid second factor for user %s", user.ID)
+		sr.recordLoginFailure(r, user.Email)
+		util.RespondError(w, util.Unauthorized("Invalid code"))
+		return
+	}
+
+	remainingRecoveryCodes, err := sr.userRepository.CountUnusedRecoveryCodes(tx, user.ID.String())
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+	sr.loginLimiter.Succeeded(user.Email)
+
+	tokenString, err := issueToken(sr.tokenSecret, user, true, sr.tokenTTL)
+	if err != nil {
+		util.RespondError(w, util.InternalError())
+		return
+	}
+
+	util.Respond(w, http.StatusOK, &authtypes.TwoFactorLoginResponse{
+		Message:                fmt.Sprintf("Logged In as %s", user.FirstName),
+		Token:                  tokenString,
+		UserId:                 user.ID,
+		MustChangePassword:     user.MustChangePassword,
+		RemainingRecoveryCodes: remainingRecoveryCodes,
+	})
+}
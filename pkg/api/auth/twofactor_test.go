@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+	require.Len(t, hashes, recoveryCodeCount)
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		assert.Regexp(t, "^[0-9a-f]{5}-[0-9a-f]{5}$", code)
+		assert.Equal(t, hashRecoveryCode(code), hashes[i])
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	hash := hashRecoveryCode("abcde-12345")
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, hashRecoveryCode(" ABCDE12345 "))
+	assert.NotEqual(t, hash, hashRecoveryCode("abcde-12346"))
+}
+
+func TestChallengeTokenCannotAuthenticate(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Role: models.RoleAdmin}
+	challengeToken, err := issueChallengeToken(testSecret, user)
+	require.NoError(t, err)
+
+	tk, err := parseToken(testSecret, challengeToken)
+	require.NoError(t, err)
+	assert.Equal(t, models.TokenPurposeTwoFactor, tk.Purpose)
+	assert.Equal(t, user.ID, tk.UserId)
+
+	// rejected before the user is looked up
+	_, err = principalFromToken(nil, nil, testSecret, challengeToken, false)
+	assert.Equal(t, errInvalidToken, err)
+}
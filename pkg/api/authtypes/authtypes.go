@@ -0,0 +1,85 @@
+// Package authtypes holds the request and response bodies of the /auth
+// routes. They live outside of the auth package so clients like pkg/client
+// can use them.
+package authtypes
+
+import "github.com/google/uuid"
+
+type LoginRequest struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type RegisterRequest struct {
+	FirstName   string  `json:"firstName" validate:"notblank,max=255"`
+	LastName    string  `json:"lastName" validate:"notblank,max=255"`
+	Email       string  `json:"email" validate:"required,email,max=320"`
+	Password    string  `json:"password" validate:"min=8,max=72"`
+	PhoneNumber *string `json:"phoneNumber" validate:"omitempty,max=9"`
+}
+
+type LoginResponse struct {
+	Message                     string    `json:"message"`
+	Token                       string    `json:"token"`
+	UserId                      uuid.UUID `json:"userId"`
+	MustChangePassword          bool      `json:"mustChangePassword"`
+	TwoFactorEnrollmentRequired bool      `json:"twoFactorEnrollmentRequired"`
+}
+
+// TwoFactorChallengeResponse is returned instead of a LoginResponse to users
+// with two-factor authentication, the challenge token is exchanged at
+// /auth/login/2fa
+type TwoFactorChallengeResponse struct {
+	Message           string `json:"message"`
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+type RegisterResponse struct {
+	Message string    `json:"message"`
+	Token   string    `json:"token"`
+	UserId  uuid.UUID `json:"userId"`
+}
+
+// UpdateUserRequest only changes the fields that are set
+type UpdateUserRequest struct {
+	FirstName   string  `json:"firstName" validate:"omitempty,notblank,max=255"`
+	LastName    string  `json:"lastName" validate:"omitempty,notblank,max=255"`
+	Email       string  `json:"email" validate:"omitempty,email,max=320"`
+	Password    string  `json:"password" validate:"omitempty,min=8,max=72"`
+	PhoneNumber *string `json:"phoneNumber" validate:"omitempty,max=9"`
+}
+
+type TwoFactorConfirmRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recoveryCode" validate:"required_without=Code"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Message         string `json:"message"`
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioningUri"`
+}
+
+type RecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type TwoFactorLoginResponse struct {
+	Message                string    `json:"message"`
+	Token                  string    `json:"token"`
+	UserId                 uuid.UUID `json:"userId"`
+	MustChangePassword     bool      `json:"mustChangePassword"`
+	RemainingRecoveryCodes int       `json:"remainingRecoveryCodes"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recoveryCode" validate:"required_without=Code"`
+}
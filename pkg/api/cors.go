@@ -0,0 +1,170 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// headers browsers may always send, they don't have to be allowed
+var safelistedHeaders = []string{"Accept", "Accept-Language", "Content-Language"}
+
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	// wildcards match subdomains, "https://*.example.com" is kept as the
+	// prefix "https://" and suffix ".example.com"
+	wildcards []originWildcard
+
+	methods       map[string]bool
+	allowMethods  string
+	headers       map[string]bool
+	allowHeaders  string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+type originWildcard struct {
+	prefix string
+	suffix string
+}
+
+// CORS answers browser preflight requests and adds the CORS headers to the
+// responses of next for the origins allowed by cfg. It has to wrap the
+// router, preflight requests don't match any route.
+func CORS(cfg config.CORS) func(http.Handler) http.Handler {
+	policy := &corsPolicy{
+		origins:       map[string]bool{},
+		methods:       map[string]bool{},
+		headers:       map[string]bool{},
+		allowMethods:  strings.Join(cfg.AllowedMethods, ", "),
+		allowHeaders:  strings.Join(cfg.AllowedHeaders, ", "),
+		exposeHeaders: strings.Join(cfg.ExposedHeaders, ", "),
+		credentials:   cfg.AllowCredentials,
+		maxAge:        strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			policy.anyOrigin = true
+		} else if i := strings.Index(origin, "://*."); i >= 0 {
+			policy.wildcards = append(policy.wildcards, originWildcard{
+				prefix: origin[:i+len("://")],
+				suffix: origin[i+len("://*"):],
+			})
+		} else {
+			policy.origins[origin] = true
+		}
+	}
+	for _, method := range cfg.AllowedMethods {
+		policy.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range cfg.AllowedHeaders {
+		policy.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, header := range safelistedHeaders {
+		policy.headers[header] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy.serveHTTP(w, r, next)
+		})
+	}
+}
+
+func (p *corsPolicy) serveHTTP(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	// responses depend on the origin, caches must not share them
+	w.Header().Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+	if !p.originAllowed(origin) {
+		if preflight {
+			log.WithField("origin", origin).Debug("Preflight from disallowed origin")
+			util.RespondError(w, util.Forbidden("Origin not allowed"))
+			return
+		}
+		// the browser blocks the response without CORS headers
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if p.anyOrigin && !p.credentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if p.exposeHeaders != "" {
+			w.Header().Set("Access-Control-Expose-Headers", p.exposeHeaders)
+		}
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+	if !p.preflightAllowed(r) {
+		w.Header().Del("Access-Control-Allow-Origin")
+		w.Header().Del("Access-Control-Allow-Credentials")
+		util.RespondError(w, util.Forbidden("Method or headers not allowed"))
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", p.allowMethods)
+	if p.allowHeaders != "" {
+		w.Header().Set("Access-Control-Allow-Headers", p.allowHeaders)
+	}
+	if p.maxAge != "0" {
+		w.Header().Set("Access-Control-Max-Age", p.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *corsPolicy) originAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.anyOrigin || p.origins[origin] {
+		return true
+	}
+	for _, wildcard := range p.wildcards {
+		if len(origin) <= len(wildcard.prefix)+len(wildcard.suffix) ||
+			!strings.HasPrefix(origin, wildcard.prefix) || !strings.HasSuffix(origin, wildcard.suffix) {
+			continue
+		}
+		// the subdomain can't reach into the scheme, port or a path
+		subdomain := origin[len(wildcard.prefix) : len(origin)-len(wildcard.suffix)]
+		if !strings.ContainsAny(subdomain, "/:@") {
+			return true
+		}
+	}
+	return false
+}
+
+// preflightAllowed checks the method and headers the browser wants to send
+func (p *corsPolicy) preflightAllowed(r *http.Request) bool {
+	if !p.methods[r.Header.Get("Access-Control-Request-Method")] {
+		return false
+	}
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !p.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
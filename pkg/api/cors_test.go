@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pathVariable = regexp.MustCompile(`{[^}]+}`)
+
+func preflight(path, origin, method, headers string) *http.Request {
+	r := httptest.NewRequest("OPTIONS", path, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return r
+}
+
+// TestPreflightEveryRoute makes sure browsers can call every route with the
+// headers the client sends, with the default config
+func TestPreflightEveryRoute(t *testing.T) {
+	cfg := testConfig()
+	router := newTestRouter(t, cfg)
+	handler := CORS(cfg.CORS)(router)
+
+	operations := routeOperations(t, router)
+	require.NotEmpty(t, operations)
+	for _, operation := range operations {
+		parts := strings.SplitN(operation, " ", 2)
+		method, path := parts[0], pathVariable.ReplaceAllString(parts[1], "1")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, preflight(path, "http://localhost:3000", method, "authorization,content-type,x-api-key"))
+
+		assert.Equal(t, http.StatusNoContent, w.Code, operation)
+		assert.Equal(t, "http://localhost:3000", w.Header().Get("Access-Control-Allow-Origin"), operation)
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), method, operation)
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Authorization", operation)
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"), operation)
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	cfg := testConfig().CORS
+	cfg.AllowedOrigins = []string{"https://coffee.example.com", "https://*.shop.example.com"}
+	handler := CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for origin, allowed := range map[string]bool{
+		"https://coffee.example.com":          true,
+		"https://COFFEE.example.com":          true,
+		"https://a.shop.example.com":          true,
+		"https://a.b.shop.example.com":        true,
+		"https://shop.example.com":            false,
+		"https://evilshop.example.com":        false,
+		"http://a.shop.example.com":           false,
+		"https://a.shop.example.com.evil":     false,
+		"https://x.com/.shop.example.com":     false,
+		"https://coffee.example.com:8443":     false,
+		"https://evil.com:a.shop.example.com": false,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, preflight("/menu", origin, "GET", ""))
+		if allowed {
+			assert.Equal(t, http.StatusNoContent, w.Code, origin)
+			assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		} else {
+			assert.Equal(t, http.StatusForbidden, w.Code, origin)
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		}
+		assert.Contains(t, w.Header()["Vary"], "Origin", origin)
+	}
+}
+
+func TestCORSPreflightRejected(t *testing.T) {
+	cfg := testConfig().CORS
+	cfg.AllowedMethods = []string{"GET"}
+	handler := CORS(cfg)(http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, preflight("/menu", "http://localhost:3000", "DELETE", ""))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, preflight("/menu", "http://localhost:3000", "GET", "X-Secret"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// safelisted headers don't have to be allowed
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, preflight("/menu", "http://localhost:3000", "GET", "Accept, Accept-Language"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestCORSRequests(t *testing.T) {
+	cfg := testConfig().CORS
+	cfg.AllowCredentials = true
+	handler := CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest("GET", "/menu", nil)
+	r.Header.Set("Origin", "http://localhost:3000")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "http://localhost:3000", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "Retry-After")
+
+	// other origins are still served, browsers block the response
+	r.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// any origin without credentials
+	cfg.AllowedOrigins = []string{"*"}
+	cfg.AllowCredentials = false
+	w = httptest.NewRecorder()
+	CORS(cfg)(http.NotFoundHandler()).ServeHTTP(w, r)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// apiVersion is reported in the OpenAPI spec
+const apiVersion = "1.0.0"
+
+const specPath = "/openapi.json"
+
+var swaggerUI = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<title>{{.Title}}</title>
+	<meta charset="utf-8">
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@3/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@3/swagger-ui-bundle.js"></script>
+	<script>
+		SwaggerUIBundle({url: "{{.SpecPath}}", dom_id: "#swagger-ui"})
+	</script>
+</body>
+</html>
+`))
+
+// setupDocs serves the spec at /openapi.json, and Swagger UI at /docs when
+// enabled is set
+func setupDocs(router *mux.Router, spec *openapi.Spec, enabled bool) {
+	spec.Describe(router.Handle(specPath, spec.Handler()).Methods("GET"), openapi.Route{
+		Summary:  "This OpenAPI document",
+		Response: map[string]interface{}{},
+	})
+
+	if !enabled {
+		return
+	}
+
+	docs := router.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := swaggerUI.Execute(w, map[string]string{
+			"Title":    "Dollar Coffee API",
+			"SpecPath": specPath,
+		})
+		if err != nil {
+			log.WithError(err).Warn()
+		}
+	}).Methods("GET")
+	spec.Describe(docs, openapi.Route{
+		Summary:      "Swagger UI for this OpenAPI document",
+		ContentTypes: []string{"text/html"},
+	})
+}
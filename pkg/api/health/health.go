@@ -0,0 +1,169 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/healthtypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/metrics"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+	"github.com/go-redis/redis/v7"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkTimeout bounds each dependency check so /readyz answers even when a
+// dependency hangs
+var checkTimeout = 2 * time.Second
+
+// Check pings a dependency. Servers aren't ready while a required dependency
+// is down, optional ones only degrade them.
+type Check struct {
+	Name     string
+	Required bool
+	// Ping is nil for dependencies that aren't configured
+	Ping func(ctx context.Context) error
+}
+
+// DatabaseCheck is required, nothing works without postgres
+func DatabaseCheck(db *gorm.DB) Check {
+	return Check{
+		Name:     "postgres",
+		Required: true,
+		Ping: func(ctx context.Context) error {
+			return db.DB().PingContext(ctx)
+		},
+	}
+}
+
+// RedisCheck is optional, the menu is read from the database and rate limits
+// are kept in memory while redis is down
+func RedisCheck(client *redis.Client) Check {
+	check := Check{Name: "redis"}
+	if client != nil {
+		check.Ping = func(ctx context.Context) error {
+			return client.WithContext(ctx).Ping().Err()
+		}
+	}
+	return check
+}
+
+type healthSubrouter struct {
+	util.CommonSubrouter
+
+	checks []Check
+}
+
+// Setup adds the liveness and readiness routes. They aren't rate limited or
+// authenticated, they're meant for load balancers inside the deployment.
+// Metrics are served on their own port, see MetricsHandler.
+func Setup(router *mux.Router, spec *openapi.Spec, checks ...Check) error {
+	if router == nil || spec == nil {
+		err := errors.New("router or spec is nil")
+		log.WithError(err).Warn()
+		return err
+	}
+
+	health := healthSubrouter{checks: checks}
+	health.Router = router
+
+	spec.Describe(health.Router.HandleFunc("/healthz", health.LivenessHandler).Methods("GET"), openapi.Route{
+		Summary:     "Check that the server is running",
+		Description: "Doesn't check dependencies, see /readyz.",
+		Response:    healthtypes.HealthResponse{},
+	})
+	spec.Describe(health.Router.HandleFunc("/readyz", health.ReadinessHandler).Methods("GET"), openapi.Route{
+		Summary:     "Check that the server can handle requests",
+		Description: "Pings every dependency, responds with 503 while a required one is down.",
+		Response:    healthtypes.ReadinessResponse{},
+	})
+	return nil
+}
+
+// MetricsHandler serves /metrics for the metrics listener, it's kept off the
+// API router since route names, database timings and purchase counts
+// shouldn't be public
+func MetricsHandler() http.Handler {
+	router := mux.NewRouter()
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	return router
+}
+
+func (sr *healthSubrouter) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	util.Respond(w, http.StatusOK, healthtypes.HealthResponse{Status: healthtypes.StatusOK})
+}
+
+func (sr *healthSubrouter) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "ReadinessHandler",
+		"method":  r.Method,
+	})
+
+	response := healthtypes.ReadinessResponse{
+		Status: healthtypes.StatusOK,
+		Checks: make(map[string]*healthtypes.CheckResponse, len(sr.checks)),
+	}
+
+	// checks run concurrently so a slow dependency doesn't delay the others
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range sr.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			// errors are only logged, they can contain addresses of the
+			// infrastructure
+			result, err := runCheck(r.Context(), check)
+			if err != nil {
+				logger.WithError(err).WithField("dependency", check.Name).Warn("Dependency is down")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[check.Name] = result
+		}(check)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, result := range response.Checks {
+		if result.Status != healthtypes.StatusDown {
+			continue
+		}
+		if result.Required {
+			response.Status = healthtypes.StatusDown
+			status = http.StatusServiceUnavailable
+		} else if response.Status == healthtypes.StatusOK {
+			response.Status = healthtypes.StatusDegraded
+		}
+	}
+
+	util.Respond(w, status, response)
+}
+
+func runCheck(ctx context.Context, check Check) (*healthtypes.CheckResponse, error) {
+	result := &healthtypes.CheckResponse{
+		Status:   healthtypes.StatusOK,
+		Required: check.Required,
+	}
+	if check.Ping == nil {
+		result.Status = healthtypes.StatusDisabled
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Ping(ctx)
+	result.Latency = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Status = healthtypes.StatusDown
+	}
+	return result, err
+}
@@ -0,0 +1,114 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/healthtypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ping(err error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return err
+	}
+}
+
+func readiness(t *testing.T, checks ...Check) (int, *healthtypes.ReadinessResponse) {
+	router := mux.NewRouter()
+	require.NoError(t, Setup(router, openapi.New(openapi.Info{}, utiltypes.APIError{}, nil), checks...))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	var response healthtypes.ReadinessResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return w.Code, &response
+}
+
+func TestLiveness(t *testing.T) {
+	router := mux.NewRouter()
+	require.NoError(t, Setup(router, openapi.New(openapi.Info{}, utiltypes.APIError{}, nil)))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, w.Body.String())
+}
+
+func TestMetricsArentPublic(t *testing.T) {
+	router := mux.NewRouter()
+	require.NoError(t, Setup(router, openapi.New(openapi.Info{}, utiltypes.APIError{}, nil)))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestReadiness(t *testing.T) {
+	down := errors.New("connection refused")
+
+	status, response := readiness(t,
+		Check{Name: "postgres", Required: true, Ping: ping(nil)},
+		Check{Name: "redis", Ping: ping(nil)},
+	)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, healthtypes.StatusOK, response.Status)
+	assert.Equal(t, healthtypes.StatusOK, response.Checks["postgres"].Status)
+	assert.Equal(t, healthtypes.StatusOK, response.Checks["redis"].Status)
+
+	// the server works without redis
+	status, response = readiness(t,
+		Check{Name: "postgres", Required: true, Ping: ping(nil)},
+		Check{Name: "redis", Ping: ping(down)},
+	)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, healthtypes.StatusDegraded, response.Status)
+	assert.Equal(t, healthtypes.StatusDown, response.Checks["redis"].Status)
+
+	status, response = readiness(t,
+		Check{Name: "postgres", Required: true, Ping: ping(down)},
+		Check{Name: "redis", Ping: ping(down)},
+	)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, healthtypes.StatusDown, response.Status)
+	assert.Equal(t, healthtypes.StatusDown, response.Checks["postgres"].Status)
+
+	status, response = readiness(t,
+		Check{Name: "postgres", Required: true, Ping: ping(nil)},
+		RedisCheck(nil),
+	)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, healthtypes.StatusOK, response.Status)
+	assert.Equal(t, healthtypes.StatusDisabled, response.Checks["redis"].Status)
+}
+
+func TestReadinessTimeout(t *testing.T) {
+	defaultCheckTimeout := checkTimeout
+	defer func() { checkTimeout = defaultCheckTimeout }()
+	checkTimeout = 10 * time.Millisecond
+
+	status, response := readiness(t, Check{
+		Name:     "postgres",
+		Required: true,
+		Ping: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, healthtypes.StatusDown, response.Checks["postgres"].Status)
+}
@@ -0,0 +1,28 @@
+// Package healthtypes holds the response bodies of the health routes. They
+// live outside of the health package so clients like pkg/client can use them
+// without depending on the checks.
+package healthtypes
+
+const (
+	StatusOK       = "ok"
+	StatusDown     = "down"
+	StatusDisabled = "disabled"
+	// StatusDegraded means optional dependencies are down
+	StatusDegraded = "degraded"
+)
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type CheckResponse struct {
+	Status   string `json:"status"`
+	Required bool   `json:"required"`
+	// Latency of the ping in milliseconds
+	Latency float64 `json:"latencyMs,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status string                    `json:"status"`
+	Checks map[string]*CheckResponse `json:"checks"`
+}
@@ -1,18 +1,31 @@
 package internal
 
 import (
-	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/audit"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/auth"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/internaltypes"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/dbtx"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/ratelimit"
 	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const pageSize = 10
@@ -23,34 +36,29 @@ type internalSubrouter struct {
 	coffeeRepository   repository_interfaces.CoffeeRepository
 	purchaseRepository repository_interfaces.TransactionsRepository
 	userRepository     repository_interfaces.UserRepository
-}
-
-type UpdateCoffeeRequest struct {
-	Name        *string  `json:"name"`
-	Description *string  `json:"description"`
-	Price       *float64 `json:"price"`
-	InStock     *bool    `json:"inStock"`
-}
-
-type PurchaseUpdateRequest struct {
-	AmountPaid float64 `json:"amountPaid"`
-}
-
-type UpdateRoleRequest struct {
-	Role string `json:"role"`
+	apiKeyRepository   repository_interfaces.APIKeyRepository
+	auditRepository    repository_interfaces.AuditRepository
+	auditRecorder      *audit.Recorder
+	spec               *openapi.Spec
+	// largest page size clients can request
+	maxPageSize int
 }
 
 // This route is for internal uses only to update/get coffee, purchases etc
 
 const prefix = "/internal"
 
-func Setup(router *mux.Router, db *gorm.DB,
+func Setup(router *mux.Router, db *gorm.DB, authMiddleware mux.MiddlewareFunc, rateLimiter *ratelimit.Limiter, spec *openapi.Spec,
 	coffeeRepository repository_interfaces.CoffeeRepository,
 	purchaseRepository repository_interfaces.TransactionsRepository,
 	userRepository repository_interfaces.UserRepository,
+	apiKeyRepository repository_interfaces.APIKeyRepository,
+	auditRepository repository_interfaces.AuditRepository,
+	auditRecorder *audit.Recorder,
+	maxPageSize int,
 ) error {
-	if db == nil || router == nil {
-		err := errors.New("db or router is nil")
+	if db == nil || router == nil || authMiddleware == nil || rateLimiter == nil || spec == nil || auditRecorder == nil {
+		err := errors.New("a required setup argument is nil")
 		log.WithError(err).Warn()
 		return err
 	}
@@ -59,35 +67,174 @@ func Setup(router *mux.Router, db *gorm.DB,
 		coffeeRepository:   coffeeRepository,
 		userRepository:     userRepository,
 		purchaseRepository: purchaseRepository,
+		apiKeyRepository:   apiKeyRepository,
+		auditRepository:    auditRepository,
+		auditRecorder:      auditRecorder,
+		spec:               spec,
+		maxPageSize:        maxPageSize,
 	}
 	internal.Router = router.
 		PathPrefix(prefix).
 		Subrouter()
 
 	internal.Db = db
-	internal.Router.Use(util.AuthMiddleware)
+	internal.Router.Use(authMiddleware)
+	internal.Router.Use(rateLimiter.Middleware("internal", ratelimit.PerMinute(300)))
 
-	// Route to update and delete any coffees
-	internal.Router.HandleFunc("/coffee", internal.coffeeHandler).Methods("POST")
+	// Each route declares the permission it needs, see models.RoleHasPermission
 
-	// used to delete coffees from the menu
-	internal.Router.HandleFunc("/coffee/{coffeeId}", internal.updateCoffeeHandler).Methods("PATCH", "DELETE")
+	// Route to create coffees
+	internal.handle("POST", "/coffee", models.PermissionMenuEdit, internal.coffeeHandler, openapi.Route{
+		Summary:  "Add a coffee to the menu",
+		Request:  internaltypes.CreateCoffeeRequest{},
+		Response: utiltypes.MessageResponse{},
+	})
+
+	// Routes to update and delete any coffees
+	internal.handle("PATCH", "/coffee/{coffeeId}", models.PermissionMenuEdit, internal.updateCoffeeHandler, openapi.Route{
+		Summary:     "Update a coffee",
+		Description: "Setting stock also sets inStock.",
+		Request:     internaltypes.UpdateCoffeeRequest{},
+		Response:    utiltypes.MessageResponse{},
+	})
+	internal.handle("DELETE", "/coffee/{coffeeId}", models.PermissionMenuEdit, internal.updateCoffeeHandler, openapi.Route{
+		Summary:  "Remove a coffee from the menu",
+		Response: utiltypes.MessageResponse{},
+	})
 
 	// Route to update amount paid on purchases
 	// Requires param: "amountPaid" in body
-	internal.Router.HandleFunc("/purchase/{purchaseId}", internal.purchaseHandler).Methods("PATCH")
+	internal.handle("PATCH", "/purchase/{purchaseId}", models.PermissionPaymentsRecord, internal.purchaseHandler, openapi.Route{
+		Summary:     "Record how much was paid for a purchase",
+		Description: "The difference to the previous amount is recorded as a payment.",
+		Request:     internaltypes.PurchaseUpdateRequest{},
+		Response:    utiltypes.MessageResponse{},
+	})
+
+	// Route to advance an order to preparing, ready or completed
+	// Requires param: "status" in body
+	internal.handle("PATCH", "/purchase/{purchaseId}/status", models.PermissionOrdersUpdate, internal.purchaseStatusHandler, openapi.Route{
+		Summary:     "Advance an order to preparing, ready or completed",
+		Description: "Orders can't go back to an earlier status, use the cancel route to cancel them.",
+		Request:     internaltypes.PurchaseStatusRequest{},
+		Response:    utiltypes.MessageResponse{},
+	})
+
+	// Route to list all purchases, see purchasesHandler for filters
+	internal.handle("GET", "/purchases", models.PermissionOrdersRead, internal.purchasesHandler, openapi.Route{
+		Summary: "List all purchases",
+		Query: append(util.PageParameters(),
+			openapi.Query("user_id", "string", "Only purchases of this user"),
+			openapi.Query("from", "string", "Only purchases on or after this date, YYYY-MM-DD or RFC 3339"),
+			openapi.Query("to", "string", "Only purchases on or before this date, YYYY-MM-DD or RFC 3339"),
+			openapi.Query("status", "string", "Only purchases with this status"),
+			openapi.Query("payment_status", "string", "paid, unpaid or partial"),
+			openapi.Query("coffee_id", "integer", "Only purchases containing this coffee"),
+			openapi.Query("min_total", "number", "Only purchases with at least this total"),
+			openapi.Query("sort", "string", "Column to sort by"),
+			openapi.Query("direction", "string", "ASC or DESC"),
+		),
+		Response: util.ListOf([]*internaltypes.PurchaseResponse{}),
+	})
+
+	// Route to cancel any purchase, refunding payments and restoring stock
+	// Requires param: "reason" in body
+	internal.handle("POST", "/purchase/{purchaseId}/cancel", models.PermissionOrdersCancel, internal.cancelPurchaseHandler, openapi.Route{
+		Summary:     "Cancel a purchase",
+		Description: "Payments are refunded and stock is restored.",
+		Request:     internaltypes.CancelPurchaseRequest{},
+		Response:    utiltypes.MessageResponse{},
+	})
 
 	// Route to get information from all users
-	internal.Router.HandleFunc("/users", internal.usersHandler).Methods("GET")
+	// Optional params: "role" and "search" (name or email prefix)
+	internal.handle("GET", "/users", models.PermissionUsersRead, internal.usersHandler, openapi.Route{
+		Summary: "List users",
+		Query: append(util.PageParameters(),
+			openapi.Query("role", "string", "Only users with this role"),
+			openapi.Query("search", "string", "Prefix of the name or email"),
+		),
+		Response: util.ListOf([]*models.User{}),
+	})
+
+	// Route to create a user with a temporary password
+	internal.handle("POST", "/users", models.PermissionUsersManage, internal.createUserHandler, openapi.Route{
+		Summary:     "Create a user with a temporary password",
+		Description: "The user has to change the password after logging in.",
+		Request:     internaltypes.CreateUserRequest{},
+		Status:      http.StatusCreated,
+		Response:    internaltypes.CreateUserResponse{},
+	})
+
+	// Route to soft delete a user, blocked while the user has outstanding
+	// purchases unless "force=true" is passed
+	internal.handle("DELETE", "/users/{userId}", models.PermissionUsersManage, internal.deleteUserHandler, openapi.Route{
+		Summary: "Delete a user",
+		Query: []*openapi.Parameter{
+			openapi.Query("force", "boolean", "Delete users with unpaid purchases"),
+		},
+		Response: utiltypes.MessageResponse{},
+	})
+
+	// Routes to deactivate and reactivate user accounts
+	internal.handle("POST", "/users/{userId}/deactivate", models.PermissionUsersManage, internal.deactivateUserHandler, openapi.Route{
+		Summary:     "Deactivate a user",
+		Description: "Deactivated users can't log in and their tokens stop working.",
+		Response:    utiltypes.MessageResponse{},
+	})
+	internal.handle("POST", "/users/{userId}/reactivate", models.PermissionUsersManage, internal.reactivateUserHandler, openapi.Route{
+		Summary:  "Reactivate a user",
+		Response: utiltypes.MessageResponse{},
+	})
 
 	// Route to update user role information
-	internal.Router.HandleFunc("/users/{userId}/role", internal.updateUserRoleHandler).Methods("PATCH")
+	internal.handle("PATCH", "/users/{userId}/role", models.PermissionUsersManage, internal.updateUserRoleHandler, openapi.Route{
+		Summary:  "Change the role of a user",
+		Request:  internaltypes.UpdateRoleRequest{},
+		Response: utiltypes.MessageResponse{},
+	})
+
+	// Routes to list, create and revoke API keys for kiosks and integrations
+	// Creating requires params: "name" and "scopes" in body
+	internal.handle("GET", "/apikeys", models.PermissionAPIKeysManage, internal.apiKeysHandler, openapi.Route{
+		Summary:  "List API keys",
+		Response: internaltypes.APIKeysResponse{},
+	})
+	internal.handle("POST", "/apikeys", models.PermissionAPIKeysManage, internal.createAPIKeyHandler, openapi.Route{
+		Summary:     "Create an API key",
+		Description: "The key is only returned once.",
+		Request:     internaltypes.CreateAPIKeyRequest{},
+		Status:      http.StatusCreated,
+		Response:    internaltypes.CreateAPIKeyResponse{},
+	})
+	internal.handle("DELETE", "/apikeys/{apiKeyId:[0-9]+}", models.PermissionAPIKeysManage, internal.revokeAPIKeyHandler, openapi.Route{
+		Summary:  "Revoke an API key",
+		Response: utiltypes.MessageResponse{},
+	})
+
+	// Route to list audit events, newest first
+	// Optional params: "actor_id", "action", "entity_type", "entity_id", "from" and "to"
+	internal.handle("GET", "/audit", models.PermissionAuditRead, internal.auditHandler, openapi.Route{
+		Summary: "List audit events, newest first",
+		Query: append(util.PageParameters(),
+			openapi.Query("actor_id", "string", "Only events by this user"),
+			openapi.Query("action", "string", "Only events with this action, e.g. coffee.update"),
+			openapi.Query("entity_type", "string", "Only events for this type of entity"),
+			openapi.Query("entity_id", "string", "Only events for this entity, use with entity_type"),
+			openapi.Query("from", "string", "Only events on or after this date, YYYY-MM-DD or RFC 3339"),
+			openapi.Query("to", "string", "Only events on or before this date, YYYY-MM-DD or RFC 3339"),
+		),
+		Response: util.ListOf([]*models.AuditEvent{}),
+	})
 
 	return nil
 }
 
-func validateAdmin(ctx context.Context) bool {
-	return ctx.Value("role") == "admin"
+// handle registers and documents a route that requires permission
+func (sr *internalSubrouter) handle(method, path string, permission models.Permission, handler http.HandlerFunc, doc openapi.Route) {
+	route := sr.Router.Handle(path, auth.RequirePermission(permission)(handler)).Methods(method)
+	doc.Permission = string(permission)
+	sr.spec.Describe(route, doc)
 }
 
 func (sr *internalSubrouter) coffeeHandler(w http.ResponseWriter, r *http.Request) {
@@ -95,34 +242,41 @@ func (sr *internalSubrouter) coffeeHandler(w http.ResponseWriter, r *http.Reques
 		"request": "InternalCoffeeHandler",
 		"method":  r.Method,
 	})
-	if !validateAdmin(r.Context()) {
-		util.Respond(w, http.StatusForbidden, util.Message("Invalid role type"))
-		return
-	}
 
-	decoder := json.NewDecoder(r.Body)
-	var coffeeInfo models.Coffee
-	if err := decoder.Decode(&coffeeInfo); err != nil {
+	var reqData internaltypes.CreateCoffeeRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
 		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+		util.RespondError(w, err)
 		return
 	}
 
-	// Validate info
-	if len(coffeeInfo.Name) == 0 || coffeeInfo.Price == 0 {
-		logger.Warn("Invalid coffee attributes")
-		util.Respond(w, http.StatusBadRequest, util.Message("Invalid coffee attributes"))
-		return
+	coffeeInfo := models.Coffee{
+		Name:        reqData.Name,
+		Description: reqData.Description,
+		Price:       reqData.Price,
+		InStock:     reqData.InStock == nil || *reqData.InStock,
+		Stock:       reqData.Stock,
 	}
 
 	tx := sr.Db.Begin()
 	if err := sr.coffeeRepository.CreateCoffee(tx, &coffeeInfo); err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditCoffeeCreate,
+		EntityType: models.AuditEntityCoffee,
+		EntityId:   strconv.FormatUint(uint64(coffeeInfo.ID), 10),
+		After:      &coffeeInfo,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
 		return
 	}
-	tx.Commit()
+	dbtx.Commit(tx)
 
 	util.Respond(w, http.StatusOK, util.Message("Created new Coffee"))
 }
@@ -133,11 +287,6 @@ func (sr *internalSubrouter) updateCoffeeHandler(w http.ResponseWriter, r *http.
 		"method":  r.Method,
 	})
 
-	if !validateAdmin(r.Context()) {
-		util.Respond(w, http.StatusForbidden, util.Message("Invalid role type"))
-		return
-	}
-
 	vars := mux.Vars(r)
 	requestedCoffee := vars["coffeeId"]
 
@@ -146,26 +295,26 @@ func (sr *internalSubrouter) updateCoffeeHandler(w http.ResponseWriter, r *http.
 	if err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn("Database Error")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, err)
 		return
 	}
 
 	if _, doesCoffeeExist := coffeeMap[requestedCoffee]; !doesCoffeeExist {
 		tx.Rollback()
-		util.Respond(w, http.StatusNotFound, util.Message("Couldn't find coffee"))
+		util.RespondError(w, util.NotFound("Couldn't find coffee"))
 		return
 	}
 
 	coffee := coffeeMap[requestedCoffee]
+	before := *coffee
 
 	// Update coffee with new values
 	if r.Method == "PATCH" {
-		decoder := json.NewDecoder(r.Body)
-		var newCoffeeInfo UpdateCoffeeRequest
-		if err := decoder.Decode(&newCoffeeInfo); err != nil {
+		var newCoffeeInfo internaltypes.UpdateCoffeeRequest
+		if err := util.DecodeJSON(w, r, &newCoffeeInfo); err != nil {
 			tx.Rollback()
 			logger.WithError(err).Warn("Error decoding JSON")
-			util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+			util.RespondError(w, err)
 			return
 		}
 
@@ -182,14 +331,30 @@ func (sr *internalSubrouter) updateCoffeeHandler(w http.ResponseWriter, r *http.
 		if newCoffeeInfo.InStock != nil {
 			coffee.InStock = *newCoffeeInfo.InStock
 		}
+		if newCoffeeInfo.Stock != nil {
+			coffee.Stock = newCoffeeInfo.Stock
+			coffee.InStock = *newCoffeeInfo.Stock > 0
+		}
 
 		if err := sr.coffeeRepository.UpdateCoffee(tx, coffee); err != nil {
 			tx.Rollback()
 			logger.WithError(err).Warn("Error")
-			util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+			util.RespondError(w, err)
+			return
+		}
+		if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+			Action:     models.AuditCoffeeUpdate,
+			EntityType: models.AuditEntityCoffee,
+			EntityId:   requestedCoffee,
+			Before:     &before,
+			After:      coffee,
+		}); err != nil {
+			tx.Rollback()
+			logger.WithError(err).Warn("Error writing audit event")
+			util.RespondError(w, err)
 			return
 		}
-		tx.Commit()
+		dbtx.Commit(tx)
 		util.Respond(w, http.StatusOK, util.Message("Successfully updated coffee"))
 		return
 	}
@@ -199,10 +364,21 @@ func (sr *internalSubrouter) updateCoffeeHandler(w http.ResponseWriter, r *http.
 		if err := sr.coffeeRepository.DeleteCoffee(tx, requestedCoffee); err != nil {
 			tx.Rollback()
 			logger.WithError(err).Warn("Error")
-			util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+			util.RespondError(w, err)
 			return
 		}
-		tx.Commit()
+		if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+			Action:     models.AuditCoffeeDelete,
+			EntityType: models.AuditEntityCoffee,
+			EntityId:   requestedCoffee,
+			Before:     &before,
+		}); err != nil {
+			tx.Rollback()
+			logger.WithError(err).Warn("Error writing audit event")
+			util.RespondError(w, err)
+			return
+		}
+		dbtx.Commit(tx)
 		util.Respond(w, http.StatusOK, util.Message("Successfully deleted coffee"))
 		return
 	}
@@ -216,122 +392,399 @@ func (sr *internalSubrouter) purchaseHandler(w http.ResponseWriter, r *http.Requ
 		"method":  r.Method,
 	})
 
-	if !validateAdmin(r.Context()) {
-		util.Respond(w, http.StatusForbidden, util.Message("Invalid role type"))
-		return
-	}
 	vars := mux.Vars(r)
 	requestedPurchase := vars["purchaseId"]
 
-	var reqData PurchaseUpdateRequest
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&reqData); err != nil {
+	var reqData internaltypes.PurchaseUpdateRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
 		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+		util.RespondError(w, err)
 		return
 	}
 
 	tx := sr.Db.Begin()
-	transactionsMap, err := sr.purchaseRepository.GetTransactionsByIds(tx, []string{requestedPurchase})
+	transaction, err := sr.purchaseRepository.GetTransactionForUpdate(tx, requestedPurchase)
 	if err != nil {
 		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			util.RespondError(w, util.NotFound("Transaction not found"))
+			return
+		}
 		logger.WithError(err).Warn("Database Error")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, err)
 		return
 	}
 
-	var transaction *models.Transaction
-	var doesTxExist bool
-	if transaction, doesTxExist = transactionsMap[requestedPurchase]; !doesTxExist {
+	if transaction.IsCancelled() {
 		tx.Rollback()
-		logger.WithError(err).Warn("Database Error")
-		util.Respond(w, http.StatusNotFound, util.Message("Transaction not found"))
+		util.RespondError(w, util.Conflict("Transaction has been cancelled"))
+		return
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		tx.Rollback()
+		logger.Warn("Missing principal")
+		util.RespondError(w, util.InternalError())
 		return
 	}
 
+	before := *transaction
+
+	// keep a record of the payment so it can be refunded later, lowering the
+	// amount paid is recorded as a correction rather than a negative payment
+	if delta := reqData.AmountPaid - transaction.AmountPaid; delta != 0 {
+		payment := models.Payment{
+			TransactionId: transaction.ID,
+			Amount:        delta,
+			Kind:          models.PaymentKindPayment,
+			RecordedBy:    principal.UserId,
+		}
+		if delta < 0 {
+			payment.Amount = -delta
+			payment.Kind = models.PaymentKindCorrection
+		}
+		if err := sr.purchaseRepository.CreatePayment(tx, &payment); err != nil {
+			tx.Rollback()
+			logger.WithError(err).Warn("Database Error")
+			util.RespondError(w, err)
+			return
+		}
+	}
+
 	transaction.AmountPaid = reqData.AmountPaid
 
 	if err := sr.purchaseRepository.UpdateTransaction(tx, transaction); err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn("Database Error")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, err)
 		return
 	}
-	tx.Commit()
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditPurchasePayment,
+		EntityType: models.AuditEntityPurchase,
+		EntityId:   requestedPurchase,
+		Before:     &before,
+		After:      transaction,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
 
 	util.Respond(w, http.StatusOK, util.Message("Successfully updated purchase"))
 }
 
-func (sr *internalSubrouter) usersHandler(w http.ResponseWriter, r *http.Request) {
+func (sr *internalSubrouter) purchaseStatusHandler(w http.ResponseWriter, r *http.Request) {
 	logger := log.WithFields(log.Fields{
-		"request": "InternalUsersHandler",
+		"request": "InternalPurchaseStatusHandler",
 		"method":  r.Method,
 	})
-	if !validateAdmin(r.Context()) {
-		logger.Warn("Invalid role type")
-		util.Respond(w, http.StatusForbidden, util.Message("Invalid role type"))
+
+	vars := mux.Vars(r)
+	requestedPurchase := vars["purchaseId"]
+
+	var reqData internaltypes.PurchaseStatusRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
 		return
 	}
 
-	pageNum := 0
-	pageNumQuery := r.URL.Query().Get("page")
-	if pageNumInt, err := strconv.Atoi(pageNumQuery); err == nil {
-		pageNum = pageNumInt - 1
+	// cancelling has its own route since it refunds payments and restores stock
+	if reqData.Status == models.TransactionStatusCancelled {
+		util.RespondError(w, util.BadRequest("Invalid status"))
+		return
 	}
 
-	query := repository_interfaces.UsersPageQuery{}
-	query.Page = pageNum
-	query.PageSize = pageSize
+	tx := sr.Db.Begin()
+	transaction, err := sr.purchaseRepository.GetTransactionForUpdate(tx, requestedPurchase)
+	if err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			util.RespondError(w, util.NotFound("Transaction not found"))
+			return
+		}
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
 
-	if role := r.URL.Query().Get("role"); role == "admin" || role == "user" {
-		query.Role = &role
+	if !transaction.CanAdvanceTo(reqData.Status) {
+		tx.Rollback()
+		util.RespondError(w, util.Conflict("Can't move a "+transaction.Status+" purchase to "+reqData.Status))
+		return
+	}
+
+	before := *transaction
+	transaction.Status = reqData.Status
+	if err := sr.purchaseRepository.UpdateTransaction(tx, transaction); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditPurchaseStatus,
+		EntityType: models.AuditEntityPurchase,
+		EntityId:   requestedPurchase,
+		Before:     &before,
+		After:      transaction,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusOK, util.Message("Successfully updated purchase status"))
+}
+
+// parseDate accepts RFC3339 timestamps or plain dates, endOfDay moves plain
+// dates to the start of the next day so they can be used as exclusive bounds
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return date, err
+	}
+	if endOfDay {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date, nil
+}
+
+// purchasesHandler lists purchases from all users, query parameters:
+// - user_id
+// - from, to: dates (2006-01-02), both inclusive, or RFC3339 timestamps, to exclusive
+// - status: placed or cancelled
+// - payment_status: paid, unpaid or partial
+// - coffee_id: purchases containing the coffee
+// - min_total
+// - sort: created_at (default), total, amount_paid or balance
+// - direction: asc or desc (default)
+func (sr *internalSubrouter) purchasesHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "InternalPurchasesHandler",
+		"method":  r.Method,
+	})
+
+	pageQuery, err := util.ParsePageQuery(r, pageSize, sr.maxPageSize)
+	if err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
+		return
+	}
+
+	query := repository_interfaces.PurchasePageQuery{
+		PageQuery: pageQuery,
+	}
+
+	params := r.URL.Query()
+	if userId := params.Get("user_id"); userId != "" {
+		if _, err := uuid.Parse(userId); err != nil {
+			util.RespondError(w, util.BadRequest("Invalid user_id"))
+			return
+		}
+		query.UserId = &userId
+	}
+	if from := params.Get("from"); from != "" {
+		fromDate, err := parseDate(from, false)
+		if err != nil {
+			util.RespondError(w, util.BadRequest("Invalid from date"))
+			return
+		}
+		query.From = &fromDate
+	}
+	if to := params.Get("to"); to != "" {
+		toDate, err := parseDate(to, true)
+		if err != nil {
+			util.RespondError(w, util.BadRequest("Invalid to date"))
+			return
+		}
+		query.To = &toDate
+	}
+	if status := params.Get("status"); status != "" {
+		if !models.IsValidTransactionStatus(status) {
+			util.RespondError(w, util.BadRequest("Invalid status"))
+			return
+		}
+		query.Status = &status
+	}
+	if paymentStatus := params.Get("payment_status"); paymentStatus != "" {
+		switch paymentStatus {
+		case listing.PaymentStatusPaid, listing.PaymentStatusUnpaid, listing.PaymentStatusPartial:
+			query.PaymentStatus = &paymentStatus
+		default:
+			util.RespondError(w, util.BadRequest("Invalid payment_status"))
+			return
+		}
+	}
+	if coffeeId := params.Get("coffee_id"); coffeeId != "" {
+		coffeeIdInt, err := strconv.ParseUint(coffeeId, 10, 32)
+		if err != nil {
+			util.RespondError(w, util.BadRequest("Invalid coffee_id"))
+			return
+		}
+		coffeeIdUint := uint(coffeeIdInt)
+		query.CoffeeId = &coffeeIdUint
+	}
+	if minTotal := params.Get("min_total"); minTotal != "" {
+		minTotalFloat, err := strconv.ParseFloat(minTotal, 64)
+		if err != nil {
+			util.RespondError(w, util.BadRequest("Invalid min_total"))
+			return
+		}
+		query.MinTotal = &minTotalFloat
+	}
+	if sort := params.Get("sort"); sort != "" {
+		query.Sort = &sort
+	}
+	if direction := params.Get("direction"); direction != "" {
+		query.SortDirection = &direction
 	}
 
 	tx := sr.Db.Begin()
-	users, err := sr.userRepository.GetUsersPaginated(tx, &query)
+	dbPurchases, pageInfo, err := sr.purchaseRepository.GetTransactionsPaginated(tx, &query)
 	if err != nil {
+		tx.Rollback()
 		logger.WithError(err).Warn("Error retrieving values")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, err)
 		return
 	}
+	dbtx.Commit(tx)
 
-	if len(users) == 0 {
-		logger.Warn("users not found")
-		util.Respond(w, http.StatusNotFound, util.Message("Couldn't find any users"))
+	purchases := make([]*internaltypes.PurchaseResponse, 0, len(dbPurchases))
+	for _, purchase := range dbPurchases {
+		purchases = append(purchases, &internaltypes.PurchaseResponse{
+			ID:            purchase.ID,
+			UserId:        purchase.UserId,
+			Status:        purchase.Status,
+			AmountPaid:    purchase.AmountPaid,
+			Total:         purchase.Total,
+			CreatedAt:     purchase.CreatedAt,
+			PurchaseItems: purchase.Items,
+		})
+	}
+
+	util.Respond(w, http.StatusOK, util.NewListResponse("Purchases successfully queried", purchases, query.PageSize, pageInfo))
+}
+
+func (sr *internalSubrouter) cancelPurchaseHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "InternalCancelPurchaseHandler",
+		"method":  r.Method,
+	})
+
+	vars := mux.Vars(r)
+	requestedPurchase := vars["purchaseId"]
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		logger.Warn("Missing principal")
+		util.RespondError(w, util.InternalError())
+		return
+	}
+
+	var reqData internaltypes.CancelPurchaseRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
+		return
+	}
+
+	tx := sr.Db.Begin()
+	transaction, err := sr.purchaseRepository.GetTransactionForUpdate(tx, requestedPurchase)
+	if err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			util.RespondError(w, util.NotFound("Transaction not found"))
+			return
+		}
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
 		return
 	}
 
-	response := util.Message("Users successfully queried")
-	response["users"] = users
-	response["page_size"] = len(users)
+	before := *transaction
+	if err := sr.purchaseRepository.CancelTransaction(tx, transaction, principal.UserId, reqData.Reason); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error cancelling purchase")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditPurchaseCancel,
+		EntityType: models.AuditEntityPurchase,
+		EntityId:   requestedPurchase,
+		Before:     &before,
+		After:      transaction,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
 
-	util.Respond(w, http.StatusOK, response)
+	util.Respond(w, http.StatusOK, util.Message("Successfully cancelled purchase"))
 }
 
-func (sr *internalSubrouter) updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+func (sr *internalSubrouter) usersHandler(w http.ResponseWriter, r *http.Request) {
 	logger := log.WithFields(log.Fields{
-		"request": "InternalUpdateUserRole",
+		"request": "InternalUsersHandler",
 		"method":  r.Method,
 	})
 
-	if !validateAdmin(r.Context()) {
-		util.Respond(w, http.StatusForbidden, util.Message("Invalid role type"))
+	pageQuery, err := util.ParsePageQuery(r, pageSize, sr.maxPageSize)
+	if err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
 		return
 	}
-	vars := mux.Vars(r)
-	requestedUser := vars["userId"]
 
-	var reqData UpdateRoleRequest
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&reqData); err != nil {
-		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+	query := repository_interfaces.UsersPageQuery{
+		PageQuery: pageQuery,
+	}
+
+	if role := r.URL.Query().Get("role"); models.IsValidRole(role) {
+		query.Role = &role
+	}
+	if search := strings.TrimSpace(r.URL.Query().Get("search")); search != "" {
+		query.Search = &search
+	}
+
+	tx := sr.Db.Begin()
+	users, pageInfo, err := sr.userRepository.GetUsersPaginated(tx, &query)
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error retrieving values")
+		util.RespondError(w, err)
 		return
 	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusOK, util.NewListResponse("Users successfully queried", users, query.PageSize, pageInfo))
+}
+
+func (sr *internalSubrouter) updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "InternalUpdateUserRole",
+		"method":  r.Method,
+	})
+
+	vars := mux.Vars(r)
+	requestedUser := vars["userId"]
 
-	if reqData.Role != "admin" && reqData.Role != "user" {
-		logger.Warn("Invalid Role")
-		util.Respond(w, http.StatusBadRequest, util.Message("Invalid Role"))
+	var reqData internaltypes.UpdateRoleRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
 		return
 	}
 
@@ -341,7 +794,7 @@ func (sr *internalSubrouter) updateUserRoleHandler(w http.ResponseWriter, r *htt
 	if err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn("Database Error")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, err)
 		return
 	}
 
@@ -350,18 +803,528 @@ func (sr *internalSubrouter) updateUserRoleHandler(w http.ResponseWriter, r *htt
 	if user, doesUserExist = usersMap[requestedUser]; !doesUserExist {
 		tx.Rollback()
 		logger.WithError(err).Warn("user not found")
-		util.Respond(w, http.StatusNotFound, util.Message("User not found"))
+		util.RespondError(w, util.NotFound("User not found"))
 		return
 	}
 
+	before := *user
 	user.Role = reqData.Role
 	if err := sr.userRepository.UpdateUser(tx, user); err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn("Database Error")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditUserRole,
+		EntityType: models.AuditEntityUser,
+		EntityId:   requestedUser,
+		Before:     &before,
+		After:      user,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
 		return
 	}
 
-	tx.Commit()
+	dbtx.Commit(tx)
 	util.Respond(w, http.StatusOK, util.Message("Successfully updated user role"))
 }
+
+// generateTemporaryPassword creates a random password for accounts created
+// by admins, users are asked to change it when they first log in
+func generateTemporaryPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (sr *internalSubrouter) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "InternalCreateUserHandler",
+		"method":  r.Method,
+	})
+
+	var reqData internaltypes.CreateUserRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
+		return
+	}
+
+	if reqData.Role == "" {
+		reqData.Role = models.RoleUser
+	}
+
+	temporaryPassword, err := generateTemporaryPassword()
+	if err != nil {
+		logger.WithError(err).Warn("Error generating password")
+		util.RespondError(w, err)
+		return
+	}
+
+	user := models.User{
+		ID:                 uuid.New(),
+		FirstName:          reqData.FirstName,
+		LastName:           reqData.LastName,
+		Email:              strings.ToLower(reqData.Email),
+		PhoneNumber:        reqData.PhoneNumber,
+		Password:           temporaryPassword,
+		Role:               reqData.Role,
+		MustChangePassword: true,
+	}
+
+	if err := user.Validate(); err != nil {
+		logger.WithError(err).Warn("Invalid user attributes")
+		util.RespondError(w, err)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(temporaryPassword), bcrypt.DefaultCost)
+	if err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
+		return
+	}
+	user.Password = string(hashedPassword)
+
+	tx := sr.Db.Begin()
+
+	// deleted users keep their email, so include them in the check
+	_, err = sr.userRepository.GetUserByEmail(tx.Unscoped(), user.Email)
+	if err == nil {
+		tx.Rollback()
+		util.RespondError(w, util.Conflict("Email is already in use"))
+		return
+	}
+	if err != gorm.ErrRecordNotFound {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	if err := sr.userRepository.CreateUser(tx, &user); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditUserCreate,
+		EntityType: models.AuditEntityUser,
+		EntityId:   user.ID.String(),
+		After:      &user,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusCreated, internaltypes.CreateUserResponse{
+		Message:           "Created User",
+		UserId:            user.ID,
+		TemporaryPassword: temporaryPassword,
+	})
+}
+
+func (sr *internalSubrouter) deactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	sr.setUserActive(w, r, false)
+}
+
+func (sr *internalSubrouter) reactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	sr.setUserActive(w, r, true)
+}
+
+// setUserActive deactivates or reactivates the user in the route
+func (sr *internalSubrouter) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	logger := log.WithFields(log.Fields{
+		"request": "InternalSetUserActiveHandler",
+		"method":  r.Method,
+		"active":  active,
+	})
+
+	vars := mux.Vars(r)
+	requestedUser := vars["userId"]
+	deactivate := !active
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		logger.Warn("Missing principal")
+		util.RespondError(w, util.InternalError())
+		return
+	}
+	if deactivate && principal.IsSelf(requestedUser) {
+		util.RespondError(w, util.BadRequest("You can't deactivate your own account"))
+		return
+	}
+
+	tx := sr.Db.Begin()
+	usersMap, err := sr.userRepository.GetUsersByIds(tx, []string{requestedUser})
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	user, doesUserExist := usersMap[requestedUser]
+	if !doesUserExist {
+		tx.Rollback()
+		util.RespondError(w, util.NotFound("User not found"))
+		return
+	}
+
+	if deactivate == user.IsDeactivated() {
+		tx.Rollback()
+		util.Respond(w, http.StatusOK, util.Message("User is unchanged"))
+		return
+	}
+
+	before := *user
+	action := models.AuditUserReactivate
+	if deactivate {
+		now := time.Now()
+		user.DeactivatedAt = &now
+		action = models.AuditUserDeactivate
+	} else {
+		user.DeactivatedAt = nil
+	}
+
+	if err := sr.userRepository.UpdateUser(tx, user); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     action,
+		EntityType: models.AuditEntityUser,
+		EntityId:   requestedUser,
+		Before:     &before,
+		After:      user,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	if deactivate {
+		util.Respond(w, http.StatusOK, util.Message("Successfully deactivated user"))
+		return
+	}
+	util.Respond(w, http.StatusOK, util.Message("Successfully reactivated user"))
+}
+
+func (sr *internalSubrouter) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "InternalDeleteUserHandler",
+		"method":  r.Method,
+	})
+
+	vars := mux.Vars(r)
+	requestedUser := vars["userId"]
+	force := r.URL.Query().Get("force") == "true"
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		logger.Warn("Missing principal")
+		util.RespondError(w, util.InternalError())
+		return
+	}
+	if principal.IsSelf(requestedUser) {
+		util.RespondError(w, util.BadRequest("You can't delete your own account"))
+		return
+	}
+
+	tx := sr.Db.Begin()
+	usersMap, err := sr.userRepository.GetUsersByIds(tx, []string{requestedUser})
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	user, doesUserExist := usersMap[requestedUser]
+	if !doesUserExist {
+		tx.Rollback()
+		util.RespondError(w, util.NotFound("User not found"))
+		return
+	}
+
+	outstanding, err := sr.purchaseRepository.CountOutstandingTransactions(tx, requestedUser)
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if outstanding > 0 && !force {
+		tx.Rollback()
+		util.RespondError(w, util.Conflict(fmt.Sprintf("User has %d outstanding purchases, pass force=true to delete anyway", outstanding)))
+		return
+	}
+	if outstanding > 0 {
+		logger.Warnf("Deleting user %s with %d outstanding purchases", requestedUser, outstanding)
+	}
+
+	if err := sr.userRepository.DeleteUser(tx, requestedUser); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditUserDelete,
+		EntityType: models.AuditEntityUser,
+		EntityId:   requestedUser,
+		Before:     user,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusOK, util.Message("Successfully deleted user"))
+}
+
+func (sr *internalSubrouter) apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "InternalAPIKeysHandler",
+		"method":  r.Method,
+	})
+
+	tx := sr.Db.Begin()
+	keys, err := sr.apiKeyRepository.GetAPIKeys(tx)
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusOK, internaltypes.APIKeysResponse{
+		Message: "API keys successfully queried",
+		APIKeys: keys,
+	})
+}
+
+func (sr *internalSubrouter) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "InternalCreateAPIKeyHandler",
+		"method":  r.Method,
+	})
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		logger.Warn("Missing principal")
+		util.RespondError(w, util.InternalError())
+		return
+	}
+
+	var reqData internaltypes.CreateAPIKeyRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
+		return
+	}
+
+	permissions := make([]models.Permission, 0, len(reqData.Scopes))
+	for i, scope := range reqData.Scopes {
+		permission := models.Permission(scope)
+		// keys can't be used to create more keys
+		if permission == models.PermissionAPIKeysManage {
+			util.RespondError(w, util.ValidationFailed(utiltypes.FieldError{
+				Field:   fmt.Sprintf("scopes[%d]", i),
+				Message: "can't be granted to API keys",
+			}))
+			return
+		}
+		permissions = append(permissions, permission)
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		logger.WithError(err).Warn("Error generating API key")
+		util.RespondError(w, err)
+		return
+	}
+
+	apiKey := models.APIKey{
+		Name:      reqData.Name,
+		Prefix:    prefix,
+		Hash:      auth.HashAPIKey(key),
+		CreatedBy: principal.UserId,
+	}
+	apiKey.SetPermissions(permissions)
+
+	tx := sr.Db.Begin()
+	if reqData.UserId != nil {
+		usersMap, err := sr.userRepository.GetUsersByIds(tx, []string{*reqData.UserId})
+		if err != nil {
+			tx.Rollback()
+			logger.WithError(err).Warn("Database Error")
+			util.RespondError(w, err)
+			return
+		}
+		user, doesUserExist := usersMap[*reqData.UserId]
+		if !doesUserExist {
+			tx.Rollback()
+			util.RespondError(w, util.BadRequest("User not found"))
+			return
+		}
+		apiKey.UserId = &user.ID
+	}
+
+	if err := sr.apiKeyRepository.CreateAPIKey(tx, &apiKey); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditAPIKeyCreate,
+		EntityType: models.AuditEntityAPIKey,
+		EntityId:   strconv.FormatUint(uint64(apiKey.ID), 10),
+		After:      &apiKey,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusCreated, internaltypes.CreateAPIKeyResponse{
+		Message:  "Created API key, it won't be shown again",
+		APIKeyId: apiKey.ID,
+		Prefix:   apiKey.Prefix,
+		Key:      key,
+	})
+}
+
+func (sr *internalSubrouter) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "InternalRevokeAPIKeyHandler",
+		"method":  r.Method,
+	})
+
+	vars := mux.Vars(r)
+	requestedKey := vars["apiKeyId"]
+
+	tx := sr.Db.Begin()
+	apiKey, err := sr.apiKeyRepository.GetAPIKeyById(tx, requestedKey)
+	if err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			util.RespondError(w, util.NotFound("API key not found"))
+			return
+		}
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	before := *apiKey
+	if err := sr.apiKeyRepository.RevokeAPIKey(tx, apiKey); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditAPIKeyRevoke,
+		EntityType: models.AuditEntityAPIKey,
+		EntityId:   requestedKey,
+		Before:     &before,
+		After:      apiKey,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusOK, util.Message("Successfully revoked API key"))
+}
+
+// auditHandler lists audit events, newest first, query parameters:
+// - actor_id: user who made the change
+// - action: e.g. user.role
+// - entity_type and entity_id: what was changed
+// - from, to: dates (2006-01-02), both inclusive, or RFC3339 timestamps, to exclusive
+func (sr *internalSubrouter) auditHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "InternalAuditHandler",
+		"method":  r.Method,
+	})
+
+	pageQuery, err := util.ParsePageQuery(r, pageSize, sr.maxPageSize)
+	if err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
+		return
+	}
+
+	query := repository_interfaces.AuditPageQuery{
+		PageQuery: pageQuery,
+	}
+
+	params := r.URL.Query()
+	if actorId := params.Get("actor_id"); actorId != "" {
+		if _, err := uuid.Parse(actorId); err != nil {
+			util.RespondError(w, util.BadRequest("Invalid actor_id"))
+			return
+		}
+		query.ActorId = &actorId
+	}
+	if action := params.Get("action"); action != "" {
+		query.Action = &action
+	}
+	if entityType := params.Get("entity_type"); entityType != "" {
+		query.EntityType = &entityType
+	}
+	if entityId := params.Get("entity_id"); entityId != "" {
+		query.EntityId = &entityId
+	}
+	if from := params.Get("from"); from != "" {
+		fromDate, err := parseDate(from, false)
+		if err != nil {
+			util.RespondError(w, util.BadRequest("Invalid from date"))
+			return
+		}
+		query.From = &fromDate
+	}
+	if to := params.Get("to"); to != "" {
+		toDate, err := parseDate(to, true)
+		if err != nil {
+			util.RespondError(w, util.BadRequest("Invalid to date"))
+			return
+		}
+		query.To = &toDate
+	}
+
+	tx := sr.Db.Begin()
+	events, pageInfo, err := sr.auditRepository.GetAuditEventsPaginated(tx, &query)
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error retrieving values")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusOK, util.NewListResponse("Audit events successfully queried", events, query.PageSize, pageInfo))
+}
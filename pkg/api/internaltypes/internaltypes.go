@@ -0,0 +1,89 @@
+// Package internaltypes holds the request and response bodies of the
+// /internal routes. They live outside of the internal package so clients like
+// pkg/client can use them.
+package internaltypes
+
+import (
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/google/uuid"
+)
+
+type CreateCoffeeRequest struct {
+	Name        string  `json:"name" validate:"notblank,max=255"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price" validate:"gt=0"`
+	// defaults to true
+	InStock *bool `json:"inStock"`
+	Stock   *int  `json:"stock" validate:"omitempty,min=0"`
+}
+
+type UpdateCoffeeRequest struct {
+	Name        *string  `json:"name" validate:"omitempty,notblank,max=255"`
+	Description *string  `json:"description"`
+	Price       *float64 `json:"price" validate:"omitempty,gt=0"`
+	InStock     *bool    `json:"inStock"`
+	Stock       *int     `json:"stock" validate:"omitempty,min=0"`
+}
+
+type PurchaseUpdateRequest struct {
+	AmountPaid float64 `json:"amountPaid" validate:"min=0"`
+}
+
+type PurchaseStatusRequest struct {
+	Status string `json:"status" validate:"required,transaction_status"`
+}
+
+type CancelPurchaseRequest struct {
+	Reason string `json:"reason" validate:"notblank"`
+}
+
+type PurchaseResponse struct {
+	ID            uint                   `json:"transactionId"`
+	UserId        uuid.UUID              `json:"userId"`
+	Status        string                 `json:"status"`
+	AmountPaid    float64                `json:"amountPaid"`
+	Total         float64                `json:"total"`
+	CreatedAt     time.Time              `json:"purchaseDate"`
+	PurchaseItems []*models.PurchaseItem `json:"items"`
+}
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" validate:"required,role"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" validate:"notblank,max=255"`
+	Scopes []string `json:"scopes" validate:"min=1,dive,permission"`
+	// optional user the key acts as
+	UserId *string `json:"userId" validate:"omitempty,uuid"`
+}
+
+type CreateUserRequest struct {
+	FirstName   string  `json:"firstName" validate:"notblank,max=255"`
+	LastName    string  `json:"lastName" validate:"notblank,max=255"`
+	Email       string  `json:"email" validate:"required,email,max=320"`
+	PhoneNumber *string `json:"phoneNumber" validate:"omitempty,max=9"`
+	// defaults to user
+	Role string `json:"role" validate:"omitempty,role"`
+}
+
+type CreateUserResponse struct {
+	Message           string    `json:"message"`
+	UserId            uuid.UUID `json:"userId"`
+	TemporaryPassword string    `json:"temporaryPassword"`
+}
+
+type APIKeysResponse struct {
+	Message string           `json:"message"`
+	APIKeys []*models.APIKey `json:"apiKeys"`
+}
+
+type CreateAPIKeyResponse struct {
+	Message  string `json:"message"`
+	APIKeyId uint   `json:"apiKeyId"`
+	Prefix   string `json:"prefix"`
+	// only returned once, it's stored hashed
+	Key string `json:"key"`
+}
@@ -1,11 +1,16 @@
 package menu
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/menutypes"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/dbtx"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/ratelimit"
 	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
@@ -19,26 +24,33 @@ type MenuSubrouter struct {
 	util.CommonSubrouter
 
 	coffeeRepository repository_interfaces.CoffeeRepository
+	// largest page size clients can request
+	maxPageSize int
 }
 
-type CoffeeResponse struct {
-	ID          uint
-	Name        string
-	Description string
-	Price       float64
-	InStock     bool
-	UpdatedAt   time.Time `json:"-"`
-}
+func Setup(router *mux.Router, db *gorm.DB, rateLimiter *ratelimit.Limiter, spec *openapi.Spec, coffeeRepository repository_interfaces.CoffeeRepository, maxPageSize int) error {
+	if db == nil || router == nil || rateLimiter == nil || spec == nil {
+		err := errors.New("a required setup argument is nil")
+		log.WithError(err).Warn()
+		return err
+	}
 
-func Setup(router *mux.Router, db *gorm.DB, coffeeRepository repository_interfaces.CoffeeRepository) error {
 	subRouter := MenuSubrouter{
 		coffeeRepository: coffeeRepository,
+		maxPageSize:      maxPageSize,
 	}
 	subRouter.Router = router.PathPrefix(prefix).Subrouter()
 	subRouter.Db = db
+	subRouter.Router.Use(rateLimiter.Middleware("menu", ratelimit.PerMinute(120)))
 
 	// Get all the coffees that are available
-	subRouter.Router.HandleFunc("", subRouter.CoffeeHandler).Methods("GET")
+	spec.Describe(subRouter.Router.HandleFunc("", subRouter.CoffeeHandler).Methods("GET"), openapi.Route{
+		Summary: "List the coffees on the menu",
+		Query: append(util.PageParameters(),
+			openapi.Query("in_stock", "boolean", "Only coffees that are or aren't in stock"),
+		),
+		Response: util.ListOf([]*menutypes.CoffeeResponse{}),
+	})
 	return nil
 }
 
@@ -48,55 +60,52 @@ func (router *MenuSubrouter) CoffeeHandler(w http.ResponseWriter, r *http.Reques
 		"method":  r.Method,
 	})
 
-	var err error
-
-	// Find pagenum
-	pageNum := 0
-	pageNumQuery := r.URL.Query().Get("page")
-	if pageNumInt, err := strconv.Atoi(pageNumQuery); err == nil {
-		pageNum = pageNumInt - 1
+	pageQuery, err := util.ParsePageQuery(r, pageSize, router.maxPageSize)
+	if err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
+		return
 	}
 
-	query := repository_interfaces.CoffeePageQuery{}
-	query.PageSize = pageSize
-	query.Page = pageNum
+	query := repository_interfaces.CoffeePageQuery{
+		PageQuery: pageQuery,
+	}
 
 	// find in stock coffees only
-	inStockQuery := r.URL.Query().Get("in_stock")
-	if inStockBool, err := strconv.ParseBool(inStockQuery); err == nil {
+	if inStockQuery := r.URL.Query().Get("in_stock"); inStockQuery != "" {
+		inStockBool, err := strconv.ParseBool(inStockQuery)
+		if err != nil {
+			util.RespondError(w, util.ValidationFailed(utiltypes.FieldError{
+				Field:   "in_stock",
+				Message: "must be true or false",
+			}))
+			return
+		}
 		query.InStock = &inStockBool
 	}
 
 	// query coffees
 	tx := router.Db.Begin()
-	coffees, err := router.coffeeRepository.GetCoffeesPaginated(tx, &query)
+	coffees, pageInfo, err := router.coffeeRepository.GetCoffeesPaginated(tx, &query)
 	if err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message("Error getting coffees"))
-		return
-	}
-	tx.Commit()
-
-	if len(coffees) == 0 {
-		logger.Warn("coffees not found")
-		util.Respond(w, http.StatusNotFound, util.Message("Couldn't find coffees"))
+		util.RespondError(w, err)
 		return
 	}
+	dbtx.Commit(tx)
 
-	res := make([]*CoffeeResponse, 0, len(coffees))
+	res := make([]*menutypes.CoffeeResponse, 0, len(coffees))
 	for _, coffee := range coffees {
-		res = append(res, &CoffeeResponse{
+		res = append(res, &menutypes.CoffeeResponse{
 			ID:          coffee.ID,
 			Name:        coffee.Name,
 			Description: coffee.Description,
 			Price:       coffee.Price,
 			InStock:     coffee.InStock,
+			Stock:       coffee.Stock,
 		})
 	}
 
-	util.Respond(w, http.StatusOK, map[string]interface{}{
-		"coffees":   res,
-		"page_size": len(res),
-	})
+	util.Respond(w, http.StatusOK, util.NewListResponse("", res, query.PageSize, pageInfo))
 }
@@ -0,0 +1,15 @@
+// Package menutypes holds the response bodies of the /menu routes. They live
+// outside of the menu package so clients like pkg/client can use them.
+package menutypes
+
+import "time"
+
+type CoffeeResponse struct {
+	ID          uint
+	Name        string
+	Description string
+	Price       float64
+	InStock     bool
+	Stock       *int
+	UpdatedAt   time.Time `json:"-"`
+}
@@ -1,16 +1,30 @@
 package purchases
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/audit"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/auth"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/purchasestypes"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/background"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/config"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/dbtx"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/mailer"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/metrics"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/ratelimit"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/receipts"
 	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	log "github.com/sirupsen/logrus"
@@ -24,32 +38,36 @@ type PurchaseSubRouter struct {
 
 	coffeeRepository   repository_interfaces.CoffeeRepository
 	purchaseRepository repository_interfaces.TransactionsRepository
+	userRepository     repository_interfaces.UserRepository
+	auditRecorder      *audit.Recorder
+
+	cancellationWindow time.Duration
+	shopName           string
+	maxPageSize        int
+	receiptGenerator   *receipts.Generator
+	// nil if emails are disabled
+	mailer mailer.Mailer
+	// receipts are emailed in the background
+	workers *background.Workers
 }
 
-type PurchaseItem struct {
-	CoffeeId      uint   `json:"coffeeId"`
-	CoffeeOptions string `json:"options"`
-}
-
-// Requests
-
-type PurchaseRequest struct {
-	Coffees []PurchaseItem `json:"items"`
-}
-
-// Responses
-
-type PurchaseHistoryResponse struct {
-	ID            uint                   `json:"transactionId"`
-	AmountPaid    float64                `json:"amountPaid"`
-	Total         float64                `json:"total"`
-	CreatedAt     time.Time              `json:"purchaseDate"`
-	PurchaseItems []*models.PurchaseItem `json:"items"`
-}
+func Setup(router *mux.Router, db *gorm.DB, authMiddleware mux.MiddlewareFunc, rateLimiter *ratelimit.Limiter, spec *openapi.Spec,
+	coffeeRepository repository_interfaces.CoffeeRepository,
+	transactionRepository repository_interfaces.TransactionsRepository,
+	userRepository repository_interfaces.UserRepository,
+	auditRecorder *audit.Recorder,
+	receiptMailer mailer.Mailer,
+	workers *background.Workers,
+	cfg *config.Config,
+) error {
+	if db == nil || router == nil || authMiddleware == nil || rateLimiter == nil || spec == nil || auditRecorder == nil || workers == nil || cfg == nil {
+		err := errors.New("a required setup argument is nil")
+		log.WithError(err).Warn()
+		return err
+	}
 
-func Setup(router *mux.Router, db *gorm.DB, coffeeRepository repository_interfaces.CoffeeRepository, transactionRepository repository_interfaces.TransactionsRepository) error {
-	if db == nil || router == nil {
-		err := errors.New("db or router is nil")
+	receiptGenerator, err := receipts.NewGenerator()
+	if err != nil {
 		log.WithError(err).Warn()
 		return err
 	}
@@ -57,23 +75,70 @@ func Setup(router *mux.Router, db *gorm.DB, coffeeRepository repository_interfac
 	purchase := PurchaseSubRouter{
 		coffeeRepository:   coffeeRepository,
 		purchaseRepository: transactionRepository,
+		userRepository:     userRepository,
+		auditRecorder:      auditRecorder,
+		cancellationWindow: cfg.Shop.CancellationWindow,
+		shopName:           cfg.Shop.Name,
+		maxPageSize:        cfg.API.MaxPageSize,
+		receiptGenerator:   receiptGenerator,
+		mailer:             receiptMailer,
+		workers:            workers,
 	}
 	purchase.Router = router.
 		PathPrefix(prefix).
 		Subrouter()
 
 	purchase.Db = db
-	// Set up auth middleware
-	purchase.Router.Use(util.AuthMiddleware)
+	// Set up auth middleware, limits are per user once authenticated
+	purchase.Router.Use(authMiddleware)
+	purchase.Router.Use(rateLimiter.Middleware("purchases", ratelimit.PerMinute(60)))
 
 	// route for people to put in purchases, they should not be able to
 	// put amount paid, this is done on internal route
-	purchase.Router.HandleFunc("/purchase", purchase.PurchaseHandler).Methods("POST")
+	placeOrder := rateLimiter.Middleware("orders", ratelimit.PerMinute(10))(auth.RequirePermission(models.PermissionOrdersCreate)(http.HandlerFunc(purchase.PurchaseHandler)))
+	spec.Describe(purchase.Router.Handle("/purchase", placeOrder).Methods("POST"), openapi.Route{
+		Summary:    "Place a purchase",
+		Permission: string(models.PermissionOrdersCreate),
+		Request:    purchasestypes.PurchaseRequest{},
+		Response:   purchasestypes.PurchaseConfirmedResponse{},
+	})
+
+	// /purchases/user/{userId} will get the purchase history for that user.
+	// query parameters can be page or cursor, cursor takes the next_cursor
+	// of the previous page
+	spec.Describe(purchase.Router.Handle("/user/{userId}", auth.RequireSelfOrPermission("userId", models.PermissionOrdersRead)(http.HandlerFunc(purchase.PurchaseHistoryHandler))).Methods("GET"), openapi.Route{
+		Summary:     "List the purchases of a user, newest first",
+		Description: "Users can list their own purchases, other users need the `orders:read` permission.",
+		Auth:        true,
+		Query:       util.PageParameters(),
+		Response:    util.ListOf([]*purchasestypes.PurchaseHistoryResponse{}),
+	})
+
+	// route for users to cancel their own purchases within the cancellation window
+	spec.Describe(purchase.Router.HandleFunc("/{transactionId:[0-9]+}/cancel", purchase.CancelPurchaseHandler).Methods("POST"), openapi.Route{
+		Summary:     "Cancel an own purchase",
+		Description: "Only purchases that are still placed can be cancelled, within the cancellation window. The body is optional.",
+		Auth:        true,
+		Request:     purchasestypes.CancelRequest{},
+		Response:    utiltypes.MessageResponse{},
+	})
 
-	// /purchases/{userId} will get the purchase history for that user.
-	// query parameters should be pageNum
-	// TODO: refactor page number to page token using purchase ids
-	purchase.Router.HandleFunc("/user/{userId}", purchase.PurchaseHistoryHandler).Methods("GET")
+	// receipt for a purchase, query parameter format can be html (default), text or pdf
+	spec.Describe(purchase.Router.HandleFunc("/{transactionId:[0-9]+}/receipt", purchase.ReceiptHandler).Methods("GET"), openapi.Route{
+		Summary: "Render the receipt of a purchase",
+		Auth:    true,
+		Query: []*openapi.Parameter{
+			openapi.Query("format", "string", "html (default), text or pdf"),
+		},
+		ContentTypes: []string{"text/html", "text/plain", "application/pdf"},
+	})
+
+	// details of a single purchase with its items and payments
+	spec.Describe(purchase.Router.HandleFunc("/{transactionId:[0-9]+}", purchase.PurchaseDetailHandler).Methods("GET"), openapi.Route{
+		Summary:  "Get a purchase with its items and payments",
+		Auth:     true,
+		Response: purchasestypes.GetPurchaseResponse{},
+	})
 	return nil
 }
 
@@ -83,33 +148,31 @@ func (sr *PurchaseSubRouter) PurchaseHandler(w http.ResponseWriter, r *http.Requ
 		"method":  r.Method,
 	})
 
-	userId, ok := r.Context().Value("user").(uuid.UUID)
+	principal, ok := auth.PrincipalFromContext(r.Context())
 	if !ok {
-		logger.Warn("Error parsing uuid")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Error parsing user id header"))
+		logger.Warn("Missing principal")
+		util.RespondError(w, util.InternalError())
 		return
 	}
-
-	var reqData PurchaseRequest
-	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&reqData)
-	if err != nil {
-		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+	if !principal.HasUser() {
+		util.RespondError(w, util.Forbidden("API key must be bound to a user to place purchases"))
 		return
 	}
 
-	if len(reqData.Coffees) == 0 {
-		logger.Warn("Order items can't be empty")
-		util.Respond(w, http.StatusBadRequest, util.Message("Invalid request, order can't be empty"))
+	var reqData purchasestypes.PurchaseRequest
+	if err := util.DecodeJSON(w, r, &reqData); err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
 		return
 	}
 
 	coffeeIdsMap := make(map[string]bool)
+	coffeeCounts := make(map[uint]int)
 
 	purchaseItems := make([]*models.PurchaseItem, 0, len(reqData.Coffees))
 	for _, item := range reqData.Coffees {
 		coffeeIdsMap[strconv.FormatUint(uint64(item.CoffeeId), 10)] = true
+		coffeeCounts[item.CoffeeId]++
 		purchaseItems = append(purchaseItems, &models.PurchaseItem{
 			CoffeeId:   item.CoffeeId,
 			TypeOption: item.CoffeeOptions,
@@ -126,38 +189,72 @@ func (sr *PurchaseSubRouter) PurchaseHandler(w http.ResponseWriter, r *http.Requ
 	if err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn("Error retrieving coffees")
-		util.Respond(w, http.StatusInternalServerError, util.Message("InternalError"))
+		util.RespondError(w, err)
 		return
 	}
 
 	totalPrice := 0.0
-	for _, purchaseItem := range purchaseItems {
+	for i, purchaseItem := range purchaseItems {
 		coffee, exists := coffeesMap[strconv.FormatUint(uint64(purchaseItem.CoffeeId), 10)]
 		if !exists {
 			tx.Rollback()
-			logger.Warn("Error coffee doesn't exist")
-			util.Respond(w, http.StatusInternalServerError, util.Message("InternalError"))
+			logger.Warnf("Coffee %d doesn't exist", purchaseItem.CoffeeId)
+			util.RespondError(w, util.ValidationFailed(utiltypes.FieldError{
+				Field:   fmt.Sprintf("coffees[%d].coffeeId", i),
+				Message: fmt.Sprintf("coffee %d doesn't exist", purchaseItem.CoffeeId),
+			}))
+			return
+		}
+		if coffee.Stock != nil && *coffee.Stock < coffeeCounts[coffee.ID] {
+			tx.Rollback()
+			logger.Warnf("Not enough stock for coffee %d", coffee.ID)
+			util.RespondError(w, util.NewError(http.StatusConflict, utiltypes.CodeOutOfStock, "Not enough stock for "+coffee.Name))
 			return
 		}
 		purchaseItem.Price = coffee.Price
 		totalPrice += purchaseItem.Price
 	}
 
+	stockAdjustments := make(map[uint]int, len(coffeeCounts))
+	for coffeeId, count := range coffeeCounts {
+		stockAdjustments[coffeeId] = -count
+	}
+	if err := sr.coffeeRepository.AdjustStock(tx, stockAdjustments); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error updating stock")
+		util.RespondError(w, err)
+		return
+	}
+
 	purchase := models.Transaction{
-		UserId: userId,
+		UserId: principal.UserId,
 		Items:  purchaseItems,
 		Total:  totalPrice,
 	}
 
 	err = sr.purchaseRepository.CreateTransaction(tx, &purchase)
 	if err != nil {
+		tx.Rollback()
 		logger.WithError(err).Warn()
-		util.Respond(w, http.StatusInternalServerError, util.Message(err.Error()))
+		util.RespondError(w, err)
 		return
 	}
 
-	tx.Commit()
-	util.Respond(w, http.StatusOK, util.Message("Purchase Confirmed"))
+	dbtx.Commit(tx)
+	metrics.PurchasePlaced()
+
+	if reqData.EmailReceipt && sr.mailer != nil {
+		transactionId := purchase.ID
+		sr.workers.Go("EmailReceipt", func(ctx context.Context) {
+			sr.emailReceipt(ctx, transactionId)
+		})
+	}
+
+	util.Respond(w, http.StatusOK, &purchasestypes.PurchaseConfirmedResponse{
+		Message:       "Purchase Confirmed",
+		TransactionId: purchase.ID,
+		Total:         purchase.Total,
+	})
 }
 
 func (sr *PurchaseSubRouter) PurchaseHistoryHandler(w http.ResponseWriter, r *http.Request) {
@@ -168,71 +265,366 @@ func (sr *PurchaseSubRouter) PurchaseHistoryHandler(w http.ResponseWriter, r *ht
 	vars := mux.Vars(r)
 	requestedUserId := vars["userId"]
 
-	userId, ok := r.Context().Value("user").(uuid.UUID)
-	if !ok {
-		logger.Warn("Error parsing uuid")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Error parsing user id path"))
-		return
-	}
-	role, ok := r.Context().Value("role").(string)
-	if !ok {
-		logger.Warn("Error parsing role")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Invalid role"))
-		return
-	}
-	if role != "admin" && userId.String() != requestedUserId {
-		logger.Warn("Unauthorized user")
-		util.Respond(w, http.StatusUnauthorized, util.Message("You can't view this information"))
+	pageQuery, err := util.ParsePageQuery(r, pageSize, sr.maxPageSize)
+	if err != nil {
+		logger.WithError(err).Warn()
+		util.RespondError(w, err)
 		return
 	}
 
-	pageNum := 0
-	pageNumQuery := r.URL.Query().Get("page")
-	if pageNumInt, err := strconv.Atoi(pageNumQuery); err == nil {
-		pageNum = pageNumInt - 1
-	}
-
-	sortKey := "created_at"
+	sortKey := listing.PurchaseSortCreatedAt
 	sortDirection := "DESC"
 	query := repository_interfaces.PurchasePageQuery{
-		UserId:        &requestedUserId,
+		PurchaseFilter: listing.PurchaseFilter{
+			UserId: &requestedUserId,
+		},
 		Sort:          &sortKey,
 		SortDirection: &sortDirection,
 	}
-	query.Page = pageNum
-	query.PageSize = pageSize
+	query.PageQuery = pageQuery
 
 	tx := sr.Db.Begin()
-	dbPurchases, err := sr.purchaseRepository.GetTransactionsPaginated(tx, &query)
+	dbPurchases, pageInfo, err := sr.purchaseRepository.GetTransactionsPaginated(tx, &query)
 	if err != nil {
 		tx.Rollback()
 		logger.WithError(err).Warn("Error retrieving values")
-		util.Respond(w, http.StatusInternalServerError, util.Message("Internal Error"))
-		return
-	}
-	tx.Commit()
-
-	if len(dbPurchases) == 0 {
-		logger.Warn("purchases not found")
-		util.Respond(w, http.StatusNotFound, util.Message("Couldn't find any purchases"))
+		util.RespondError(w, err)
 		return
 	}
+	dbtx.Commit(tx)
 
-	purchases := make([]*PurchaseHistoryResponse, 0, len(dbPurchases))
+	purchases := make([]*purchasestypes.PurchaseHistoryResponse, 0, len(dbPurchases))
 	for _, purchase := range dbPurchases {
-		purchaseItem := PurchaseHistoryResponse{
+		purchaseItem := purchasestypes.PurchaseHistoryResponse{
 			ID:            purchase.ID,
 			AmountPaid:    purchase.AmountPaid,
 			Total:         purchase.Total,
 			CreatedAt:     purchase.CreatedAt,
+			Status:        purchase.Status,
+			CancelledAt:   purchase.CancelledAt,
 			PurchaseItems: purchase.Items,
 		}
 		purchases = append(purchases, &purchaseItem)
 	}
 
-	response := util.Message("Purchases successfully queried")
-	response["purchases"] = purchases
-	response["page_size"] = len(purchases)
+	util.Respond(w, http.StatusOK, util.NewListResponse("Purchases successfully queried", purchases, query.PageSize, pageInfo))
+}
+
+func (sr *PurchaseSubRouter) CancelPurchaseHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "CancelPurchaseHandler",
+		"method":  r.Method,
+	})
+	vars := mux.Vars(r)
+	requestedTransaction := vars["transactionId"]
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		logger.Warn("Missing principal")
+		util.RespondError(w, util.InternalError())
+		return
+	}
+
+	// reason is optional for users
+	var reqData purchasestypes.CancelRequest
+	if r.ContentLength != 0 {
+		if err := util.DecodeJSON(w, r, &reqData); err != nil {
+			logger.WithError(err).Warn()
+			util.RespondError(w, err)
+			return
+		}
+	}
+
+	tx := sr.Db.Begin()
+	transaction, err := sr.purchaseRepository.GetTransactionForUpdate(tx, requestedTransaction)
+	if err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			util.RespondError(w, util.NotFound("Transaction not found"))
+			return
+		}
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	if !principal.HasPermission(models.PermissionOrdersCancel) {
+		if transaction.UserId != principal.UserId {
+			tx.Rollback()
+			logger.Warn("Forbidden user")
+			util.RespondError(w, util.Forbidden("You can't cancel this purchase"))
+			return
+		}
+		if time.Since(transaction.CreatedAt) > sr.cancellationWindow {
+			tx.Rollback()
+			util.RespondError(w, util.Forbidden("Cancellation window has passed"))
+			return
+		}
+		// customers can't cancel once the order is being made
+		if !transaction.IsCancelled() && transaction.Status != models.TransactionStatusPlaced {
+			tx.Rollback()
+			util.RespondError(w, util.Conflict("Purchase is already being prepared"))
+			return
+		}
+	}
+
+	before := *transaction
+	if err := sr.purchaseRepository.CancelTransaction(tx, transaction, principal.UserId, reqData.Reason); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error cancelling purchase")
+		util.RespondError(w, err)
+		return
+	}
+	if err := sr.auditRecorder.Record(tx, r, &audit.Event{
+		Action:     models.AuditPurchaseCancel,
+		EntityType: models.AuditEntityPurchase,
+		EntityId:   requestedTransaction,
+		Before:     &before,
+		After:      transaction,
+	}); err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error writing audit event")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	util.Respond(w, http.StatusOK, util.Message("Purchase cancelled"))
+}
+
+func (sr *PurchaseSubRouter) PurchaseDetailHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "PurchaseDetailHandler",
+		"method":  r.Method,
+	})
+	vars := mux.Vars(r)
+	requestedTransaction := vars["transactionId"]
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		logger.Warn("Missing principal")
+		util.RespondError(w, util.InternalError())
+		return
+	}
+
+	tx := sr.Db.Begin()
+	transactionsMap, err := sr.purchaseRepository.GetTransactionsByIds(tx, []string{requestedTransaction})
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	transaction, doesTxExist := transactionsMap[requestedTransaction]
+	if !doesTxExist {
+		tx.Rollback()
+		util.RespondError(w, util.NotFound("Transaction not found"))
+		return
+	}
+
+	if !principal.CanAccess(transaction.UserId, models.PermissionOrdersRead) {
+		tx.Rollback()
+		logger.Warn("Forbidden user")
+		util.RespondError(w, util.Forbidden("You can't view this information"))
+		return
+	}
+
+	items, err := sr.purchaseRepository.GetTransactionItemDetails(tx, requestedTransaction)
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
 
-	util.Respond(w, http.StatusOK, response)
+	payments, err := sr.purchaseRepository.GetTransactionPayments(tx, requestedTransaction)
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	purchase := purchasestypes.PurchaseDetailResponse{
+		ID:                 transaction.ID,
+		UserId:             transaction.UserId,
+		Status:             transaction.Status,
+		AmountPaid:         transaction.AmountPaid,
+		Total:              transaction.Total,
+		CreatedAt:          transaction.CreatedAt,
+		CancelledAt:        transaction.CancelledAt,
+		CancellationReason: transaction.CancellationReason,
+		Items:              make([]*purchasestypes.PurchaseDetailItem, 0, len(items)),
+		Payments:           make([]*purchasestypes.PurchasePayment, 0, len(payments)),
+	}
+	for _, item := range items {
+		purchase.Items = append(purchase.Items, &purchasestypes.PurchaseDetailItem{
+			CoffeeId:   item.CoffeeId,
+			CoffeeName: item.CoffeeName,
+			Price:      item.Price,
+			Options:    item.TypeOption,
+		})
+	}
+	for _, payment := range payments {
+		purchase.Payments = append(purchase.Payments, &purchasestypes.PurchasePayment{
+			Amount:     payment.Amount,
+			Kind:       payment.Kind,
+			Note:       payment.Note,
+			RecordedAt: payment.CreatedAt,
+		})
+	}
+
+	util.Respond(w, http.StatusOK, &purchasestypes.GetPurchaseResponse{
+		Message:  "Purchase successfully queried",
+		Purchase: &purchase,
+	})
+}
+
+func (sr *PurchaseSubRouter) ReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	logger := log.WithFields(log.Fields{
+		"request": "ReceiptHandler",
+		"method":  r.Method,
+	})
+	vars := mux.Vars(r)
+	requestedTransaction := vars["transactionId"]
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		logger.Warn("Missing principal")
+		util.RespondError(w, util.InternalError())
+		return
+	}
+
+	tx := sr.Db.Begin()
+	transactionsMap, err := sr.purchaseRepository.GetTransactionsByIds(tx, []string{requestedTransaction})
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+
+	transaction, doesTxExist := transactionsMap[requestedTransaction]
+	if !doesTxExist {
+		tx.Rollback()
+		util.RespondError(w, util.NotFound("Transaction not found"))
+		return
+	}
+
+	if !principal.CanAccess(transaction.UserId, models.PermissionOrdersRead) {
+		tx.Rollback()
+		logger.Warn("Forbidden user")
+		util.RespondError(w, util.Forbidden("You can't view this information"))
+		return
+	}
+
+	receipt, err := sr.buildReceipt(tx, transaction)
+	if err != nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Database Error")
+		util.RespondError(w, err)
+		return
+	}
+	dbtx.Commit(tx)
+
+	// render before writing headers so errors can still be reported
+	var body bytes.Buffer
+	var contentType string
+	switch r.URL.Query().Get("format") {
+	case "", "html":
+		contentType = "text/html; charset=utf-8"
+		err = sr.receiptGenerator.HTML(&body, receipt)
+	case "text":
+		contentType = "text/plain; charset=utf-8"
+		err = sr.receiptGenerator.Text(&body, receipt)
+	case "pdf":
+		contentType = "application/pdf"
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=receipt-%d.pdf", transaction.ID))
+		err = sr.receiptGenerator.PDF(&body, receipt)
+	default:
+		util.RespondError(w, util.BadRequest("Invalid receipt format"))
+		return
+	}
+	if err != nil {
+		logger.WithError(err).Warn("Error rendering receipt")
+		util.RespondError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := body.WriteTo(w); err != nil {
+		logger.WithError(err).Warn()
+	}
+}
+
+func (sr *PurchaseSubRouter) buildReceipt(tx *gorm.DB, transaction *models.Transaction) (*receipts.Receipt, error) {
+	transactionId := strconv.FormatUint(uint64(transaction.ID), 10)
+	items, err := sr.purchaseRepository.GetTransactionItemDetails(tx, transactionId)
+	if err != nil {
+		return nil, err
+	}
+
+	usersMap, err := sr.userRepository.GetUsersByIds(tx, []string{transaction.UserId.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	return receipts.New(sr.shopName, transaction, items, usersMap[transaction.UserId.String()]), nil
+}
+
+// emailReceipt sends the receipt for a committed transaction to its owner,
+// failures are only logged since the purchase has already gone through. It
+// gives up when ctx is cancelled on shutdown.
+func (sr *PurchaseSubRouter) emailReceipt(ctx context.Context, transactionId uint) {
+	logger := log.WithFields(log.Fields{
+		"request":       "EmailReceipt",
+		"transactionId": transactionId,
+	})
+
+	tx := sr.Db.BeginTx(ctx, nil)
+	id := strconv.FormatUint(uint64(transactionId), 10)
+	transactionsMap, err := sr.purchaseRepository.GetTransactionsByIds(tx, []string{id})
+	if err != nil || transactionsMap[id] == nil {
+		tx.Rollback()
+		logger.WithError(err).Warn("Error retrieving transaction")
+		return
+	}
+
+	receipt, err := sr.buildReceipt(tx, transactionsMap[id])
+	dbtx.Commit(tx)
+	if err != nil {
+		logger.WithError(err).Warn("Error building receipt")
+		return
+	}
+	if receipt.CustomerEmail == "" {
+		logger.Warn("Customer has no email")
+		return
+	}
+
+	var html, text bytes.Buffer
+	if err := sr.receiptGenerator.HTML(&html, receipt); err != nil {
+		logger.WithError(err).Warn("Error rendering receipt")
+		return
+	}
+	if err := sr.receiptGenerator.Text(&text, receipt); err != nil {
+		logger.WithError(err).Warn("Error rendering receipt")
+		return
+	}
+
+	if ctx.Err() != nil {
+		logger.WithError(ctx.Err()).Warn("Not sending receipt")
+		return
+	}
+	err = sr.mailer.Send(&mailer.Message{
+		To:      []string{receipt.CustomerEmail},
+		Subject: fmt.Sprintf("%s receipt #%d", receipt.ShopName, receipt.TransactionId),
+		Text:    text.String(),
+		HTML:    html.String(),
+	})
+	if err != nil {
+		logger.WithError(err).Warn("Error sending receipt")
+	}
 }
@@ -0,0 +1,73 @@
+// Package purchasestypes holds the request and response bodies of the
+// /purchase routes. They live outside of the purchases package so clients
+// like pkg/client can use them.
+package purchasestypes
+
+import (
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/google/uuid"
+)
+
+type PurchaseItem struct {
+	CoffeeId      uint   `json:"coffeeId" validate:"required"`
+	CoffeeOptions string `json:"options" validate:"max=255"`
+}
+
+type PurchaseRequest struct {
+	Coffees      []PurchaseItem `json:"items" validate:"min=1,max=100,dive"`
+	EmailReceipt bool           `json:"emailReceipt"`
+}
+
+type CancelRequest struct {
+	Reason string `json:"reason" validate:"max=1000"`
+}
+
+type PurchaseHistoryResponse struct {
+	ID            uint                   `json:"transactionId"`
+	AmountPaid    float64                `json:"amountPaid"`
+	Total         float64                `json:"total"`
+	CreatedAt     time.Time              `json:"purchaseDate"`
+	Status        string                 `json:"status"`
+	CancelledAt   *time.Time             `json:"cancelledAt,omitempty"`
+	PurchaseItems []*models.PurchaseItem `json:"items"`
+}
+
+type PurchaseDetailItem struct {
+	CoffeeId   uint    `json:"coffeeId"`
+	CoffeeName string  `json:"coffeeName"`
+	Price      float64 `json:"price"`
+	Options    string  `json:"options"`
+}
+
+type PurchasePayment struct {
+	Amount     float64   `json:"amount"`
+	Kind       string    `json:"kind"`
+	Note       string    `json:"note,omitempty"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+type PurchaseConfirmedResponse struct {
+	Message       string  `json:"message"`
+	TransactionId uint    `json:"transactionId"`
+	Total         float64 `json:"total"`
+}
+
+type GetPurchaseResponse struct {
+	Message  string                  `json:"message"`
+	Purchase *PurchaseDetailResponse `json:"purchase"`
+}
+
+type PurchaseDetailResponse struct {
+	ID                 uint                  `json:"transactionId"`
+	UserId             uuid.UUID             `json:"userId"`
+	Status             string                `json:"status"`
+	AmountPaid         float64               `json:"amountPaid"`
+	Total              float64               `json:"total"`
+	CreatedAt          time.Time             `json:"purchaseDate"`
+	CancelledAt        *time.Time            `json:"cancelledAt,omitempty"`
+	CancellationReason string                `json:"cancellationReason,omitempty"`
+	Items              []*PurchaseDetailItem `json:"items"`
+	Payments           []*PurchasePayment    `json:"payments"`
+}
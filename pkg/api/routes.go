@@ -1,51 +1,139 @@
 package api
 
 import (
+	"errors"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/audit"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/api/auth"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/health"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/api/internal"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/api/menu"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/api/purchases"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/background"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/cache"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/config"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/mailer"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/metrics"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/oidc"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/ratelimit"
 	repository "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/impl"
 	"github.com/go-redis/redis/v7"
 
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
 )
 
 type Server struct {
 	Router *mux.Router
 }
 
-func NewServer(router *mux.Router, db *gorm.DB, redis *redis.Client) error {
+// NewServer sets up every module on router as configured by cfg, work started
+// in the background is tracked by workers so it can be waited for on shutdown
+func NewServer(cfg *config.Config, router *mux.Router, db *gorm.DB, redis *redis.Client, mailer mailer.Mailer, workers *background.Workers) error {
+	if cfg == nil {
+		err := errors.New("config is nil")
+		log.WithError(err).Warn()
+		return err
+	}
+
 	server := Server{
 		Router: router,
 	}
 
+	// every request gets an id to correlate logs and audit events
+	server.Router.Use(util.RequestIDMiddleware)
+	server.Router.Use(metrics.Middleware)
+
+	// redis, memory or no cache as configured, redis is optional
+	menuCache, err := cache.New(cfg.Cache, redis)
+	if err != nil {
+		return err
+	}
+
 	// Repository setups
-	coffeeRepository := repository.NewCoffeeRepository(db, redis)
-	transactionRepository := repository.NewTransactionsRepository(db)
+	coffeeRepository := repository.NewCoffeeRepository(db, menuCache, cfg.MenuCacheTTL())
+	transactionRepository := repository.NewTransactionsRepository(db, coffeeRepository)
 	userRepository := repository.NewUserRepository(db)
+	apiKeyRepository := repository.NewAPIKeyRepository(db)
+	auditRepository := repository.NewAuditRepository(db)
+
+	// shared by every module with authenticated routes
+	authMiddleware := auth.NewMiddleware(db, userRepository, apiKeyRepository, cfg.Auth)
+
+	// counters are kept in redis so limits apply across instances, each
+	// module sets its own default limits which the config overrides
+	rateLimits, err := ratelimit.ParseOverrides(cfg.RateLimits)
+	if err != nil {
+		return err
+	}
+	rateLimitStore := ratelimit.NewStore(redis)
+	rateLimiter := ratelimit.NewLimiter(rateLimitStore, auth.RateLimitKey, rateLimits)
+
+	// administrative and security sensitive changes are recorded against the
+	// authenticated principal
+	auditRecorder := audit.NewRecorder(auditRepository, auth.AuditActor)
+
+	// every module documents its routes, the spec is served at /openapi.json
+	spec := openapi.New(openapi.Info{
+		Title:   "Dollar Coffee API",
+		Version: apiVersion,
+	}, utiltypes.APIError{}, models.ValidationEnums())
 
 	// module setups
-	err := menu.Setup(server.Router, db, coffeeRepository)
+	err = menu.Setup(server.Router, db, rateLimiter, spec, coffeeRepository, cfg.API.MaxPageSize)
 	if err != nil {
 		return err
 	}
 
-	err = purchases.Setup(server.Router, db, coffeeRepository, transactionRepository)
+	err = purchases.Setup(server.Router, db, authMiddleware, rateLimiter, spec, coffeeRepository, transactionRepository, userRepository, auditRecorder, mailer, workers, cfg)
 	if err != nil {
 		return err
 	}
 
-	err = auth.Setup(server.Router, db, userRepository)
+	oidcProviders := oidc.NewProviders(oidcConfigs(cfg.Auth.OIDC), nil)
+
+	// failed logins are counted in redis so limits apply across instances
+	loginLimits := auth.DefaultLoginLimits()
+	loginLimits.MaxAccountFailures = cfg.Auth.LoginMaxFailures
+	loginLimits.Lockout = cfg.Auth.LoginLockout
+	loginLimiter := auth.NewLoginLimiter(rateLimitStore, loginLimits)
+
+	err = auth.Setup(server.Router, db, authMiddleware, rateLimiter, spec, userRepository, oidcProviders, loginLimiter, auditRecorder, cfg)
 	if err != nil {
 		return err
 	}
 
-	err = internal.Setup(server.Router, db, coffeeRepository, transactionRepository, userRepository)
+	err = internal.Setup(server.Router, db, authMiddleware, rateLimiter, spec, coffeeRepository, transactionRepository, userRepository, apiKeyRepository, auditRepository, auditRecorder, cfg.API.MaxPageSize)
 	if err != nil {
 		return err
 	}
 
+	err = health.Setup(server.Router, spec, health.DatabaseCheck(db), health.RedisCheck(redis))
+	if err != nil {
+		return err
+	}
+
+	setupDocs(server.Router, spec, cfg.API.SwaggerUI)
+
 	return nil
 }
+
+func oidcConfigs(providers []config.OIDCProvider) []oidc.Config {
+	configs := make([]oidc.Config, 0, len(providers))
+	for _, provider := range providers {
+		configs = append(configs, oidc.Config{
+			Name:         provider.Name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectURL,
+			Scopes:       provider.Scopes,
+		})
+	}
+	return configs
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/background"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/config"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig is the default config with the required secrets
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Auth.TokenSecret = "test secret"
+	cfg.Database.URL = "postgres://localhost/test"
+	cfg.Redis.URL = "redis://localhost:6379"
+	return cfg
+}
+
+// newTestRouter sets up every route, the db and redis aren't used until
+// requests are handled
+func newTestRouter(t *testing.T, cfg *config.Config) *mux.Router {
+	router := mux.NewRouter()
+	require.NoError(t, NewServer(cfg, router, &gorm.DB{}, nil, nil, background.NewWorkers()))
+	return router
+}
+
+// routeOperations lists "METHOD /path" for every route with methods, in the
+// same format as openapi.Document.Operations
+func routeOperations(t *testing.T, router *mux.Router) []string {
+	operations := []string{}
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// path prefixes of subrouters
+			return nil
+		}
+		path := openapi.PathTemplate(template)
+		for _, method := range methods {
+			operations = append(operations, method+" "+path)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(operations)
+	return operations
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	for _, swaggerUI := range []bool{false, true} {
+		cfg := testConfig()
+		cfg.API.SwaggerUI = swaggerUI
+		router := newTestRouter(t, cfg)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var document openapi.Document
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+
+		// every route has to be documented and every documented route has to
+		// exist, add an openapi.Route where the route is registered
+		assert.Equal(t, routeOperations(t, router), document.Operations(), "SwaggerUI=%t", swaggerUI)
+	}
+}
+
+func TestOpenAPIReferencesExist(t *testing.T) {
+	router := newTestRouter(t, testConfig())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var document openapi.Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+
+	for _, ref := range document.References() {
+		name := ref[len("#/components/schemas/"):]
+		assert.Contains(t, document.Components.Schemas, name, ref)
+	}
+}
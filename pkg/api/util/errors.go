@@ -0,0 +1,117 @@
+package util
+
+import (
+	"net/http"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+func NewError(status int, code utiltypes.ErrorCode, message string) *utiltypes.APIError {
+	return &utiltypes.APIError{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func BadRequest(message string) *utiltypes.APIError {
+	return NewError(http.StatusBadRequest, utiltypes.CodeBadRequest, message)
+}
+
+// InvalidJSON is returned for bodies that can't be decoded, decoder errors
+// aren't shown to clients
+func InvalidJSON() *utiltypes.APIError {
+	return NewError(http.StatusBadRequest, utiltypes.CodeInvalidJSON, "Invalid request body")
+}
+
+func ValidationFailed(details ...utiltypes.FieldError) *utiltypes.APIError {
+	return NewError(http.StatusBadRequest, utiltypes.CodeValidationFailed, "Invalid request").WithDetails(details...)
+}
+
+func Unauthorized(message string) *utiltypes.APIError {
+	return NewError(http.StatusUnauthorized, utiltypes.CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *utiltypes.APIError {
+	return NewError(http.StatusForbidden, utiltypes.CodeForbidden, message)
+}
+
+func NotFound(message string) *utiltypes.APIError {
+	return NewError(http.StatusNotFound, utiltypes.CodeNotFound, message)
+}
+
+func Conflict(message string) *utiltypes.APIError {
+	return NewError(http.StatusConflict, utiltypes.CodeConflict, message)
+}
+
+func TooManyRequests(message string) *utiltypes.APIError {
+	return NewError(http.StatusTooManyRequests, utiltypes.CodeRateLimited, message)
+}
+
+func BadGateway(message string) *utiltypes.APIError {
+	return NewError(http.StatusBadGateway, utiltypes.CodeBadGateway, message)
+}
+
+func InternalError() *utiltypes.APIError {
+	return NewError(http.StatusInternalServerError, utiltypes.CodeInternal, "Internal Error")
+}
+
+// postgres error codes, https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqInvalidTextRepresentation pq.ErrorCode = "22P02"
+	pqForeignKeyViolation       pq.ErrorCode = "23503"
+	pqUniqueViolation           pq.ErrorCode = "23505"
+	pqCheckViolation            pq.ErrorCode = "23514"
+)
+
+// FromError maps errors returned by repositories to API errors. Unknown
+// errors become internal errors so database details never reach clients.
+func FromError(err error) *utiltypes.APIError {
+	if apiErr, ok := err.(*utiltypes.APIError); ok {
+		return apiErr
+	}
+
+	switch err {
+	case gorm.ErrRecordNotFound:
+		return NotFound("Not found")
+	case listing.ErrInvalidSort, listing.ErrCursorSort:
+		return BadRequest(err.Error())
+	case repository_interfaces.ErrOutOfStock:
+		return NewError(http.StatusConflict, utiltypes.CodeOutOfStock, "Not enough stock")
+	case repository_interfaces.ErrAlreadyCancelled:
+		return Conflict("Transaction is already cancelled")
+	case ErrInvalidCursor:
+		return NewError(http.StatusBadRequest, utiltypes.CodeInvalidCursor, "Invalid cursor")
+	}
+
+	if validationErrs, ok := err.(validator.ValidationErrors); ok {
+		return validationFailed(validationErrs)
+	}
+
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch pqErr.Code {
+		case pqInvalidTextRepresentation:
+			// malformed ids from the path, e.g. a user id that isn't a uuid
+			return BadRequest("Invalid id")
+		case pqUniqueViolation:
+			return Conflict("Already exists")
+		case pqForeignKeyViolation:
+			return Conflict("Still referenced by other records")
+		case pqCheckViolation:
+			return NewError(http.StatusBadRequest, utiltypes.CodeValidationFailed, "Invalid value")
+		}
+	}
+
+	return InternalError()
+}
+
+// RespondError writes err as a utiltypes.APIError, see FromError
+func RespondError(w http.ResponseWriter, err error) {
+	apiErr := FromError(err)
+	Respond(w, apiErr.Status, apiErr)
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   utiltypes.ErrorCode
+	}{
+		{Forbidden("nope"), http.StatusForbidden, utiltypes.CodeForbidden},
+		{gorm.ErrRecordNotFound, http.StatusNotFound, utiltypes.CodeNotFound},
+		{listing.ErrInvalidSort, http.StatusBadRequest, utiltypes.CodeBadRequest},
+		{repository_interfaces.ErrOutOfStock, http.StatusConflict, utiltypes.CodeOutOfStock},
+		{repository_interfaces.ErrAlreadyCancelled, http.StatusConflict, utiltypes.CodeConflict},
+		{ErrInvalidCursor, http.StatusBadRequest, utiltypes.CodeInvalidCursor},
+		{&pq.Error{Code: "22P02"}, http.StatusBadRequest, utiltypes.CodeBadRequest},
+		{&pq.Error{Code: "23505"}, http.StatusConflict, utiltypes.CodeConflict},
+		{&pq.Error{Code: "23503"}, http.StatusConflict, utiltypes.CodeConflict},
+		{&pq.Error{Code: "23514"}, http.StatusBadRequest, utiltypes.CodeValidationFailed},
+		{&pq.Error{Code: "42P01", Message: `relation "coffees" does not exist`}, http.StatusInternalServerError, utiltypes.CodeInternal},
+		{errors.New("connection refused"), http.StatusInternalServerError, utiltypes.CodeInternal},
+	}
+
+	for _, c := range cases {
+		apiErr := FromError(c.err)
+		assert.Equal(t, c.status, apiErr.Status, c.err.Error())
+		assert.Equal(t, c.code, apiErr.Code, c.err.Error())
+	}
+
+	// internal details aren't exposed
+	assert.Equal(t, "Internal Error", FromError(errors.New("pq: password authentication failed")).Message)
+}
+
+func TestWithDetailsCopies(t *testing.T) {
+	base := ValidationFailed(utiltypes.FieldError{Field: "email", Message: "is required"})
+	withMore := base.WithDetails(utiltypes.FieldError{Field: "price", Message: "must not be negative"})
+
+	assert.Len(t, base.Details, 1)
+	assert.Len(t, withMore.Details, 2)
+}
+
+func TestRespondError(t *testing.T) {
+	w := httptest.NewRecorder()
+	RespondError(w, ValidationFailed(utiltypes.FieldError{Field: "price", Message: "must not be negative"}))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "validation_failed", body["code"])
+	assert.Equal(t, "Invalid request", body["message"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"field": "price", "message": "must not be negative"},
+	}, body["details"])
+	_, hasStatus := body["status"]
+	assert.False(t, hasStatus)
+
+	// details are omitted when empty
+	w = httptest.NewRecorder()
+	RespondError(w, gorm.ErrRecordNotFound)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"code":"not_found","message":"Not found"}`, w.Body.String())
+}
@@ -0,0 +1,115 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type cursorToken struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// EncodeCursor turns a cursor into an opaque page token for clients
+func EncodeCursor(cursor *listing.Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+	token, _ := json.Marshal(cursorToken{
+		CreatedAt: cursor.CreatedAt,
+		ID:        cursor.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func DecodeCursor(token string) (*listing.Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor cursorToken
+	if err := json.Unmarshal(decoded, &cursor); err != nil || cursor.ID == "" || cursor.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+
+	return &listing.Cursor{
+		CreatedAt: cursor.CreatedAt,
+		ID:        cursor.ID,
+	}, nil
+}
+
+// ParsePageQuery reads the page number, page size and cursor query parameters
+// of a list request. Page sizes are clamped to maxPageSize.
+func ParsePageQuery(r *http.Request, defaultPageSize int, maxPageSize int) (repository_interfaces.PageQuery, error) {
+	query := repository_interfaces.PageQuery{
+		PageSize: defaultPageSize,
+	}
+
+	if pageSizeInt, err := strconv.Atoi(r.URL.Query().Get("page_size")); err == nil && pageSizeInt > 0 {
+		query.PageSize = pageSizeInt
+	}
+	if query.PageSize > maxPageSize {
+		query.PageSize = maxPageSize
+	}
+
+	if pageNumInt, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && pageNumInt > 0 {
+		query.Page = pageNumInt - 1
+	}
+
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		cursor, err := DecodeCursor(token)
+		if err != nil {
+			return query, err
+		}
+		query.Cursor = cursor
+	}
+
+	return query, nil
+}
+
+// ListOf documents a list response with items of the slice type of items,
+// e.g. ListOf([]CoffeeResponse{})
+func ListOf(items interface{}) openapi.Override {
+	return openapi.Override{
+		Value:      utiltypes.ListResponse{},
+		Properties: map[string]interface{}{"items": items},
+	}
+}
+
+// PageParameters documents the paging parameters read by ParsePageQuery
+func PageParameters() []*openapi.Parameter {
+	return []*openapi.Parameter{
+		openapi.Query("page", "integer", "Page number starting at 1, ignored when a cursor is given"),
+		openapi.Query("page_size", "integer", "Items per page, clamped to the server maximum"),
+		openapi.Query("cursor", "string", "next_cursor of the previous page"),
+	}
+}
+
+func NewListResponse(message string, items interface{}, pageSize int, pageInfo *repository_interfaces.PageInfo) *utiltypes.ListResponse {
+	totalPages := 0
+	if pageSize > 0 {
+		totalPages = (pageInfo.TotalCount + pageSize - 1) / pageSize
+	}
+
+	return &utiltypes.ListResponse{
+		Message:    message,
+		Items:      items,
+		PageSize:   pageSize,
+		TotalCount: pageInfo.TotalCount,
+		TotalPages: totalPages,
+		HasMore:    pageInfo.HasMore,
+		NextCursor: EncodeCursor(pageInfo.NextCursor),
+	}
+}
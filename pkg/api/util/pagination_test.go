@@ -0,0 +1,86 @@
+package util
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := listing.Cursor{
+		CreatedAt: time.Date(2019, 10, 2, 9, 30, 0, 123456000, time.UTC),
+		ID:        "42",
+	}
+
+	decoded, err := DecodeCursor(EncodeCursor(&cursor))
+	require.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.ID, decoded.ID)
+
+	assert.Equal(t, "", EncodeCursor(nil))
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	for _, token := range []string{"not a cursor", "e30", "eyJpZCI6IjEifQ"} {
+		_, err := DecodeCursor(token)
+		assert.Equal(t, ErrInvalidCursor, err, token)
+	}
+}
+
+func TestParsePageQuery(t *testing.T) {
+	query, err := ParsePageQuery(httptest.NewRequest("GET", "/menu?page=3", nil), 10, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 2, query.Page)
+	assert.Equal(t, 10, query.PageSize)
+	assert.Nil(t, query.Cursor)
+
+	query, err = ParsePageQuery(httptest.NewRequest("GET", "/menu?page=0", nil), 10, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 0, query.Page)
+
+	token := EncodeCursor(&listing.Cursor{CreatedAt: time.Now(), ID: "1"})
+	query, err = ParsePageQuery(httptest.NewRequest("GET", "/menu?cursor="+token, nil), 10, 100)
+	require.NoError(t, err)
+	require.NotNil(t, query.Cursor)
+	assert.Equal(t, "1", query.Cursor.ID)
+
+	_, err = ParsePageQuery(httptest.NewRequest("GET", "/menu?cursor=garbage", nil), 10, 100)
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestParsePageSize(t *testing.T) {
+	query, err := ParsePageQuery(httptest.NewRequest("GET", "/menu?page_size=25", nil), 10, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 25, query.PageSize)
+
+	query, err = ParsePageQuery(httptest.NewRequest("GET", "/menu?page_size=100000", nil), 10, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 100, query.PageSize)
+
+	query, err = ParsePageQuery(httptest.NewRequest("GET", "/menu?page_size=-1", nil), 10, 100)
+	require.NoError(t, err)
+	assert.Equal(t, 10, query.PageSize)
+}
+
+func TestNewListResponse(t *testing.T) {
+	pageInfo := repository_interfaces.PageInfo{
+		TotalCount: 21,
+		HasMore:    true,
+		NextCursor: &listing.Cursor{CreatedAt: time.Now(), ID: "10"},
+	}
+
+	response := NewListResponse("", []int{1, 2}, 10, &pageInfo)
+	assert.Equal(t, 3, response.TotalPages)
+	assert.Equal(t, 21, response.TotalCount)
+	assert.True(t, response.HasMore)
+	assert.NotEmpty(t, response.NextCursor)
+
+	empty := NewListResponse("", []int{}, 10, &repository_interfaces.PageInfo{})
+	assert.Equal(t, 0, empty.TotalPages)
+	assert.Empty(t, empty.NextCursor)
+}
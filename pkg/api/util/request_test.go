@@ -0,0 +1,41 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var requestID string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = RequestIDFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, "abc-123", requestID)
+	assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+
+	// ids that aren't safe to log are replaced
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.NotEqual(t, "bad id\n", requestID)
+	assert.Len(t, requestID, 36)
+	assert.Equal(t, requestID, w.Header().Get(RequestIDHeader))
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "10.0.0.1", ClientIP(r))
+
+	r.RemoteAddr = "[::1]:1234"
+	assert.Equal(t, "::1", ClientIP(r))
+}
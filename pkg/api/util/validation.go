@@ -0,0 +1,188 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// MaxBodyBytes is the largest JSON body handlers accept
+var MaxBodyBytes int64 = 1 << 20
+
+// DecodeJSON decodes the request body into dst and checks its validate tags.
+// Unknown fields, trailing data and bodies over MaxBodyBytes are rejected.
+// Errors are APIErrors that can be passed to RespondError.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		if err != nil && isBodyTooLarge(err) {
+			return bodyTooLarge()
+		}
+		return NewError(http.StatusBadRequest, utiltypes.CodeInvalidJSON, "Request body must be a single JSON object")
+	}
+
+	if err := models.Validate(dst); err != nil {
+		return FromError(err)
+	}
+	return nil
+}
+
+func decodeError(err error) *utiltypes.APIError {
+	if isBodyTooLarge(err) {
+		return bodyTooLarge()
+	}
+
+	switch err := err.(type) {
+	case *json.UnmarshalTypeError:
+		return InvalidJSON().WithDetails(utiltypes.FieldError{
+			Field:   err.Field,
+			Message: "must be " + jsonTypeName(err.Type.Kind().String()),
+		})
+	}
+
+	// encoding/json has no type for unknown fields
+	if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return InvalidJSON().WithDetails(utiltypes.FieldError{
+			Field:   field,
+			Message: "is not a known field",
+		})
+	}
+
+	if err == io.EOF {
+		return NewError(http.StatusBadRequest, utiltypes.CodeInvalidJSON, "Request body is empty")
+	}
+	return InvalidJSON()
+}
+
+// MaxBytesReader only returns a plain error
+func isBodyTooLarge(err error) bool {
+	return err.Error() == "http: request body too large"
+}
+
+func bodyTooLarge() *utiltypes.APIError {
+	return NewError(http.StatusRequestEntityTooLarge, utiltypes.CodeBodyTooLarge,
+		fmt.Sprintf("Request body can't be larger than %d bytes", MaxBodyBytes))
+}
+
+func jsonTypeName(kind string) string {
+	switch kind {
+	case "string":
+		return "a string"
+	case "bool":
+		return "a boolean"
+	case "slice", "array":
+		return "an array"
+	case "struct", "map":
+		return "an object"
+	case "float32", "float64":
+		return "a number"
+	}
+	if strings.HasPrefix(kind, "int") || strings.HasPrefix(kind, "uint") {
+		return "an integer"
+	}
+	return "a " + kind
+}
+
+// validationFailed lists every failed validate tag by the field's json path,
+// e.g. items[0].coffeeId
+func validationFailed(errs validator.ValidationErrors) *utiltypes.APIError {
+	details := make([]utiltypes.FieldError, 0, len(errs))
+	for _, fieldErr := range errs {
+		field := fieldErr.Namespace()
+		// drop the struct name
+		if i := strings.Index(field, "."); i >= 0 {
+			field = field[i+1:]
+		}
+		details = append(details, utiltypes.FieldError{
+			Field:   field,
+			Message: validationMessage(fieldErr),
+		})
+	}
+	return ValidationFailed(details...)
+}
+
+func validationMessage(fieldErr validator.FieldError) string {
+	param := fieldErr.Param()
+	isString := fieldErr.Kind().String() == "string"
+	isList := fieldErr.Kind().String() == "slice" || fieldErr.Kind().String() == "map"
+
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return "is required when " + lowerFirst(param) + " is missing"
+	case "notblank":
+		return "must not be blank"
+	case "email":
+		return "must be a valid email address"
+	case "uuid":
+		return "must be a valid uuid"
+	case "numeric":
+		return "must only contain digits"
+	case "role":
+		return "must be a valid role"
+	case "permission":
+		return "must be a valid scope"
+	case "transaction_status":
+		return "must be a valid status"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(param), ", ")
+	case "len":
+		if isString {
+			return "must be " + param + " characters long"
+		}
+		return "must have " + items(param)
+	case "min":
+		if isString {
+			return "must be at least " + param + " characters long"
+		}
+		if isList {
+			return "must have at least " + items(param)
+		}
+		return "must be at least " + param
+	case "max":
+		if isString {
+			return "must be at most " + param + " characters long"
+		}
+		if isList {
+			return "must have at most " + items(param)
+		}
+		return "must be at most " + param
+	case "gt":
+		return "must be greater than " + param
+	case "gte":
+		return "must be at least " + param
+	case "lt":
+		return "must be less than " + param
+	case "lte":
+		return "must be at most " + param
+	}
+	return "is invalid"
+}
+
+func items(count string) string {
+	if count == "1" {
+		return "1 item"
+	}
+	return count + " items"
+}
+
+// lowerFirst turns Go field names in tag params into json names
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testItem struct {
+	CoffeeId uint `json:"coffeeId" validate:"required"`
+}
+
+type testRequest struct {
+	Name         string     `json:"name" validate:"notblank,max=10"`
+	Price        *float64   `json:"price" validate:"omitempty,gt=0"`
+	Items        []testItem `json:"items" validate:"min=1,dive"`
+	Code         string     `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string     `json:"recoveryCode"`
+}
+
+func decodeTestRequest(body string) (*testRequest, *utiltypes.APIError) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	var reqData testRequest
+	if err := DecodeJSON(w, r, &reqData); err != nil {
+		return nil, FromError(err)
+	}
+	return &reqData, nil
+}
+
+func TestDecodeJSON(t *testing.T) {
+	reqData, apiErr := decodeTestRequest(`{"name": "latte", "price": 1.5, "items": [{"coffeeId": 1}], "code": "123456"}`)
+	require.Nil(t, apiErr)
+	assert.Equal(t, "latte", reqData.Name)
+	assert.Equal(t, 1.5, *reqData.Price)
+	assert.Equal(t, uint(1), reqData.Items[0].CoffeeId)
+}
+
+func TestDecodeJSONInvalidBodies(t *testing.T) {
+	cases := []struct {
+		body    string
+		message string
+		details []utiltypes.FieldError
+	}{
+		{``, "Request body is empty", nil},
+		{`{"name": `, "Invalid request body", nil},
+		{`{"name": "latte"} {}`, "Request body must be a single JSON object", nil},
+		{`{"name": "latte", "role": "admin"}`, "Invalid request body", []utiltypes.FieldError{{Field: "role", Message: "is not a known field"}}},
+		{`{"name": "latte", "price": "free"}`, "Invalid request body", []utiltypes.FieldError{{Field: "price", Message: "must be a number"}}},
+	}
+
+	for _, c := range cases {
+		_, apiErr := decodeTestRequest(c.body)
+		require.NotNil(t, apiErr, c.body)
+		assert.Equal(t, http.StatusBadRequest, apiErr.Status, c.body)
+		assert.Equal(t, utiltypes.CodeInvalidJSON, apiErr.Code, c.body)
+		assert.Equal(t, c.message, apiErr.Message, c.body)
+		assert.Equal(t, c.details, apiErr.Details, c.body)
+	}
+}
+
+func TestDecodeJSONBodyTooLarge(t *testing.T) {
+	defaultMaxBodyBytes := MaxBodyBytes
+	defer func() { MaxBodyBytes = defaultMaxBodyBytes }()
+	MaxBodyBytes = 32
+
+	_, apiErr := decodeTestRequest(`{"name": "` + strings.Repeat("a", 64) + `"}`)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, apiErr.Status)
+	assert.Equal(t, utiltypes.CodeBodyTooLarge, apiErr.Code)
+}
+
+func TestDecodeJSONValidation(t *testing.T) {
+	_, apiErr := decodeTestRequest(`{"name": "  ", "price": -1, "items": [{"coffeeId": 1}, {}]}`)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, utiltypes.CodeValidationFailed, apiErr.Code)
+	assert.Equal(t, []utiltypes.FieldError{
+		{Field: "name", Message: "must not be blank"},
+		{Field: "price", Message: "must be greater than 0"},
+		{Field: "items[1].coffeeId", Message: "is required"},
+		{Field: "code", Message: "is required when recoveryCode is missing"},
+	}, apiErr.Details)
+
+	_, apiErr = decodeTestRequest(`{"name": "a very long name", "items": [], "recoveryCode": "abcde-12345"}`)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, []utiltypes.FieldError{
+		{Field: "name", Message: "must be at most 10 characters long"},
+		{Field: "items", Message: "must have at least 1 item"},
+	}, apiErr.Details)
+}
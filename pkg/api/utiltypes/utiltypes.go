@@ -0,0 +1,69 @@
+// Package utiltypes holds the error and envelope bodies shared by every
+// route. They live outside of the util package so clients like pkg/client can
+// use them.
+package utiltypes
+
+// ErrorCode is a stable, machine readable reason for an error response.
+// Clients should rely on the code, messages may change.
+type ErrorCode string
+
+const (
+	CodeBadRequest       ErrorCode = "bad_request"
+	CodeInvalidJSON      ErrorCode = "invalid_json"
+	CodeBodyTooLarge     ErrorCode = "body_too_large"
+	CodeValidationFailed ErrorCode = "validation_failed"
+	CodeInvalidCursor    ErrorCode = "invalid_cursor"
+	CodeUnauthorized     ErrorCode = "unauthorized"
+	CodeInvalidToken     ErrorCode = "invalid_token"
+	CodeForbidden        ErrorCode = "forbidden"
+	CodeAccountDisabled  ErrorCode = "account_deactivated"
+	CodePasswordChange   ErrorCode = "password_change_required"
+	CodeNotFound         ErrorCode = "not_found"
+	CodeConflict         ErrorCode = "conflict"
+	CodeOutOfStock       ErrorCode = "out_of_stock"
+	CodeRateLimited      ErrorCode = "rate_limited"
+	CodeInternal         ErrorCode = "internal_error"
+	CodeBadGateway       ErrorCode = "bad_gateway"
+)
+
+// FieldError describes what is wrong with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is the body of every error response:
+// {"code": "...", "message": "...", "details": [...]}
+type APIError struct {
+	Status  int          `json:"-"`
+	Code    ErrorCode    `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// WithDetails returns a copy of the error with field errors attached
+func (e *APIError) WithDetails(details ...FieldError) *APIError {
+	withDetails := *e
+	withDetails.Details = append(append([]FieldError{}, e.Details...), details...)
+	return &withDetails
+}
+
+// MessageResponse is the body written by util.Respond(w, status, util.Message(...))
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// ListResponse is the envelope shared by all list endpoints
+type ListResponse struct {
+	Message    string      `json:"message,omitempty"`
+	Items      interface{} `json:"items"`
+	PageSize   int         `json:"page_size"`
+	TotalCount int         `json:"total_count"`
+	TotalPages int         `json:"total_pages"`
+	HasMore    bool        `json:"has_more"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
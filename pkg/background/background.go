@@ -0,0 +1,87 @@
+// Package background runs work that outlives the request that started it,
+// like sending receipts, so it can be cancelled and waited for on shutdown.
+package background
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cancelGrace is how long shutdown waits for cancelled work to return, so
+// the resources it uses aren't closed underneath it
+const cancelGrace = 5 * time.Second
+
+// Workers tracks running background work
+type Workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	stopping bool
+}
+
+func NewWorkers() *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Go runs work in a goroutine, its context is cancelled when shutdown runs
+// out of time. Work isn't started once shutdown began, Go reports whether it
+// was.
+func (w *Workers) Go(name string, work func(ctx context.Context)) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopping {
+		log.WithField("worker", name).Warn("Not starting background work, shutting down")
+		return false
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		// a failing worker shouldn't take the server down with it
+		defer func() {
+			if err := recover(); err != nil {
+				log.WithField("worker", name).Errorf("Background work panicked: %v", err)
+			}
+		}()
+		work(w.ctx)
+	}()
+	return true
+}
+
+// Shutdown stops new work and waits for running work to finish. When ctx is
+// done first the work is cancelled, given cancelGrace to return, and ctx's
+// error returned.
+func (w *Workers) Shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	w.stopping = true
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		w.cancel()
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		select {
+		case <-done:
+		case <-time.After(cancelGrace):
+			log.Warn("Background work still running after being cancelled")
+		}
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,65 @@
+package background
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownWaitsForWork(t *testing.T) {
+	workers := NewWorkers()
+
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	assert.True(t, workers.Go("test", func(ctx context.Context) {
+		<-release
+		close(finished)
+	}))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	assert.NoError(t, workers.Shutdown(context.Background()))
+	select {
+	case <-finished:
+	default:
+		t.Fatal("shutdown returned before the work finished")
+	}
+
+	// nothing starts after shutdown
+	assert.False(t, workers.Go("test", func(ctx context.Context) {
+		t.Error("work started after shutdown")
+	}))
+}
+
+func TestShutdownCancelsWork(t *testing.T) {
+	workers := NewWorkers()
+
+	cancelled := make(chan struct{})
+	workers.Go("test", func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, workers.Shutdown(ctx))
+
+	// shutdown waits for cancelled work to return
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("work wasn't cancelled")
+	}
+}
+
+func TestPanickingWork(t *testing.T) {
+	workers := NewWorkers()
+	workers.Go("test", func(ctx context.Context) {
+		panic("boom")
+	})
+	assert.NoError(t, workers.Shutdown(context.Background()))
+}
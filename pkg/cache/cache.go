@@ -0,0 +1,61 @@
+// Package cache keeps values that are expensive to compute, like pages of the
+// menu, in Redis, in process memory or nowhere, as configured.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/config"
+	"github.com/go-redis/redis/v7"
+)
+
+// ErrMiss is returned by Get for values that aren't cached
+var ErrMiss = errors.New("cache miss")
+
+// Cache stores values by key. Errors other than ErrMiss mean the cache
+// couldn't be reached, callers should fall back to the database. Values are
+// usually read and invalidated through a Group.
+type Cache interface {
+	Get(key string) ([]byte, error)
+	// Set stores value for ttl, a ttl of 0 keeps it until it's evicted
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// New creates the cache selected by cfg. Without a driver Redis is used when
+// a client is given and memory otherwise.
+func New(cfg config.Cache, client *redis.Client) (Cache, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		driver = config.CacheMemory
+		if client != nil {
+			driver = config.CacheRedis
+		}
+	}
+
+	switch driver {
+	case config.CacheRedis:
+		if client == nil {
+			return nil, errors.New("the redis cache needs REDIS_URL")
+		}
+		return NewRedisCache(client), nil
+	case config.CacheMemory:
+		return NewMemoryCache(cfg.MemorySize), nil
+	case config.CacheNone:
+		return Noop{}, nil
+	default:
+		return nil, fmt.Errorf("unknown cache driver %s", driver)
+	}
+}
+
+// Noop caches nothing, every Get is a miss
+type Noop struct{}
+
+func (Noop) Get(key string) ([]byte, error) {
+	return nil, ErrMiss
+}
+
+func (Noop) Set(key string, value []byte, ttl time.Duration) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	cfg := config.Default().Cache
+
+	cache, err := New(cfg, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryCache{}, cache)
+
+	cfg.Driver = config.CacheNone
+	cache, err = New(cfg, nil)
+	require.NoError(t, err)
+	require.NoError(t, cache.Set("menu:page1", []byte("1"), time.Minute))
+	_, err = cache.Get("menu:page1")
+	assert.Equal(t, ErrMiss, err)
+
+	// redis has to be configured to be used
+	cfg.Driver = config.CacheRedis
+	_, err = New(cfg, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// Group caches values that are invalidated together, like the pages of the
+// menu. Values are kept under "{name}:{version}:{key}" and invalidating the
+// group changes its version, so values cached for an older version are never
+// read again and expire on their own. Invalidating can't race with a request
+// caching what it read before, that value lands under the old version.
+type Group struct {
+	cache Cache
+	name  string
+	ttl   time.Duration
+	// concurrent misses of the same key share one load
+	loads singleflight.Group
+}
+
+// NewGroup caches the values of the group named name in cache for ttl, the
+// name also labels the cache metrics
+func NewGroup(cache Cache, name string, ttl time.Duration) *Group {
+	return &Group{
+		cache: cache,
+		name:  name,
+		ttl:   ttl,
+	}
+}
+
+// Get returns the cached value of key, or the value returned by load which is
+// then cached. While one request loads a key others wait for its value
+// instead of loading it too. The cache being unreachable only makes Get call
+// load.
+func (g *Group) Get(key string, load func() ([]byte, error)) ([]byte, error) {
+	logger := log.WithField("cache", g.name)
+
+	version, err := g.version()
+	if err != nil {
+		logger.WithError(err).Warn("Cache Error")
+		metrics.CacheError(g.name)
+		// still share the load, there's just nothing to cache it under
+		return g.load(g.name+":"+key, load, nil)
+	}
+
+	versionedKey := g.name + ":" + version + ":" + key
+	value, err := g.cache.Get(versionedKey)
+	if err == nil {
+		metrics.CacheHit(g.name)
+		return value, nil
+	}
+	if err == ErrMiss {
+		metrics.CacheMiss(g.name)
+	} else {
+		logger.WithError(err).Warn("Cache Error")
+		metrics.CacheError(g.name)
+	}
+
+	return g.load(versionedKey, load, func(value []byte) {
+		if err := g.cache.Set(versionedKey, value, g.ttl); err != nil {
+			logger.WithError(err).Warn("Error caching value")
+		}
+	})
+}
+
+// load calls fn once for all concurrent loads of key and passes what it
+// loaded to store, if given
+func (g *Group) load(key string, fn func() ([]byte, error), store func([]byte)) ([]byte, error) {
+	value, err, _ := g.loads.Do(key, func() (interface{}, error) {
+		value, err := fn()
+		if err != nil {
+			return nil, err
+		}
+		if store != nil {
+			store(value)
+		}
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+// Invalidate makes every cached value of the group stale
+func (g *Group) Invalidate() error {
+	_, err := g.newVersion()
+	return err
+}
+
+func (g *Group) versionKey() string {
+	return g.name + ":version"
+}
+
+// version returns the current version, starting a new one when the cache
+// doesn't have it. Versions are never reused so values of a version that
+// was evicted can't come back.
+func (g *Group) version() (string, error) {
+	version, err := g.cache.Get(g.versionKey())
+	if err == ErrMiss {
+		return g.newVersion()
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(version), nil
+}
+
+func (g *Group) newVersion() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	version := hex.EncodeToString(b)
+	// the version is kept until it changes, values of the group expire
+	if err := g.cache.Set(g.versionKey(), []byte(version), 0); err != nil {
+		return "", err
+	}
+	return version, nil
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingLoad returns value and counts how often it's called
+func countingLoad(calls *int32, value string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		atomic.AddInt32(calls, 1)
+		return []byte(value), nil
+	}
+}
+
+func TestGroupGet(t *testing.T) {
+	group := NewGroup(NewMemoryCache(10), "menu", time.Minute)
+
+	var calls int32
+	for i := 0; i < 3; i++ {
+		value, err := group.Get("page1", countingLoad(&calls, "coffee"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("coffee"), value)
+	}
+	assert.EqualValues(t, 1, calls)
+
+	// other keys are loaded on their own
+	value, err := group.Get("page2", countingLoad(&calls, "tea"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tea"), value)
+	assert.EqualValues(t, 2, calls)
+}
+
+func TestGroupInvalidate(t *testing.T) {
+	group := NewGroup(NewMemoryCache(10), "menu", time.Minute)
+
+	var calls int32
+	_, err := group.Get("page1", countingLoad(&calls, "coffee"))
+	require.NoError(t, err)
+
+	require.NoError(t, group.Invalidate())
+	value, err := group.Get("page1", countingLoad(&calls, "tea"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tea"), value)
+	assert.EqualValues(t, 2, calls)
+}
+
+func TestGroupSharesConcurrentLoads(t *testing.T) {
+	group := NewGroup(NewMemoryCache(10), "menu", time.Minute)
+
+	var calls int32
+	release := make(chan struct{})
+	load := func() ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []byte("coffee"), nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := group.Get("page1", load)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("coffee"), value)
+		}()
+	}
+	// give every request the chance to miss before the load finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, calls)
+}
+
+func TestGroupDoesNotCacheErrors(t *testing.T) {
+	group := NewGroup(NewMemoryCache(10), "menu", time.Minute)
+
+	loadErr := errors.New("database is down")
+	_, err := group.Get("page1", func() ([]byte, error) { return nil, loadErr })
+	assert.Equal(t, loadErr, err)
+
+	var calls int32
+	value, err := group.Get("page1", countingLoad(&calls, "coffee"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("coffee"), value)
+	assert.EqualValues(t, 1, calls)
+}
+
+func TestGroupEvictedVersion(t *testing.T) {
+	cache := NewMemoryCache(10)
+	group := NewGroup(cache, "menu", time.Minute)
+
+	var calls int32
+	_, err := group.Get("page1", countingLoad(&calls, "coffee"))
+	require.NoError(t, err)
+
+	// losing the version must not bring back values cached under it
+	cache.mu.Lock()
+	cache.remove(cache.entries["menu:version"])
+	cache.mu.Unlock()
+
+	value, err := group.Get("page1", countingLoad(&calls, "tea"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tea"), value)
+	assert.EqualValues(t, 2, calls)
+}
+
+// unreachable fails every call like a Redis that is down
+type unreachable struct{}
+
+func (unreachable) Get(key string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (unreachable) Set(key string, value []byte, ttl time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestGroupUnreachableCache(t *testing.T) {
+	group := NewGroup(unreachable{}, "menu", time.Minute)
+
+	var calls int32
+	value, err := group.Get("page1", countingLoad(&calls, "coffee"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("coffee"), value)
+	assert.Error(t, group.Invalidate())
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	key   string
+	value []byte
+	// zero for values that don't expire
+	expiresAt time.Time
+}
+
+// MemoryCache keeps up to size values for a single server instance, evicting
+// the least recently used ones. Other instances don't see its invalidations.
+type MemoryCache struct {
+	mu   sync.Mutex
+	size int
+	// most recently used at the front
+	lru     *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+func NewMemoryCache(size int) *MemoryCache {
+	return &MemoryCache{
+		size:    size,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+		now:     time.Now,
+	}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	entry := element.Value.(*memoryEntry)
+	if !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		return nil, ErrMiss
+	}
+	c.lru.MoveToFront(element)
+	return entry.value, nil
+}
+
+func (c *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = c.now().Add(ttl)
+	}
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.lru.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[key] = c.lru.PushFront(&memoryEntry{
+		key:       key,
+		value:     value,
+		expiresAt: expiresAt,
+	})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+// remove must be called with the lock held
+func (c *MemoryCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*memoryEntry)
+	delete(c.entries, entry.key)
+}
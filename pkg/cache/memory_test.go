@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCacheGetAndSet(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryCache(10)
+	cache.now = func() time.Time { return now }
+
+	_, err := cache.Get("menu:page1")
+	assert.Equal(t, ErrMiss, err)
+
+	require.NoError(t, cache.Set("menu:page1", []byte("coffee"), time.Minute))
+	value, err := cache.Get("menu:page1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("coffee"), value)
+
+	require.NoError(t, cache.Set("menu:page1", []byte("tea"), time.Minute))
+	value, err = cache.Get("menu:page1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("tea"), value)
+
+	now = now.Add(time.Minute)
+	_, err = cache.Get("menu:page1")
+	assert.Equal(t, ErrMiss, err)
+	assert.Empty(t, cache.entries)
+}
+
+func TestMemoryCacheWithoutTTL(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryCache(10)
+	cache.now = func() time.Time { return now }
+
+	require.NoError(t, cache.Set("menu:version", []byte("1"), 0))
+	now = now.Add(24 * 365 * time.Hour)
+	value, err := cache.Get("menu:version")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewMemoryCache(2)
+
+	require.NoError(t, cache.Set("page1", []byte("1"), time.Minute))
+	require.NoError(t, cache.Set("page2", []byte("2"), time.Minute))
+	// page1 is used more recently than page2 now
+	_, err := cache.Get("page1")
+	require.NoError(t, err)
+	require.NoError(t, cache.Set("page3", []byte("3"), time.Minute))
+
+	_, err = cache.Get("page2")
+	assert.Equal(t, ErrMiss, err)
+	for _, key := range []string{"page1", "page3"} {
+		_, err = cache.Get(key)
+		assert.NoError(t, err, key)
+	}
+}
@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// RedisCache is shared between server instances
+type RedisCache struct {
+	client *redis.Client
+}
+
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (c *RedisCache) Get(key string) ([]byte, error) {
+	value, err := c.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(key, value, ttl).Err()
+}
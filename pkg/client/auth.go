@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/authtypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/google/uuid"
+)
+
+// loginResult is either an authtypes.LoginResponse or an
+// authtypes.TwoFactorChallengeResponse
+type loginResult struct {
+	authtypes.LoginResponse
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+// Login authenticates following requests as the user, the credentials are
+// kept to log in again when the token is rejected. Users with two-factor
+// authentication get a *TwoFactorRequiredError, see LoginTwoFactor.
+//
+// Single sign on isn't supported, it needs a browser to log in with the
+// provider. Pass the token of the callback to SetToken instead.
+func (c *Client) Login(ctx context.Context, email, password string) (*authtypes.LoginResponse, error) {
+	credentials := &authtypes.LoginRequest{
+		Email:    email,
+		Password: password,
+	}
+
+	var result loginResult
+	err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/auth/login",
+		body:   credentials,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.TwoFactorRequired {
+		return nil, &TwoFactorRequiredError{ChallengeToken: result.ChallengeToken}
+	}
+
+	c.setSession(result.Token, credentials)
+	return &result.LoginResponse, nil
+}
+
+// LoginTwoFactor finishes a login with a code from the authenticator app or a
+// recovery code. Tokens from two-factor logins can't be renewed without the
+// user, requests fail once the token is rejected.
+func (c *Client) LoginTwoFactor(ctx context.Context, login authtypes.TwoFactorLoginRequest) (*authtypes.TwoFactorLoginResponse, error) {
+	var response authtypes.TwoFactorLoginResponse
+	err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/auth/login/2fa",
+		body:   login,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setSession(response.Token, nil)
+	return &response, nil
+}
+
+// Register creates an account and authenticates following requests as it
+func (c *Client) Register(ctx context.Context, register authtypes.RegisterRequest) (*authtypes.RegisterResponse, error) {
+	var response authtypes.RegisterResponse
+	err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/auth/register",
+		body:   register,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setSession(response.Token, &authtypes.LoginRequest{
+		Email:    register.Email,
+		Password: register.Password,
+	})
+	return &response, nil
+}
+
+// UpdateUser changes the fields of update that are set
+func (c *Client) UpdateUser(ctx context.Context, userId uuid.UUID, update authtypes.UpdateUserRequest) (*utiltypes.MessageResponse, error) {
+	var response utiltypes.MessageResponse
+	err := c.do(ctx, &request{
+		method:        http.MethodPatch,
+		path:          "/auth/users/" + userId.String(),
+		body:          update,
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// EnrollTwoFactor starts setting up two-factor authentication, confirm it
+// with ConfirmTwoFactor
+func (c *Client) EnrollTwoFactor(ctx context.Context) (*authtypes.TwoFactorEnrollResponse, error) {
+	var response authtypes.TwoFactorEnrollResponse
+	err := c.do(ctx, &request{
+		method:        http.MethodPost,
+		path:          "/auth/2fa/enroll",
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *Client) ConfirmTwoFactor(ctx context.Context, code string) (*authtypes.RecoveryCodesResponse, error) {
+	var response authtypes.RecoveryCodesResponse
+	err := c.do(ctx, &request{
+		method:        http.MethodPost,
+		path:          "/auth/2fa/confirm",
+		body:          authtypes.TwoFactorConfirmRequest{Code: code},
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *Client) DisableTwoFactor(ctx context.Context, code authtypes.TwoFactorCodeRequest) (*utiltypes.MessageResponse, error) {
+	var response utiltypes.MessageResponse
+	err := c.do(ctx, &request{
+		method:        http.MethodPost,
+		path:          "/auth/2fa/disable",
+		body:          code,
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
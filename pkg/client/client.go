@@ -0,0 +1,296 @@
+// Package client is a Go client for the Dollar Coffee API. Requests and
+// responses use the structs of the server modules so the two can't diverge.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/authtypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/openapi"
+)
+
+// Options configures a Client, see DefaultOptions
+type Options struct {
+	HTTPClient *http.Client
+	// APIKey authenticates requests instead of a token from Login
+	APIKey string
+	// MaxRetries is how often failed requests are retried, 0 disables retries
+	MaxRetries int
+	// MinBackoff is the delay before the first retry, it doubles with every
+	// retry up to MaxBackoff. Responses asking to retry later than MaxBackoff
+	// aren't retried.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		MaxRetries: 3,
+		MinBackoff: 200 * time.Millisecond,
+		MaxBackoff: 5 * time.Second,
+	}
+}
+
+// Client calls the API at a base URL, it's safe for concurrent use
+type Client struct {
+	baseURL *url.URL
+	options Options
+
+	mu    sync.Mutex
+	token string
+	// credentials of the last password login, used to get a new token when
+	// the current one is rejected
+	credentials *authtypes.LoginRequest
+}
+
+func New(baseURL string, options Options) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q", baseURL)
+	}
+
+	defaults := DefaultOptions()
+	if options.HTTPClient == nil {
+		options.HTTPClient = defaults.HTTPClient
+	}
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = defaults.MinBackoff
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = options.MinBackoff
+	}
+
+	return &Client{
+		baseURL: parsed,
+		options: options,
+	}, nil
+}
+
+// Token returns the auth token of the last login
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// SetToken authenticates following requests with token, e.g. one from an
+// earlier session
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+func (c *Client) setSession(token string, credentials *authtypes.LoginRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.credentials = credentials
+}
+
+func (c *Client) session() (string, *authtypes.LoginRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, c.credentials
+}
+
+// request describes one API call
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	// authenticated requests get the token or API key
+	authenticated bool
+}
+
+// do sends req and decodes a successful JSON response into out, out can be
+// nil to ignore the body
+func (c *Client) do(ctx context.Context, req *request, out interface{}) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// send sends req, retrying and logging in again when needed. Error
+// responses are returned as *utiltypes.APIError, the caller closes the body of
+// successful responses.
+func (c *Client) send(ctx context.Context, req *request) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		body, err = json.Marshal(req.body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		token, _ := c.session()
+		resp, err := c.sendOnce(ctx, req, body, token)
+
+		var apiErr *utiltypes.APIError
+		if err == nil && resp.StatusCode >= 400 {
+			apiErr = decodeError(resp)
+			err = apiErr
+		}
+		if err == nil {
+			return resp, nil
+		}
+
+		// tokens are rejected once they can't be verified anymore, e.g. after
+		// the signing secret changed, log in again once
+		if apiErr != nil && apiErr.Code == utiltypes.CodeInvalidToken && req.authenticated && !refreshed {
+			refreshed = true
+			if refreshErr := c.refresh(ctx, token); refreshErr == nil {
+				attempt--
+				continue
+			}
+			return nil, err
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		delay, retry := c.retryDelay(req, attempt, resp)
+		if !retry {
+			return nil, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, req *request, body []byte, token string) (*http.Response, error) {
+	target := *c.baseURL
+	target.Path += req.path
+	if len(req.query) > 0 {
+		target.RawQuery = req.query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if req.authenticated {
+		if c.options.APIKey != "" {
+			httpReq.Header.Set("X-API-Key", c.options.APIKey)
+		} else if token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	return c.options.HTTPClient.Do(httpReq)
+}
+
+// refresh logs in again with the credentials of the last login, unless
+// another request already replaced the rejected token
+func (c *Client) refresh(ctx context.Context, rejected string) error {
+	if c.options.APIKey != "" {
+		return errNoCredentials
+	}
+	token, credentials := c.session()
+	if token != rejected {
+		return nil
+	}
+	if credentials == nil {
+		return errNoCredentials
+	}
+	_, err := c.Login(ctx, credentials.Email, credentials.Password)
+	return err
+}
+
+// retryDelay decides whether a failed attempt is retried and after how long.
+// Requests that may have changed something are only retried when the server
+// turned them away before handling them, i.e. when rate limited.
+func (c *Client) retryDelay(req *request, attempt int, resp *http.Response) (time.Duration, bool) {
+	if attempt >= c.options.MaxRetries {
+		return 0, false
+	}
+
+	idempotent := req.method == http.MethodGet || req.method == http.MethodHead ||
+		req.method == http.MethodPut || req.method == http.MethodDelete
+
+	if resp == nil {
+		// transport errors, the request may or may not have been handled
+		return c.backoff(attempt), idempotent
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil {
+			delay := time.Duration(seconds) * time.Second
+			// e.g. a locked out login, waiting that long isn't useful
+			return delay, delay <= c.options.MaxBackoff
+		}
+		return c.backoff(attempt), true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return c.backoff(attempt), idempotent
+	}
+	return 0, false
+}
+
+// backoff doubles with every attempt, with jitter so clients that failed
+// together don't retry together
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.options.MinBackoff << uint(attempt)
+	if delay > c.options.MaxBackoff || delay <= 0 {
+		delay = c.options.MaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// OpenAPI fetches the OpenAPI document describing every route
+func (c *Client) OpenAPI(ctx context.Context) (*openapi.Document, error) {
+	var document openapi.Document
+	err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/openapi.json",
+	}, &document)
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
@@ -0,0 +1,334 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/authtypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/internaltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/purchasestypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/background"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/config"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, server *httptest.Server, options Options) *Client {
+	options.MinBackoff = time.Millisecond
+	options.MaxBackoff = 10 * time.Millisecond
+	c, err := New(server.URL, options)
+	require.NoError(t, err)
+	return c
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestLoginAndRefresh(t *testing.T) {
+	var mu sync.Mutex
+	logins := 0
+	validToken := ""
+
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		var login authtypes.LoginRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&login))
+		if login.Password != "password" {
+			respond(w, http.StatusUnauthorized, util.Unauthorized("Invalid login credentials. Please try again"))
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		logins++
+		validToken = "token-" + strconv.Itoa(logins)
+		respond(w, http.StatusOK, authtypes.LoginResponse{Message: "Logged In", Token: validToken})
+	}).Methods("POST")
+	router.HandleFunc("/purchases/user/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+validToken {
+			respond(w, http.StatusForbidden, util.NewError(http.StatusForbidden, utiltypes.CodeInvalidToken, "Malformed authentication token"))
+			return
+		}
+		respond(w, http.StatusOK, utiltypes.ListResponse{
+			Items:    []*purchasestypes.PurchaseHistoryResponse{{ID: 7, Total: 2}},
+			PageSize: 10,
+		})
+	}).Methods("GET")
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	c := newTestClient(t, server, Options{})
+
+	_, err := c.Login(context.Background(), "jane@example.com", "wrong")
+	assert.Equal(t, utiltypes.CodeUnauthorized, ErrorCode(err))
+	assert.Empty(t, c.Token())
+
+	login, err := c.Login(context.Background(), "jane@example.com", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", login.Token)
+	assert.Equal(t, "token-1", c.Token())
+
+	page, err := c.GetHistory(context.Background(), uuid.New(), PageOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, uint(7), page.Items[0].ID)
+	assert.Equal(t, 10, page.PageSize)
+
+	// the server stops accepting the token, the client logs in again
+	mu.Lock()
+	validToken = "rotated"
+	mu.Unlock()
+	_, err = c.GetHistory(context.Background(), uuid.New(), PageOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", c.Token())
+	assert.Equal(t, 2, logins)
+}
+
+func TestRefreshWithoutCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusForbidden, util.NewError(http.StatusForbidden, utiltypes.CodeInvalidToken, "Malformed authentication token"))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, Options{})
+	c.SetToken("expired")
+
+	_, err := c.GetHistory(context.Background(), uuid.New(), PageOptions{})
+	var apiErr *utiltypes.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusForbidden, apiErr.Status)
+	assert.Equal(t, utiltypes.CodeInvalidToken, apiErr.Code)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, authtypes.TwoFactorChallengeResponse{
+			Message:           "Two-factor authentication required",
+			TwoFactorRequired: true,
+			ChallengeToken:    "challenge",
+		})
+	})
+	router.HandleFunc("/auth/login/2fa", func(w http.ResponseWriter, r *http.Request) {
+		var login authtypes.TwoFactorLoginRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&login))
+		assert.Equal(t, "challenge", login.ChallengeToken)
+		respond(w, http.StatusOK, authtypes.TwoFactorLoginResponse{Token: "token"})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	c := newTestClient(t, server, Options{})
+	_, err := c.Login(context.Background(), "admin@test.com", "password")
+	twoFactorErr, ok := err.(*TwoFactorRequiredError)
+	require.True(t, ok, "%v", err)
+
+	_, err = c.LoginTwoFactor(context.Background(), authtypes.TwoFactorLoginRequest{
+		ChallengeToken: twoFactorErr.ChallengeToken,
+		Code:           "123456",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "token", c.Token())
+}
+
+func TestRetries(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.Method+" "+r.URL.Path]++
+		attempt := attempts[r.Method+" "+r.URL.Path]
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/menu":
+			// fails twice, then works
+			if attempt <= 2 {
+				respond(w, http.StatusServiceUnavailable, util.BadGateway("Unavailable"))
+				return
+			}
+			respond(w, http.StatusOK, utiltypes.ListResponse{Items: []interface{}{}})
+		case "/purchases/purchase":
+			// rate limited requests weren't handled, they can be retried
+			if attempt == 1 {
+				w.Header().Set("Retry-After", "0")
+				respond(w, http.StatusTooManyRequests, util.TooManyRequests("Too many requests, try again later"))
+				return
+			}
+			respond(w, http.StatusInternalServerError, util.InternalError())
+		case "/auth/login":
+			w.Header().Set("Retry-After", "900")
+			respond(w, http.StatusTooManyRequests, util.TooManyRequests("Too many failed logins, try again later"))
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, Options{MaxRetries: 3})
+
+	_, err := c.GetMenu(context.Background(), MenuOptions{})
+	require.NoError(t, err)
+
+	// orders that failed on the server aren't retried, they may have been placed
+	_, err = c.PlaceOrder(context.Background(), purchasestypes.PurchaseRequest{})
+	assert.Equal(t, utiltypes.CodeInternal, ErrorCode(err))
+
+	// waiting out a lockout is left to the caller
+	_, err = c.Login(context.Background(), "jane@example.com", "password")
+	assert.Equal(t, utiltypes.CodeRateLimited, ErrorCode(err))
+
+	assert.Equal(t, map[string]int{
+		"GET /menu":                3,
+		"POST /purchases/purchase": 2,
+		"POST /auth/login":         1,
+	}, attempts)
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		// not from the API, e.g. a load balancer
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("upstream unavailable"))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, Options{MaxRetries: 2})
+	_, err := c.GetMenu(context.Background(), MenuOptions{})
+
+	var apiErr *utiltypes.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadGateway, apiErr.Status)
+	assert.Equal(t, utiltypes.CodeBadGateway, apiErr.Code)
+	assert.Equal(t, "upstream unavailable", apiErr.Message)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestValidationErrorDetails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("X-API-Key"))
+		respond(w, http.StatusBadRequest, util.ValidationFailed(utiltypes.FieldError{Field: "price", Message: "must be greater than 0"}))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, Options{APIKey: "key"})
+	_, err := c.CreateCoffee(context.Background(), internaltypes.CreateCoffeeRequest{Name: "Latte"})
+
+	var apiErr *utiltypes.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, utiltypes.CodeValidationFailed, apiErr.Code)
+	assert.Equal(t, []utiltypes.FieldError{{Field: "price", Message: "must be greater than 0"}}, apiErr.Details)
+}
+
+// TestEveryRoute calls every client method against a server with the routes
+// of the OpenAPI document, so routes without a client method are noticed
+func TestEveryRoute(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.TokenSecret = "test secret"
+	apiRouter := mux.NewRouter()
+	require.NoError(t, api.NewServer(cfg, apiRouter, &gorm.DB{}, nil, nil, background.NewWorkers()))
+	w := httptest.NewRecorder()
+	apiRouter.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	var document struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+
+	var mu sync.Mutex
+	called := map[string]bool{}
+	expected := []string{}
+	router := mux.NewRouter()
+	for path, item := range document.Paths {
+		for method := range item {
+			operation := strings.ToUpper(method) + " " + path
+			// single sign on and the docs are for browsers, metrics for
+			// prometheus
+			if !strings.HasPrefix(path, "/auth/oidc/") && path != "/docs" && path != "/metrics" {
+				expected = append(expected, operation)
+			}
+			router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				called[operation] = true
+				mu.Unlock()
+				respond(w, http.StatusOK, map[string]interface{}{})
+			}).Methods(strings.ToUpper(method))
+		}
+	}
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("%s %s isn't a route", r.Method, r.URL.Path)
+		respond(w, http.StatusNotFound, util.NotFound("Not found"))
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	c := newTestClient(t, server, Options{})
+	ctx := context.Background()
+	userId := uuid.New()
+	calls := []func() error{
+		func() error { _, err := c.Login(ctx, "jane@example.com", "password"); return err },
+		func() error { _, err := c.LoginTwoFactor(ctx, authtypes.TwoFactorLoginRequest{}); return err },
+		func() error { _, err := c.Register(ctx, authtypes.RegisterRequest{}); return err },
+		func() error { _, err := c.UpdateUser(ctx, userId, authtypes.UpdateUserRequest{}); return err },
+		func() error { _, err := c.EnrollTwoFactor(ctx); return err },
+		func() error { _, err := c.ConfirmTwoFactor(ctx, "123456"); return err },
+		func() error { _, err := c.DisableTwoFactor(ctx, authtypes.TwoFactorCodeRequest{}); return err },
+		func() error { _, err := c.GetMenu(ctx, MenuOptions{}); return err },
+		func() error { _, err := c.PlaceOrder(ctx, purchasestypes.PurchaseRequest{}); return err },
+		func() error { _, err := c.GetHistory(ctx, userId, PageOptions{Cursor: "next"}); return err },
+		func() error { _, err := c.GetPurchase(ctx, 1); return err },
+		func() error { _, err := c.CancelOrder(ctx, 1, ""); return err },
+		func() error { _, err := c.GetReceipt(ctx, 1, "pdf"); return err },
+		func() error { _, err := c.CreateCoffee(ctx, internaltypes.CreateCoffeeRequest{}); return err },
+		func() error { _, err := c.UpdateCoffee(ctx, 1, internaltypes.UpdateCoffeeRequest{}); return err },
+		func() error { _, err := c.DeleteCoffee(ctx, 1); return err },
+		func() error { _, err := c.RecordPayment(ctx, 1, 2); return err },
+		func() error { _, err := c.UpdatePurchaseStatus(ctx, 1, "ready"); return err },
+		func() error { _, err := c.CancelPurchase(ctx, 1, "spilled"); return err },
+		func() error { _, err := c.ListPurchases(ctx, PurchaseFilter{Status: "placed"}); return err },
+		func() error { _, err := c.ListUsers(ctx, UserFilter{Search: "jane"}); return err },
+		func() error { _, err := c.CreateUser(ctx, internaltypes.CreateUserRequest{}); return err },
+		func() error { _, err := c.DeleteUser(ctx, userId, true); return err },
+		func() error { _, err := c.DeactivateUser(ctx, userId); return err },
+		func() error { _, err := c.ReactivateUser(ctx, userId); return err },
+		func() error { _, err := c.UpdateUserRole(ctx, userId, "barista"); return err },
+		func() error { _, err := c.ListAPIKeys(ctx); return err },
+		func() error { _, err := c.CreateAPIKey(ctx, internaltypes.CreateAPIKeyRequest{}); return err },
+		func() error { _, err := c.RevokeAPIKey(ctx, 1); return err },
+		func() error { _, err := c.ListAuditEvents(ctx, AuditFilter{Action: "coffee.update"}); return err },
+		func() error { _, err := c.OpenAPI(ctx); return err },
+		func() error { _, err := c.Health(ctx); return err },
+		func() error { _, err := c.Ready(ctx); return err },
+	}
+	for _, call := range calls {
+		assert.NoError(t, call())
+	}
+
+	calledOperations := []string{}
+	for operation := range called {
+		calledOperations = append(calledOperations, operation)
+	}
+	sort.Strings(expected)
+	sort.Strings(calledOperations)
+	assert.Equal(t, expected, calledOperations)
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+)
+
+// maxErrorBody limits how much of an error response is read
+const maxErrorBody = 64 << 10
+
+var errNoCredentials = errors.New("no credentials to log in again with")
+
+// TwoFactorRequiredError is returned by Login for users with two-factor
+// authentication, pass the challenge token to LoginTwoFactor
+type TwoFactorRequiredError struct {
+	ChallengeToken string
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return "two-factor authentication required"
+}
+
+// ErrorCode returns the code of API errors, or "" for other errors like
+// network failures
+func ErrorCode(err error) utiltypes.ErrorCode {
+	var apiErr *utiltypes.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// decodeError reads an error response into an APIError, responses that
+// didn't come from the API (e.g. a proxy's error page) get a code based on
+// their status
+func decodeError(resp *http.Response) *utiltypes.APIError {
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	apiErr := &utiltypes.APIError{}
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Code == "" {
+		message := strings.TrimSpace(string(body))
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		apiErr = &utiltypes.APIError{
+			Code:    statusCode(resp.StatusCode),
+			Message: message,
+		}
+	}
+	apiErr.Status = resp.StatusCode
+	return apiErr
+}
+
+func statusCode(status int) utiltypes.ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return utiltypes.CodeBadRequest
+	case http.StatusUnauthorized:
+		return utiltypes.CodeUnauthorized
+	case http.StatusForbidden:
+		return utiltypes.CodeForbidden
+	case http.StatusNotFound:
+		return utiltypes.CodeNotFound
+	case http.StatusConflict:
+		return utiltypes.CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return utiltypes.CodeBodyTooLarge
+	case http.StatusTooManyRequests:
+		return utiltypes.CodeRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return utiltypes.CodeBadGateway
+	}
+	return utiltypes.CodeInternal
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/healthtypes"
+)
+
+// Health checks that the server is running
+func (c *Client) Health(ctx context.Context) (*healthtypes.HealthResponse, error) {
+	var response healthtypes.HealthResponse
+	err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/healthz",
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Ready reports the status of the server's dependencies. It isn't retried and
+// servers that aren't ready still return their status, with Status set to
+// healthtypes.StatusDown.
+func (c *Client) Ready(ctx context.Context) (*healthtypes.ReadinessResponse, error) {
+	resp, err := c.sendOnce(ctx, &request{
+		method: http.MethodGet,
+		path:   "/readyz",
+	}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, decodeError(resp)
+	}
+	defer resp.Body.Close()
+
+	var response healthtypes.ReadinessResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
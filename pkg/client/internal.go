@@ -0,0 +1,274 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/internaltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/google/uuid"
+)
+
+// The methods below call the /internal routes, each needs the permission
+// documented on the route
+
+// message sends an authenticated request answered with a message
+func (c *Client) message(ctx context.Context, req *request) (*utiltypes.MessageResponse, error) {
+	req.authenticated = true
+
+	var response utiltypes.MessageResponse
+	if err := c.do(ctx, req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *Client) CreateCoffee(ctx context.Context, coffee internaltypes.CreateCoffeeRequest) (*utiltypes.MessageResponse, error) {
+	return c.message(ctx, &request{
+		method: http.MethodPost,
+		path:   "/internal/coffee",
+		body:   coffee,
+	})
+}
+
+// UpdateCoffee changes the fields of update that are set
+func (c *Client) UpdateCoffee(ctx context.Context, coffeeId uint, update internaltypes.UpdateCoffeeRequest) (*utiltypes.MessageResponse, error) {
+	return c.message(ctx, &request{
+		method: http.MethodPatch,
+		path:   "/internal/coffee/" + uintString(coffeeId),
+		body:   update,
+	})
+}
+
+func (c *Client) DeleteCoffee(ctx context.Context, coffeeId uint) (*utiltypes.MessageResponse, error) {
+	return c.message(ctx, &request{
+		method: http.MethodDelete,
+		path:   "/internal/coffee/" + uintString(coffeeId),
+	})
+}
+
+// RecordPayment sets how much was paid for a purchase in total
+func (c *Client) RecordPayment(ctx context.Context, transactionId uint, amountPaid float64) (*utiltypes.MessageResponse, error) {
+	return c.message(ctx, &request{
+		method: http.MethodPatch,
+		path:   "/internal/purchase/" + uintString(transactionId),
+		body:   internaltypes.PurchaseUpdateRequest{AmountPaid: amountPaid},
+	})
+}
+
+func (c *Client) UpdatePurchaseStatus(ctx context.Context, transactionId uint, status string) (*utiltypes.MessageResponse, error) {
+	return c.message(ctx, &request{
+		method: http.MethodPatch,
+		path:   "/internal/purchase/" + uintString(transactionId) + "/status",
+		body:   internaltypes.PurchaseStatusRequest{Status: status},
+	})
+}
+
+// CancelPurchase cancels any purchase, refunding payments and restoring stock
+func (c *Client) CancelPurchase(ctx context.Context, transactionId uint, reason string) (*utiltypes.MessageResponse, error) {
+	return c.message(ctx, &request{
+		method: http.MethodPost,
+		path:   "/internal/purchase/" + uintString(transactionId) + "/cancel",
+		body:   internaltypes.CancelPurchaseRequest{Reason: reason},
+	})
+}
+
+// PurchaseFilter narrows ListPurchases, dates are YYYY-MM-DD or RFC 3339
+type PurchaseFilter struct {
+	PageOptions
+	UserId        *uuid.UUID
+	From          string
+	To            string
+	Status        string
+	PaymentStatus string
+	CoffeeId      uint
+	MinTotal      *float64
+	Sort          string
+	Direction     string
+}
+
+func (f PurchaseFilter) values() url.Values {
+	values := f.PageOptions.values()
+	if f.UserId != nil {
+		values.Set("user_id", f.UserId.String())
+	}
+	setIf(values, "from", f.From)
+	setIf(values, "to", f.To)
+	setIf(values, "status", f.Status)
+	setIf(values, "payment_status", f.PaymentStatus)
+	if f.CoffeeId != 0 {
+		values.Set("coffee_id", uintString(f.CoffeeId))
+	}
+	if f.MinTotal != nil {
+		values.Set("min_total", strconv.FormatFloat(*f.MinTotal, 'f', -1, 64))
+	}
+	setIf(values, "sort", f.Sort)
+	setIf(values, "direction", f.Direction)
+	return values
+}
+
+func (c *Client) ListPurchases(ctx context.Context, filter PurchaseFilter) (*PurchasePage, error) {
+	var page PurchasePage
+	err := c.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          "/internal/purchases",
+		query:         filter.values(),
+		authenticated: true,
+	}, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+type UserFilter struct {
+	PageOptions
+	Role string
+	// prefix of the name or email
+	Search string
+}
+
+func (c *Client) ListUsers(ctx context.Context, filter UserFilter) (*UserPage, error) {
+	query := filter.PageOptions.values()
+	setIf(query, "role", filter.Role)
+	setIf(query, "search", filter.Search)
+
+	var page UserPage
+	err := c.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          "/internal/users",
+		query:         query,
+		authenticated: true,
+	}, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// CreateUser creates a user with a temporary password, which has to be
+// changed after logging in
+func (c *Client) CreateUser(ctx context.Context, user internaltypes.CreateUserRequest) (*internaltypes.CreateUserResponse, error) {
+	var response internaltypes.CreateUserResponse
+	err := c.do(ctx, &request{
+		method:        http.MethodPost,
+		path:          "/internal/users",
+		body:          user,
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// DeleteUser fails with a conflict while the user has unpaid purchases,
+// unless force is set
+func (c *Client) DeleteUser(ctx context.Context, userId uuid.UUID, force bool) (*utiltypes.MessageResponse, error) {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+	return c.message(ctx, &request{
+		method: http.MethodDelete,
+		path:   "/internal/users/" + userId.String(),
+		query:  query,
+	})
+}
+
+func (c *Client) DeactivateUser(ctx context.Context, userId uuid.UUID) (*utiltypes.MessageResponse, error) {
+	return c.message(ctx, &request{
+		method: http.MethodPost,
+		path:   "/internal/users/" + userId.String() + "/deactivate",
+	})
+}
+
+func (c *Client) ReactivateUser(ctx context.Context, userId uuid.UUID) (*utiltypes.MessageResponse, error) {
+	return c.message(ctx, &request{
+		method: http.MethodPost,
+		path:   "/internal/users/" + userId.String() + "/reactivate",
+	})
+}
+
+func (c *Client) UpdateUserRole(ctx context.Context, userId uuid.UUID, role string) (*utiltypes.MessageResponse, error) {
+	return c.message(ctx, &request{
+		method: http.MethodPatch,
+		path:   "/internal/users/" + userId.String() + "/role",
+		body:   internaltypes.UpdateRoleRequest{Role: role},
+	})
+}
+
+func (c *Client) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	var response internaltypes.APIKeysResponse
+	err := c.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          "/internal/apikeys",
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response.APIKeys, nil
+}
+
+// CreateAPIKey returns the key, it can't be retrieved again
+func (c *Client) CreateAPIKey(ctx context.Context, apiKey internaltypes.CreateAPIKeyRequest) (*internaltypes.CreateAPIKeyResponse, error) {
+	var response internaltypes.CreateAPIKeyResponse
+	err := c.do(ctx, &request{
+		method:        http.MethodPost,
+		path:          "/internal/apikeys",
+		body:          apiKey,
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (c *Client) RevokeAPIKey(ctx context.Context, apiKeyId uint) (*utiltypes.MessageResponse, error) {
+	return c.message(ctx, &request{
+		method: http.MethodDelete,
+		path:   "/internal/apikeys/" + uintString(apiKeyId),
+	})
+}
+
+// AuditFilter narrows ListAuditEvents, dates are YYYY-MM-DD or RFC 3339
+type AuditFilter struct {
+	PageOptions
+	ActorId *uuid.UUID
+	Action  string
+	// EntityId is only used together with EntityType
+	EntityType string
+	EntityId   string
+	From       string
+	To         string
+}
+
+// ListAuditEvents lists audit events, newest first
+func (c *Client) ListAuditEvents(ctx context.Context, filter AuditFilter) (*AuditPage, error) {
+	query := filter.PageOptions.values()
+	if filter.ActorId != nil {
+		query.Set("actor_id", filter.ActorId.String())
+	}
+	setIf(query, "action", filter.Action)
+	setIf(query, "entity_type", filter.EntityType)
+	setIf(query, "entity_id", filter.EntityId)
+	setIf(query, "from", filter.From)
+	setIf(query, "to", filter.To)
+
+	var page AuditPage
+	err := c.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          "/internal/audit",
+		query:         query,
+		authenticated: true,
+	}, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
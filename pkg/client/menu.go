@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+type MenuOptions struct {
+	PageOptions
+	// only coffees that are or aren't in stock
+	InStock *bool
+}
+
+func (c *Client) GetMenu(ctx context.Context, options MenuOptions) (*MenuPage, error) {
+	query := options.values()
+	if options.InStock != nil {
+		query.Set("in_stock", strconv.FormatBool(*options.InStock))
+	}
+
+	var page MenuPage
+	err := c.do(ctx, &request{
+		method: http.MethodGet,
+		path:   "/menu",
+		query:  query,
+	}, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/internaltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/menutypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/purchasestypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+)
+
+// PageOptions selects a page of a list endpoint, pass the NextCursor of the
+// previous page as Cursor to get the next one. Zero values use the server
+// defaults.
+type PageOptions struct {
+	Page     int
+	PageSize int
+	Cursor   string
+}
+
+func (o PageOptions) values() url.Values {
+	values := url.Values{}
+	if o.Cursor != "" {
+		values.Set("cursor", o.Cursor)
+	} else if o.Page > 0 {
+		values.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.PageSize > 0 {
+		values.Set("page_size", strconv.Itoa(o.PageSize))
+	}
+	return values
+}
+
+// setIf sets key for non empty values
+func setIf(values url.Values, key, value string) {
+	if value != "" {
+		values.Set(key, value)
+	}
+}
+
+// The pages below are utiltypes.ListResponse with typed items
+
+type MenuPage struct {
+	utiltypes.ListResponse
+	Items []*menutypes.CoffeeResponse `json:"items"`
+}
+
+type HistoryPage struct {
+	utiltypes.ListResponse
+	Items []*purchasestypes.PurchaseHistoryResponse `json:"items"`
+}
+
+type PurchasePage struct {
+	utiltypes.ListResponse
+	Items []*internaltypes.PurchaseResponse `json:"items"`
+}
+
+type UserPage struct {
+	utiltypes.ListResponse
+	Items []*models.User `json:"items"`
+}
+
+type AuditPage struct {
+	utiltypes.ListResponse
+	Items []*models.AuditEvent `json:"items"`
+}
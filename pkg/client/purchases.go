@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/purchasestypes"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/utiltypes"
+	"github.com/google/uuid"
+)
+
+// PlaceOrder isn't retried unless it was rate limited, so a purchase is never
+// placed twice
+func (c *Client) PlaceOrder(ctx context.Context, order purchasestypes.PurchaseRequest) (*purchasestypes.PurchaseConfirmedResponse, error) {
+	var response purchasestypes.PurchaseConfirmedResponse
+	err := c.do(ctx, &request{
+		method:        http.MethodPost,
+		path:          "/purchases/purchase",
+		body:          order,
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetHistory lists the purchases of a user, newest first
+func (c *Client) GetHistory(ctx context.Context, userId uuid.UUID, options PageOptions) (*HistoryPage, error) {
+	var page HistoryPage
+	err := c.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          "/purchases/user/" + userId.String(),
+		query:         options.values(),
+		authenticated: true,
+	}, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (c *Client) GetPurchase(ctx context.Context, transactionId uint) (*purchasestypes.GetPurchaseResponse, error) {
+	var response purchasestypes.GetPurchaseResponse
+	err := c.do(ctx, &request{
+		method:        http.MethodGet,
+		path:          "/purchases/" + uintString(transactionId),
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// CancelOrder cancels an own purchase within the cancellation window, reason
+// is optional
+func (c *Client) CancelOrder(ctx context.Context, transactionId uint, reason string) (*utiltypes.MessageResponse, error) {
+	var response utiltypes.MessageResponse
+	err := c.do(ctx, &request{
+		method:        http.MethodPost,
+		path:          "/purchases/" + uintString(transactionId) + "/cancel",
+		body:          purchasestypes.CancelRequest{Reason: reason},
+		authenticated: true,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetReceipt renders the receipt of a purchase as html, text or pdf, an empty
+// format uses the server default
+func (c *Client) GetReceipt(ctx context.Context, transactionId uint, format string) ([]byte, error) {
+	query := url.Values{}
+	setIf(query, "format", format)
+
+	resp, err := c.send(ctx, &request{
+		method:        http.MethodGet,
+		path:          "/purchases/" + uintString(transactionId) + "/receipt",
+		query:         query,
+		authenticated: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func uintString(value uint) string {
+	return strconv.FormatUint(uint64(value), 10)
+}
@@ -0,0 +1,381 @@
+// Package config loads the server configuration from the environment, a .env
+// file and an optional YAML file. Environment variables override the YAML
+// file, which overrides the defaults.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+)
+
+// FileEnv names the environment variable with the path of the YAML file
+const FileEnv = "CONFIG_FILE"
+
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Database Database `yaml:"database"`
+	Redis    Redis    `yaml:"redis"`
+	Cache    Cache    `yaml:"cache"`
+	Auth     Auth     `yaml:"auth"`
+	Mail     Mail     `yaml:"mail"`
+	Shop     Shop     `yaml:"shop"`
+	API      API      `yaml:"api"`
+	CORS     CORS     `yaml:"cors"`
+	// RateLimits override the default limit of named rate limits, e.g.
+	// "menu": "120/m". RATE_LIMIT_{NAME} sets them from the environment.
+	RateLimits map[string]string `yaml:"rateLimits"`
+}
+
+type Server struct {
+	Port string `yaml:"port" env:"PORT"`
+	// MetricsPort serves /metrics on its own listener that shouldn't be
+	// exposed publicly, metrics aren't served when it's empty
+	MetricsPort string `yaml:"metricsPort" env:"METRICS_PORT"`
+	// Debug logs debug messages and every database query
+	Debug bool `yaml:"debug" env:"DEBUG"`
+	// TrustProxyHeaders takes client addresses from X-Forwarded-For, only
+	// enable it behind a proxy that sets it
+	TrustProxyHeaders bool          `yaml:"trustProxyHeaders" env:"TRUST_PROXY_HEADERS"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" env:"HTTP_IDLE_TIMEOUT"`
+	// ShutdownTimeout is how long requests in flight get to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+type Database struct {
+	URL string `yaml:"url" env:"DATABASE_URL"`
+}
+
+// Redis is optional, without it the cache and rate limits are kept in memory
+// of each instance
+type Redis struct {
+	URL string `yaml:"url" env:"REDIS_URL"`
+}
+
+// Cache drivers
+const (
+	CacheRedis  = "redis"
+	CacheMemory = "memory"
+	CacheNone   = "none"
+)
+
+// Menu TTLs used when CACHE_MENU_TTL isn't set. Changes to the menu only
+// invalidate the memory cache of the instance that made them, so other
+// instances only serve their pages for a short time.
+const (
+	DefaultMenuTTL       = 24 * time.Hour
+	DefaultMemoryMenuTTL = time.Minute
+)
+
+type Cache struct {
+	// Driver is "redis", "memory" or "none", when it's empty redis is used if
+	// REDIS_URL is set and memory otherwise
+	Driver string `yaml:"driver" env:"CACHE_DRIVER"`
+	// MemorySize is how many values the memory cache keeps
+	MemorySize int `yaml:"memorySize" env:"CACHE_MEMORY_SIZE"`
+	// MenuTTL is how long pages of the menu are cached, see MenuCacheTTL for
+	// the default
+	MenuTTL time.Duration `yaml:"menuTTL" env:"CACHE_MENU_TTL"`
+}
+
+type Auth struct {
+	// TokenSecret signs the JWTs and login state cookies
+	TokenSecret string `yaml:"tokenSecret" env:"token_password"`
+	// TokenTTL is how long auth tokens are valid, clients log in again after
+	TokenTTL time.Duration `yaml:"tokenTTL" env:"TOKEN_TTL"`
+	// AdminPassword is used for the admin created on first start, the server
+	// doesn't start with an empty users table without it
+	AdminPassword string `yaml:"adminPassword" env:"ADMIN_PASSWORD"`
+	// RequireAdmin2FA only grants admin permissions after two-factor
+	// authentication
+	RequireAdmin2FA bool `yaml:"requireAdmin2FA" env:"REQUIRE_ADMIN_2FA"`
+	// LoginMaxFailures failed logins are allowed per email before it is
+	// locked out for LoginLockout
+	LoginMaxFailures int           `yaml:"loginMaxFailures" env:"LOGIN_MAX_FAILURES"`
+	LoginLockout     time.Duration `yaml:"loginLockout" env:"LOGIN_LOCKOUT"`
+	// OIDC providers for single sign on, OIDC_PROVIDERS lists them in the
+	// environment
+	OIDC []OIDCProvider `yaml:"oidc"`
+}
+
+type OIDCProvider struct {
+	// Name is used in the login and callback urls
+	Name         string   `yaml:"name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"clientId"`
+	ClientSecret string   `yaml:"clientSecret"`
+	RedirectURL  string   `yaml:"redirectUrl"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// Mail is disabled unless SMTPHost is set
+type Mail struct {
+	SMTPHost     string `yaml:"smtpHost" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtpPort" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtpUsername" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtpPassword" env:"SMTP_PASSWORD"`
+	From         string `yaml:"from" env:"MAIL_FROM"`
+}
+
+type Shop struct {
+	// Name is shown on receipts and in authenticator apps
+	Name string `yaml:"name" env:"SHOP_NAME"`
+	// CancellationWindow is how long users can cancel their own purchases for
+	CancellationWindow time.Duration `yaml:"cancellationWindow" env:"CANCELLATION_WINDOW"`
+}
+
+type API struct {
+	// MaxPageSize is the largest page size clients can request on list
+	// endpoints
+	MaxPageSize int `yaml:"maxPageSize" env:"MAX_PAGE_SIZE"`
+	// SwaggerUI serves Swagger UI for /openapi.json at /docs
+	SwaggerUI bool `yaml:"swaggerUI" env:"SWAGGER_UI"`
+}
+
+// CORS lists are comma separated in the environment
+type CORS struct {
+	// AllowedOrigins are origins like "https://coffee.example.com", "*." in
+	// front of the host allows every subdomain and "*" allows any origin
+	AllowedOrigins []string `yaml:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods []string `yaml:"allowedMethods" env:"CORS_ALLOWED_METHODS"`
+	// AllowedHeaders are the request headers browsers may send
+	AllowedHeaders []string `yaml:"allowedHeaders" env:"CORS_ALLOWED_HEADERS"`
+	// ExposedHeaders are the response headers scripts can read
+	ExposedHeaders []string `yaml:"exposedHeaders" env:"CORS_EXPOSED_HEADERS"`
+	// AllowCredentials lets browsers send cookies, it can't be used with "*"
+	AllowCredentials bool `yaml:"allowCredentials" env:"CORS_ALLOW_CREDENTIALS"`
+	// MaxAge is how long browsers cache preflight responses
+	MaxAge time.Duration `yaml:"maxAge" env:"CORS_MAX_AGE"`
+}
+
+// Default returns the configuration used for everything that isn't set. It
+// has no secrets, so it doesn't pass Validate on its own.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:              "5000",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Cache: Cache{
+			MemorySize: 1000,
+		},
+		Auth: Auth{
+			TokenTTL:         24 * time.Hour,
+			LoginMaxFailures: 5,
+			LoginLockout:     15 * time.Minute,
+		},
+		Mail: Mail{
+			SMTPPort: "587",
+		},
+		Shop: Shop{
+			Name:               "Dollar Coffee Shop",
+			CancellationWindow: 15 * time.Minute,
+		},
+		API: API{
+			MaxPageSize: 100,
+		},
+		CORS: CORS{
+			AllowedOrigins: []string{"http://localhost:3000"},
+			AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-API-Key", "X-Request-ID", "X-Requested-With"},
+			ExposedHeaders: []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+		RateLimits: map[string]string{},
+	}
+}
+
+// Load reads .env if there is one, then the YAML file named by CONFIG_FILE and
+// the environment over the defaults. Variables already set in the environment
+// aren't overridden by .env.
+func Load() (*Config, error) {
+	err := godotenv.Load()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading .env: %v", err)
+	}
+
+	config := Default()
+	if path := os.Getenv(FileEnv); path != "" {
+		if err := config.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.ReadEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ReadFile overrides the configuration with the values set in the YAML file
+// at path, unknown keys are errors so typos don't go unnoticed
+func (c *Config) ReadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("parsing config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate fails on missing secrets and values the server can't run with, so
+// misconfigured servers don't start instead of failing on the first request
+func (c *Config) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Auth.TokenSecret == "" {
+		problem("token_password is required")
+	}
+	if c.Database.URL == "" {
+		problem("DATABASE_URL is required")
+	}
+	switch c.Cache.Driver {
+	case "", CacheMemory, CacheNone:
+	case CacheRedis:
+		if c.Redis.URL == "" {
+			problem("CACHE_DRIVER redis needs REDIS_URL")
+		}
+	default:
+		problem("CACHE_DRIVER %q isn't redis, memory or none", c.Cache.Driver)
+	}
+	if c.Cache.MemorySize <= 0 {
+		problem("CACHE_MEMORY_SIZE must be positive")
+	}
+	if c.Cache.MenuTTL < 0 {
+		problem("CACHE_MENU_TTL can't be negative")
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port <= 0 || port > 65535 {
+		problem("PORT %q isn't a port number", c.Server.Port)
+	}
+	if c.Server.MetricsPort != "" {
+		if port, err := strconv.Atoi(c.Server.MetricsPort); err != nil || port <= 0 || port > 65535 {
+			problem("METRICS_PORT %q isn't a port number", c.Server.MetricsPort)
+		} else if c.Server.MetricsPort == c.Server.Port {
+			problem("METRICS_PORT has to differ from PORT")
+		}
+	}
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"HTTP_READ_HEADER_TIMEOUT", c.Server.ReadHeaderTimeout},
+		{"HTTP_READ_TIMEOUT", c.Server.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.Server.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.Server.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout},
+		{"TOKEN_TTL", c.Auth.TokenTTL},
+		{"LOGIN_LOCKOUT", c.Auth.LoginLockout},
+		{"CANCELLATION_WINDOW", c.Shop.CancellationWindow},
+	}
+	for _, duration := range durations {
+		if duration.value <= 0 {
+			problem("%s must be positive", duration.name)
+		}
+	}
+	if c.Auth.LoginMaxFailures <= 0 {
+		problem("LOGIN_MAX_FAILURES must be positive")
+	}
+	if c.API.MaxPageSize <= 0 {
+		problem("MAX_PAGE_SIZE must be positive")
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			if c.CORS.AllowCredentials {
+				problem("CORS_ALLOW_CREDENTIALS can't be used with the origin *")
+			}
+			continue
+		}
+		if err := validateOrigin(origin); err != nil {
+			problem("CORS origin %q %v", origin, err)
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		problem("CORS_MAX_AGE can't be negative")
+	}
+
+	names := map[string]bool{}
+	for _, provider := range c.Auth.OIDC {
+		if provider.Name == "" {
+			problem("oidc providers need a name")
+			continue
+		}
+		if names[provider.Name] {
+			problem("oidc provider %s is configured twice", provider.Name)
+		}
+		names[provider.Name] = true
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			prefix := oidcEnvPrefix(provider.Name)
+			problem("oidc provider %s needs %sISSUER, %sCLIENT_ID and %sREDIRECT_URL", provider.Name, prefix, prefix, prefix)
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// validateOrigin accepts scheme://host[:port], the host can start with "*."
+func validateOrigin(origin string) error {
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return errors.New("needs a scheme and host")
+	}
+	if u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return errors.New("can only have a scheme, host and port")
+	}
+	if strings.Contains(u.Host, "*") {
+		return errors.New(`can only have a wildcard at the start of the host, like "https://*.example.com"`)
+	}
+	return nil
+}
+
+// Addr is the address the server listens on
+func (s Server) Addr() string {
+	return ":" + s.Port
+}
+
+// MetricsAddr is the address metrics are served on
+func (s Server) MetricsAddr() string {
+	return ":" + s.MetricsPort
+}
+
+// MenuCacheTTL is CACHE_MENU_TTL, or when it isn't set DefaultMemoryMenuTTL
+// for the memory cache and DefaultMenuTTL otherwise
+func (c *Config) MenuCacheTTL() time.Duration {
+	if c.Cache.MenuTTL > 0 {
+		return c.Cache.MenuTTL
+	}
+	// without a driver the memory cache is used unless redis is configured
+	if c.Cache.Driver == CacheMemory || (c.Cache.Driver == "" && c.Redis.URL == "") {
+		return DefaultMemoryMenuTTL
+	}
+	return DefaultMenuTTL
+}
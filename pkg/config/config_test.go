@@ -0,0 +1,182 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// secrets are the variables every config needs
+var secrets = []string{
+	"token_password=secret",
+	"DATABASE_URL=postgres://localhost/coffee",
+}
+
+func TestMissingSecrets(t *testing.T) {
+	err := Default().Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token_password is required")
+	assert.Contains(t, err.Error(), "DATABASE_URL is required")
+
+	config := Default()
+	require.NoError(t, config.ReadEnv(secrets))
+	assert.NoError(t, config.Validate())
+	assert.Equal(t, "secret", config.Auth.TokenSecret)
+}
+
+func TestReadEnv(t *testing.T) {
+	config := Default()
+	err := config.ReadEnv(append(secrets,
+		"PORT=8080",
+		"METRICS_PORT=9100",
+		"DEBUG=true",
+		"HTTP_WRITE_TIMEOUT=1m",
+		"MAX_PAGE_SIZE=50",
+		"CORS_ALLOWED_ORIGINS=https://coffee.example.com, http://localhost:3000,",
+		"RATE_LIMIT_MENU=120/m",
+		"OIDC_PROVIDERS=Google",
+		"OIDC_GOOGLE_ISSUER=https://accounts.google.com",
+		"OIDC_GOOGLE_CLIENT_ID=client",
+		"OIDC_GOOGLE_REDIRECT_URL=http://localhost:5000/auth/oidc/google/callback",
+		"OIDC_GOOGLE_SCOPES=openid email",
+	))
+	require.NoError(t, err)
+	require.NoError(t, config.Validate())
+
+	assert.Equal(t, ":8080", config.Server.Addr())
+	assert.Equal(t, ":9100", config.Server.MetricsAddr())
+	assert.True(t, config.Server.Debug)
+	assert.Equal(t, time.Minute, config.Server.WriteTimeout)
+	assert.Equal(t, 50, config.API.MaxPageSize)
+	assert.Equal(t, []string{"https://coffee.example.com", "http://localhost:3000"}, config.CORS.AllowedOrigins)
+	assert.Equal(t, map[string]string{"menu": "120/m"}, config.RateLimits)
+	assert.Equal(t, []OIDCProvider{{
+		Name:        "google",
+		Issuer:      "https://accounts.google.com",
+		ClientID:    "client",
+		RedirectURL: "http://localhost:5000/auth/oidc/google/callback",
+		Scopes:      []string{"openid", "email"},
+	}}, config.Auth.OIDC)
+
+	// unset variables keep their defaults
+	assert.Equal(t, 15*time.Second, config.Server.ReadTimeout)
+	assert.Equal(t, "Dollar Coffee Shop", config.Shop.Name)
+}
+
+func TestReadEnvInvalid(t *testing.T) {
+	for _, variable := range []string{
+		"HTTP_READ_TIMEOUT=soon",
+		"REQUIRE_ADMIN_2FA=maybe",
+		"LOGIN_MAX_FAILURES=five",
+	} {
+		err := Default().ReadEnv([]string{variable})
+		assert.Error(t, err, variable)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config := Default()
+	require.NoError(t, config.ReadEnv(append(secrets,
+		"PORT=http",
+		"METRICS_PORT=metrics",
+		"SHUTDOWN_TIMEOUT=0s",
+		"OIDC_PROVIDERS=okta",
+		"CACHE_DRIVER=redis",
+	)))
+
+	err := config.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `PORT "http" isn't a port number`)
+	assert.Contains(t, err.Error(), `METRICS_PORT "metrics" isn't a port number`)
+	assert.Contains(t, err.Error(), "SHUTDOWN_TIMEOUT must be positive")
+	assert.Contains(t, err.Error(), "oidc provider okta needs OIDC_OKTA_ISSUER")
+	assert.Contains(t, err.Error(), "CACHE_DRIVER redis needs REDIS_URL")
+}
+
+func TestMenuCacheTTL(t *testing.T) {
+	config := Default()
+	assert.Equal(t, DefaultMemoryMenuTTL, config.MenuCacheTTL())
+
+	config.Redis.URL = "redis://localhost:6379"
+	assert.Equal(t, DefaultMenuTTL, config.MenuCacheTTL())
+	config.Cache.Driver = CacheMemory
+	assert.Equal(t, DefaultMemoryMenuTTL, config.MenuCacheTTL())
+
+	// an explicit ttl applies to every driver
+	config.Cache.MenuTTL = time.Hour
+	assert.Equal(t, time.Hour, config.MenuCacheTTL())
+}
+
+func TestValidateCORS(t *testing.T) {
+	for origins, valid := range map[string]bool{
+		"http://localhost:3000":                            true,
+		"https://coffee.example.com,https://*.example.com": true,
+		"*":                        true,
+		"localhost:3000":           false,
+		"https://example.com/menu": false,
+		"https://coffee.*.com":     false,
+		"https://user@example.com": false,
+	} {
+		config := Default()
+		require.NoError(t, config.ReadEnv(append(secrets, "CORS_ALLOWED_ORIGINS="+origins)))
+		if valid {
+			assert.NoError(t, config.Validate(), origins)
+		} else {
+			assert.Error(t, config.Validate(), origins)
+		}
+	}
+
+	// browsers reject credentials for any origin
+	config := Default()
+	require.NoError(t, config.ReadEnv(append(secrets, "CORS_ALLOWED_ORIGINS=*", "CORS_ALLOW_CREDENTIALS=true")))
+	assert.Error(t, config.Validate())
+}
+
+func TestReadFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "config*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(`
+server:
+  port: "8080"
+  writeTimeout: 45s
+shop:
+  name: Corner Coffee
+cors:
+  allowedOrigins: [https://coffee.example.com]
+rateLimits:
+  menu: 60/m
+`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	config := Default()
+	require.NoError(t, config.ReadFile(file.Name()))
+	// the environment overrides the file
+	require.NoError(t, config.ReadEnv(append(secrets, "PORT=9000")))
+	require.NoError(t, config.Validate())
+
+	assert.Equal(t, "9000", config.Server.Port)
+	assert.Equal(t, 45*time.Second, config.Server.WriteTimeout)
+	assert.Equal(t, 30*time.Second, config.Server.ShutdownTimeout)
+	assert.Equal(t, "Corner Coffee", config.Shop.Name)
+	assert.Equal(t, []string{"https://coffee.example.com"}, config.CORS.AllowedOrigins)
+	assert.Equal(t, "60/m", config.RateLimits["menu"])
+}
+
+func TestReadFileUnknownKey(t *testing.T) {
+	file, err := ioutil.TempFile("", "config*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString("server:\n  prot: \"8080\"\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	assert.Error(t, Default().ReadFile(file.Name()))
+}
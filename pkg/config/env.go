@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	rateLimitEnvPrefix = "RATE_LIMIT_"
+	oidcProvidersEnv   = "OIDC_PROVIDERS"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ReadEnv overrides the configuration with the variables set in environ, in
+// the "NAME=value" format of os.Environ. Fields are named by their env tag,
+// rate limits and OIDC providers have their own variables.
+func (c *Config) ReadEnv(environ []string) error {
+	env := make(map[string]string, len(environ))
+	for _, variable := range environ {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	if err := setFromEnv(reflect.ValueOf(c).Elem(), env); err != nil {
+		return err
+	}
+
+	for name, value := range env {
+		if !strings.HasPrefix(name, rateLimitEnvPrefix) {
+			continue
+		}
+		if c.RateLimits == nil {
+			c.RateLimits = map[string]string{}
+		}
+		c.RateLimits[strings.ToLower(strings.TrimPrefix(name, rateLimitEnvPrefix))] = value
+	}
+
+	// providers listed in the environment replace the ones in the file
+	if providers, ok := env[oidcProvidersEnv]; ok {
+		c.Auth.OIDC = nil
+		for _, name := range strings.Split(providers, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			prefix := oidcEnvPrefix(name)
+			c.Auth.OIDC = append(c.Auth.OIDC, OIDCProvider{
+				Name:         name,
+				Issuer:       env[prefix+"ISSUER"],
+				ClientID:     env[prefix+"CLIENT_ID"],
+				ClientSecret: env[prefix+"CLIENT_SECRET"],
+				RedirectURL:  env[prefix+"REDIRECT_URL"],
+				Scopes:       strings.Fields(env[prefix+"SCOPES"]),
+			})
+		}
+	}
+
+	return nil
+}
+
+// oidcEnvPrefix prefixes the variables of the provider name, e.g. OIDC_GOOGLE_
+func oidcEnvPrefix(name string) string {
+	return "OIDC_" + strings.ToUpper(name) + "_"
+}
+
+// setFromEnv sets the fields of the struct value that have an env tag and a
+// variable in env, nested structs are walked
+func setFromEnv(value reflect.Value, env map[string]string) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		name, tagged := value.Type().Field(i).Tag.Lookup("env")
+		if !tagged {
+			if field.Kind() == reflect.Struct {
+				if err := setFromEnv(field, env); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		raw, ok := env[name]
+		if !ok {
+			continue
+		}
+		if err := setField(field, raw); err != nil {
+			return fmt.Errorf("invalid %s %q: %v", name, raw, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, raw string) error {
+	if field.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Slice:
+		// comma separated lists, empty values are dropped
+		values := []string{}
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
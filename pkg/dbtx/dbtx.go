@@ -0,0 +1,52 @@
+// Package dbtx runs work after database transactions commit, like
+// invalidating caches, so nothing happens for transactions that are rolled
+// back and other requests can't read the old rows back into the cache.
+package dbtx
+
+import (
+	"database/sql"
+
+	"github.com/jinzhu/gorm"
+)
+
+const afterCommitKey = "dbtx:after_commit"
+
+type callbacks struct {
+	fns []func()
+}
+
+// AfterCommit runs fn once tx is committed with Commit, in the order the
+// functions were added. When tx isn't a transaction fn runs right away.
+func AfterCommit(tx *gorm.DB, fn func()) {
+	if _, ok := tx.CommonDB().(*sql.Tx); !ok {
+		fn()
+		return
+	}
+
+	if value, ok := tx.Get(afterCommitKey); ok {
+		value.(*callbacks).fns = append(value.(*callbacks).fns, fn)
+		return
+	}
+	tx.InstantSet(afterCommitKey, &callbacks{fns: []func(){fn}})
+}
+
+// Commit commits tx, then runs the functions added with AfterCommit if it
+// succeeded. Every transaction should be committed with it, tx.Commit()
+// skips the functions.
+func Commit(tx *gorm.DB) error {
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	value, ok := tx.Get(afterCommitKey)
+	if !ok {
+		return nil
+	}
+	pending := value.(*callbacks)
+	fns := pending.fns
+	pending.fns = nil
+	for _, fn := range fns {
+		fn()
+	}
+	return nil
+}
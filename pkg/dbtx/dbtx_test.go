@@ -0,0 +1,76 @@
+package dbtx
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDriver only supports empty transactions, which is all these tests need
+type fakeDriver struct{}
+type fakeConn struct{}
+type fakeTx struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func init() {
+	sql.Register("dbtx_fake", fakeDriver{})
+}
+
+func openFakeDB(t *testing.T) *gorm.DB {
+	sqlDB, err := sql.Open("dbtx_fake", "")
+	require.NoError(t, err)
+	db, err := gorm.Open("dbtx_fake", sqlDB)
+	require.NoError(t, err)
+	return db
+}
+
+func TestAfterCommit(t *testing.T) {
+	db := openFakeDB(t)
+	defer db.Close()
+
+	tx := db.Begin()
+	var calls []string
+	AfterCommit(tx, func() { calls = append(calls, "first") })
+	AfterCommit(tx, func() { calls = append(calls, "second") })
+	assert.Empty(t, calls, "ran before commit")
+
+	require.NoError(t, Commit(tx))
+	assert.Equal(t, []string{"first", "second"}, calls)
+
+	// committing again fails without running them again
+	assert.Error(t, Commit(tx))
+	assert.Len(t, calls, 2)
+}
+
+func TestAfterCommitRollback(t *testing.T) {
+	db := openFakeDB(t)
+	defer db.Close()
+
+	tx := db.Begin()
+	AfterCommit(tx, func() { t.Error("ran after rollback") })
+	require.NoError(t, tx.Rollback().Error)
+}
+
+func TestAfterCommitWithoutTransaction(t *testing.T) {
+	db := openFakeDB(t)
+	defer db.Close()
+
+	ran := false
+	AfterCommit(db, func() { ran = true })
+	assert.True(t, ran)
+}
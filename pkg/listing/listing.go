@@ -0,0 +1,65 @@
+// Package listing holds the cursors, filters and sorts of list queries. They
+// are shared by the repositories and the persistence layer below them, so
+// persistence doesn't depend on the repository interfaces.
+package listing
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCursorSort is returned when a cursor is used on a listing that isn't sorted by created_at
+var ErrCursorSort = errors.New("cursors can only be used when sorting by created_at")
+
+// ErrInvalidSort is returned for sort keys or directions that aren't whitelisted
+var ErrInvalidSort = errors.New("invalid sort")
+
+// Cursor identifies an item in a listing ordered by (created_at, id)
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Payment statuses that purchases can be filtered by
+const (
+	PaymentStatusPaid    = "paid"
+	PaymentStatusUnpaid  = "unpaid"
+	PaymentStatusPartial = "partial"
+)
+
+var ErrInvalidPaymentStatus = errors.New("invalid payment status")
+
+// Columns that purchases can be sorted by
+const (
+	PurchaseSortCreatedAt  = "created_at"
+	PurchaseSortTotal      = "total"
+	PurchaseSortAmountPaid = "amount_paid"
+	PurchaseSortBalance    = "balance"
+)
+
+type PurchaseFilter struct {
+	UserId *string
+	// From is inclusive and To is exclusive
+	From          *time.Time
+	To            *time.Time
+	Status        *string
+	PaymentStatus *string
+	CoffeeId      *uint
+	MinTotal      *float64
+}
+
+type UserFilter struct {
+	Role *string
+	// Search matches the start of first names, last names or emails
+	Search *string
+}
+
+type AuditFilter struct {
+	ActorId    *string
+	Action     *string
+	EntityType *string
+	EntityId   *string
+	// From is inclusive and To is exclusive
+	From *time.Time
+	To   *time.Time
+}
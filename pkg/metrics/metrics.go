@@ -0,0 +1,160 @@
+// Package metrics collects Prometheus metrics for requests, database queries,
+// caches and purchases, served by Handler.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "dollar_coffee"
+
+// Registry holds every metric of the server, it isn't the global prometheus
+// registry so libraries can't add to it
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by operation and table.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache and result (hit, miss or error).",
+	}, []string{"cache", "result"})
+
+	purchasesPlaced = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purchases_placed_total",
+		Help:      "Purchases placed by customers.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		dbQueryDuration,
+		cacheRequests,
+		purchasesPlaced,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware counts requests and their latency by route template, so
+// /purchases/1 and /purchases/2 are both /purchases/{transactionId}. It has to
+// be used on the router so the route is known, unmatched requests aren't
+// counted.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+	})
+}
+
+const startKey = "metrics:start"
+
+// InstrumentDB times the queries gorm runs through its callbacks, raw Exec
+// calls aren't included
+func InstrumentDB(db *gorm.DB) {
+	callbacks := db.Callback()
+
+	before := func(scope *gorm.Scope) {
+		scope.Set(startKey, time.Now())
+	}
+	after := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			value, ok := scope.Get(startKey)
+			if !ok {
+				return
+			}
+			start, ok := value.(time.Time)
+			if !ok {
+				return
+			}
+			dbQueryDuration.WithLabelValues(operation, scope.TableName()).Observe(time.Since(start).Seconds())
+		}
+	}
+
+	callbacks.Create().Before("gorm:create").Register("metrics:before_create", before)
+	callbacks.Create().After("gorm:create").Register("metrics:after_create", after("create"))
+	callbacks.Query().Before("gorm:query").Register("metrics:before_query", before)
+	callbacks.Query().After("gorm:query").Register("metrics:after_query", after("query"))
+	callbacks.Update().Before("gorm:update").Register("metrics:before_update", before)
+	callbacks.Update().After("gorm:update").Register("metrics:after_update", after("update"))
+	callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", before)
+	callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete"))
+	callbacks.RowQuery().Before("gorm:row_query").Register("metrics:before_row_query", before)
+	callbacks.RowQuery().After("gorm:row_query").Register("metrics:after_row_query", after("row_query"))
+}
+
+// CacheHit, CacheMiss and CacheError count lookups in the named cache, e.g.
+// "menu". Errors are lookups that had to fall back to the database because
+// the cache couldn't be reached.
+func CacheHit(cache string) {
+	cacheRequests.WithLabelValues(cache, "hit").Inc()
+}
+
+func CacheMiss(cache string) {
+	cacheRequests.WithLabelValues(cache, "miss").Inc()
+}
+
+func CacheError(cache string) {
+	cacheRequests.WithLabelValues(cache, "error").Inc()
+}
+
+// PurchasePlaced counts a committed purchase
+func PurchasePlaced() {
+	purchasesPlaced.Inc()
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/test/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}).Methods("GET")
+
+	for _, path := range []string{"/test/1", "/test/2", "/test/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// requests are counted by route template rather than path
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues("/test/{id}", "GET", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues("/test/{id}", "GET", "404")))
+}
+
+func TestHandler(t *testing.T) {
+	CacheHit("test")
+	CacheMiss("test")
+	PurchasePlaced()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.String()
+	assert.True(t, strings.Contains(body, `dollar_coffee_cache_requests_total{cache="test",result="hit"} 1`), body)
+	assert.True(t, strings.Contains(body, `dollar_coffee_cache_requests_total{cache="test",result="miss"} 1`), body)
+	assert.True(t, strings.Contains(body, "dollar_coffee_purchases_placed_total 1"), body)
+	assert.True(t, strings.Contains(body, "go_goroutines"), body)
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// APIKey lets kiosks and integrations authenticate without logging in. Only
+// a hash of the key is stored, the prefix is used to look it up.
+type APIKey struct {
+	gorm.Model
+
+	Name   string `gorm:"type:varchar(255);not null" json:"name"`
+	Prefix string `gorm:"type:varchar(16);not null;unique_index" json:"prefix"`
+	Hash   string `gorm:"type:char(64);not null" json:"-"`
+
+	// comma separated permissions the key is limited to
+	Scopes string `gorm:"type:text;not null" json:"scopes"`
+
+	// keys bound to a user act as that user, within their scopes
+	UserId    *uuid.UUID `gorm:"column:user_id" json:"userId"`
+	CreatedBy uuid.UUID  `gorm:"column:created_by;not null" json:"createdBy"`
+
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+func (key *APIKey) IsRevoked() bool {
+	return key.RevokedAt != nil
+}
+
+func (key *APIKey) Permissions() []Permission {
+	if key.Scopes == "" {
+		return nil
+	}
+	scopes := strings.Split(key.Scopes, ",")
+	permissions := make([]Permission, 0, len(scopes))
+	for _, scope := range scopes {
+		permissions = append(permissions, Permission(scope))
+	}
+	return permissions
+}
+
+func (key *APIKey) SetPermissions(permissions []Permission) {
+	scopes := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		scopes = append(scopes, string(permission))
+	}
+	key.Scopes = strings.Join(scopes, ",")
+}
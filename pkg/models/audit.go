@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// Audit actions, named {entity}.{verb}
+const (
+	AuditCoffeeCreate = "coffee.create"
+	AuditCoffeeUpdate = "coffee.update"
+	AuditCoffeeDelete = "coffee.delete"
+
+	AuditPurchasePayment = "purchase.payment"
+	AuditPurchaseStatus  = "purchase.status"
+	AuditPurchaseCancel  = "purchase.cancel"
+
+	AuditUserCreate     = "user.create"
+	AuditUserUpdate     = "user.update"
+	AuditUserDelete     = "user.delete"
+	AuditUserDeactivate = "user.deactivate"
+	AuditUserReactivate = "user.reactivate"
+	AuditUserRole       = "user.role"
+	AuditUser2FAEnable  = "user.2fa_enable"
+	AuditUser2FADisable = "user.2fa_disable"
+
+	AuditAPIKeyCreate = "apikey.create"
+	AuditAPIKeyRevoke = "apikey.revoke"
+
+	AuditLoginLockout = "login.lockout"
+)
+
+// Audited entity types
+const (
+	AuditEntityCoffee   = "coffee"
+	AuditEntityPurchase = "purchase"
+	AuditEntityUser     = "user"
+	AuditEntityAPIKey   = "apikey"
+	// login lockouts are recorded against the email that was tried
+	AuditEntityAccount = "account"
+)
+
+// AuditEvent records who changed what. Events are append only, they are never
+// updated or deleted.
+type AuditEvent struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+
+	// nil for events without a logged in actor, like login lockouts
+	ActorId       *uuid.UUID `gorm:"column:actor_id;index" json:"actorId"`
+	ActorAPIKeyId *uint      `gorm:"column:actor_api_key_id" json:"actorApiKeyId,omitempty"`
+
+	Action     string `gorm:"type:varchar(64);not null" json:"action"`
+	EntityType string `gorm:"type:varchar(32);not null;index:idx_audit_events_entity" json:"entityType"`
+	EntityId   string `gorm:"type:varchar(320);index:idx_audit_events_entity" json:"entityId"`
+
+	// changed fields as {"field": {"before": ..., "after": ...}}
+	Changes postgres.Jsonb `gorm:"type:jsonb" json:"changes"`
+
+	RequestId string `gorm:"type:varchar(64)" json:"requestId"`
+	IP        string `gorm:"column:ip;type:varchar(64)" json:"ip"`
+}
@@ -9,4 +9,7 @@ type Coffee struct {
 	Price       float64 `json:"price" gorm:"type:decimal(12,2);not null"`
 	Description string  `json:"description" gorm:"type:text"`
 	InStock     bool    `json:"inStock" gorm:"type:boolean;default:true"`
+
+	// Stock is the number of units left, nil if stock isn't tracked for this coffee
+	Stock *int `json:"stock" gorm:"column:stock"`
 }
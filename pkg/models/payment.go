@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	PaymentKindPayment = "payment"
+	PaymentKindRefund  = "refund"
+	// corrections lower the amount paid when too much was recorded
+	PaymentKindCorrection = "correction"
+)
+
+// Payment records money moving in or out of a transaction. Refunds and
+// corrections are stored as positive amounts with their own kind.
+type Payment struct {
+	gorm.Model
+
+	TransactionId uint      `gorm:"column:transaction_id;not null;index" json:"-"`
+	Amount        float64   `gorm:"type:decimal(12,2);not null" json:"amount"`
+	Kind          string    `gorm:"type:varchar(10);not null" json:"kind"`
+	RecordedBy    uuid.UUID `gorm:"column:recorded_by;not null" json:"recordedBy"`
+	Note          string    `gorm:"type:text" json:"note"`
+}
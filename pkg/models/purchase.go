@@ -1,10 +1,28 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 )
 
+const (
+	TransactionStatusPlaced    = "placed"
+	TransactionStatusPreparing = "preparing"
+	TransactionStatusReady     = "ready"
+	TransactionStatusCompleted = "completed"
+	TransactionStatusCancelled = "cancelled"
+)
+
+// orders move through these statuses in order, cancelled is handled separately
+var transactionStatusOrder = map[string]int{
+	TransactionStatusPlaced:    0,
+	TransactionStatusPreparing: 1,
+	TransactionStatusReady:     2,
+	TransactionStatusCompleted: 3,
+}
+
 type Transaction struct {
 	gorm.Model
 
@@ -12,6 +30,12 @@ type Transaction struct {
 	Items      []*PurchaseItem `gorm:"foreignkey:transaction_id;PRELOAD:true"`
 	AmountPaid float64         `gorm:"type:decimal(12,2);not null"`
 	Total      float64         `gorm:"type:decimal(12,2);not null"`
+
+	// Cancelled transactions are kept for history instead of being deleted
+	Status             string     `gorm:"type:varchar(20);not null;default:'placed'"`
+	CancelledAt        *time.Time `gorm:"column:cancelled_at"`
+	CancelledBy        *uuid.UUID `gorm:"column:cancelled_by"`
+	CancellationReason string     `gorm:"type:text"`
 }
 
 type PurchaseItem struct {
@@ -22,3 +46,33 @@ type PurchaseItem struct {
 	Price         float64 `gorm:"type:decimal(12,2);not null" json:"price"`
 	TypeOption    string  `gorm:"type:text" json:"options"` //americano, latte, pourover, espresso, additional sugar/milk/cream
 }
+
+// PurchaseItemDetail is a purchase item joined with the coffee it is for
+type PurchaseItemDetail struct {
+	ID            uint
+	TransactionId uint
+	CoffeeId      uint
+	CoffeeName    string
+	Price         float64
+	TypeOption    string
+}
+
+func (transaction *Transaction) IsCancelled() bool {
+	return transaction.Status == TransactionStatusCancelled
+}
+
+func IsValidTransactionStatus(status string) bool {
+	_, ok := transactionStatusOrder[status]
+	return ok || status == TransactionStatusCancelled
+}
+
+// CanAdvanceTo reports whether the order can move forward to status,
+// orders can't go back and cancelled orders can't be advanced
+func (transaction *Transaction) CanAdvanceTo(status string) bool {
+	current, ok := transactionStatusOrder[transaction.Status]
+	if !ok {
+		return false
+	}
+	next, ok := transactionStatusOrder[status]
+	return ok && next > current
+}
@@ -0,0 +1,83 @@
+package models
+
+// Permission is an action a role or API key is allowed to perform
+type Permission string
+
+const (
+	PermissionOrdersCreate   Permission = "orders:create"
+	PermissionOrdersRead     Permission = "orders:read"
+	PermissionOrdersUpdate   Permission = "orders:update"
+	PermissionOrdersCancel   Permission = "orders:cancel"
+	PermissionPaymentsRecord Permission = "payments:record"
+	PermissionMenuEdit       Permission = "menu:edit"
+	PermissionUsersRead      Permission = "users:read"
+	PermissionUsersManage    Permission = "users:manage"
+	PermissionAPIKeysManage  Permission = "apikeys:manage"
+	PermissionAuditRead      Permission = "audit:read"
+)
+
+const (
+	RoleUser      = "user"
+	RoleBarista   = "barista"
+	RoleTreasurer = "treasurer"
+	RoleManager   = "manager"
+	RoleAdmin     = "admin"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleUser: {
+		PermissionOrdersCreate,
+	},
+	RoleBarista: {
+		PermissionOrdersCreate,
+		PermissionOrdersRead,
+		PermissionOrdersUpdate,
+	},
+	RoleTreasurer: {
+		PermissionOrdersCreate,
+		PermissionOrdersRead,
+		PermissionOrdersCancel,
+		PermissionPaymentsRecord,
+	},
+	RoleManager: {
+		PermissionOrdersCreate,
+		PermissionOrdersRead,
+		PermissionOrdersUpdate,
+		PermissionOrdersCancel,
+		PermissionPaymentsRecord,
+		PermissionMenuEdit,
+		PermissionUsersRead,
+	},
+	RoleAdmin: {
+		PermissionOrdersCreate,
+		PermissionOrdersRead,
+		PermissionOrdersUpdate,
+		PermissionOrdersCancel,
+		PermissionPaymentsRecord,
+		PermissionMenuEdit,
+		PermissionUsersRead,
+		PermissionUsersManage,
+		PermissionAPIKeysManage,
+		PermissionAuditRead,
+	},
+}
+
+// IsValidPermission relies on admins having every permission
+func IsValidPermission(permission Permission) bool {
+	return RoleHasPermission(RoleAdmin, permission)
+}
+
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleHasPermission returns false for unknown roles
+func RoleHasPermission(role string, permission Permission) bool {
+	for _, rolePermission := range rolePermissions[role] {
+		if rolePermission == permission {
+			return true
+		}
+	}
+	return false
+}
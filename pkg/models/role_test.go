@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleHasPermission(t *testing.T) {
+	assert.True(t, RoleHasPermission(RoleBarista, PermissionOrdersUpdate))
+	assert.False(t, RoleHasPermission(RoleBarista, PermissionMenuEdit))
+	assert.False(t, RoleHasPermission(RoleBarista, PermissionUsersManage))
+	assert.True(t, RoleHasPermission(RoleTreasurer, PermissionPaymentsRecord))
+	assert.False(t, RoleHasPermission(RoleManager, PermissionUsersManage))
+	assert.True(t, RoleHasPermission(RoleAdmin, PermissionUsersManage))
+	assert.False(t, RoleHasPermission(RoleUser, PermissionOrdersRead))
+	assert.False(t, RoleHasPermission("unknown", PermissionOrdersRead))
+
+	assert.True(t, IsValidRole(RoleTreasurer))
+	assert.False(t, IsValidRole("superuser"))
+}
+
+func TestTransactionCanAdvanceTo(t *testing.T) {
+	transaction := Transaction{Status: TransactionStatusPlaced}
+	assert.True(t, transaction.CanAdvanceTo(TransactionStatusPreparing))
+	assert.True(t, transaction.CanAdvanceTo(TransactionStatusCompleted))
+	assert.False(t, transaction.CanAdvanceTo(TransactionStatusPlaced))
+	assert.False(t, transaction.CanAdvanceTo(TransactionStatusCancelled))
+
+	transaction.Status = TransactionStatusReady
+	assert.False(t, transaction.CanAdvanceTo(TransactionStatusPreparing))
+
+	transaction.Status = TransactionStatusCancelled
+	assert.False(t, transaction.CanAdvanceTo(TransactionStatusCompleted))
+}
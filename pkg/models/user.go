@@ -1,13 +1,17 @@
 package models
 
 import (
-	"errors"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
 
-	"gopkg.in/go-playground/validator.v9"
+const (
+	// TokenPurposeTwoFactor tokens can only be exchanged for an auth token
+	// together with a second factor
+	TokenPurposeTwoFactor = "2fa"
 )
 
 type Token struct {
@@ -15,8 +19,13 @@ type Token struct {
 
 	UserId uuid.UUID
 
-	// can be either user or admin
+	// one of the roles in role.go
 	Role string
+
+	// empty for auth tokens
+	Purpose string `json:",omitempty"`
+	// set when the user logged in with a second factor
+	MFA bool `json:",omitempty"`
 }
 
 type User struct {
@@ -25,28 +34,45 @@ type User struct {
 	UpdatedAt time.Time
 	DeletedAt *time.Time
 
-	FirstName   string  `json:"firstName" gorm:"type:varchar(255);not null"`
-	LastName    string  `json:"lastName" gorm:"type:varchar(255);not null"`
-	Email       string  `json:"email" gorm:"type:varchar(320);not null;unique_index" validate:"required,email"`
-	PhoneNumber *string `json:"phoneNumber" gorm:"type:char(9)"`
+	FirstName   string  `json:"firstName" gorm:"type:varchar(255);not null" validate:"notblank,max=255"`
+	LastName    string  `json:"lastName" gorm:"type:varchar(255);not null" validate:"notblank,max=255"`
+	Email       string  `json:"email" gorm:"type:varchar(320);not null;unique_index" validate:"required,email,max=320"`
+	PhoneNumber *string `json:"phoneNumber" gorm:"type:char(9)" validate:"omitempty,max=9"`
 
-	Password string `json:"password,omitempty"`
+	Password string `json:"password,omitempty" validate:"min=8"`
 	Token    string `json:"token,omitempty" gorm:"-"`
 
 	// Role
 	Role string `gorm:"type:varchar(10);default:'user'"`
+
+	// Deactivated users can't log in or use previously issued tokens
+	DeactivatedAt *time.Time `json:"deactivatedAt"`
+	// Set for users created with a temporary password
+	MustChangePassword bool `json:"mustChangePassword"`
+
+	// Two-factor authentication, the secret is set on enrollment and only
+	// used for logins once the user confirmed it
+	TOTPSecret  string `json:"-" gorm:"column:totp_secret"`
+	TOTPEnabled bool   `json:"totpEnabled" gorm:"column:totp_enabled"`
+	// last time step a code was used for, codes can't be used twice
+	TOTPLastStep int64 `json:"-" gorm:"column:totp_last_step"`
 }
 
-func (user *User) Validate() error {
-	v := validator.New()
-	err := v.Struct(user)
-	if err != nil {
-		return errors.New("Invalid Email Address")
-	}
+// RecoveryCode is a single use code for logging in without the second factor
+type RecoveryCode struct {
+	gorm.Model
 
-	if len(user.Password) < 8 {
-		return errors.New("Password must be at least 8 characters")
-	}
+	UserId uuid.UUID  `gorm:"column:user_id;not null;index"`
+	Hash   string     `gorm:"type:char(64);not null"`
+	UsedAt *time.Time `gorm:"column:used_at"`
+}
+
+func (user *User) IsDeactivated() bool {
+	return user.DeactivatedAt != nil
+}
 
-	return nil
+// Validate checks a user before it's created, every invalid field is
+// reported in the returned validator.ValidationErrors
+func (user *User) Validate() error {
+	return Validate(user)
 }
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+var validate = newValidator()
+
+// newValidator reports fields by their json names and knows the tags below
+// besides the ones built into validator:
+//   - notblank: strings can't be only whitespace
+//   - role: one of the roles in role.go
+//   - permission: one of the permissions in role.go
+//   - transaction_status: one of the statuses in purchase.go
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	validations := map[string]validator.Func{
+		"notblank": func(fl validator.FieldLevel) bool {
+			return strings.TrimSpace(fl.Field().String()) != ""
+		},
+		"role": func(fl validator.FieldLevel) bool {
+			return IsValidRole(fl.Field().String())
+		},
+		"permission": func(fl validator.FieldLevel) bool {
+			return IsValidPermission(Permission(fl.Field().String()))
+		},
+		"transaction_status": func(fl validator.FieldLevel) bool {
+			return IsValidTransactionStatus(fl.Field().String())
+		},
+	}
+	for tag, fn := range validations {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			panic(err)
+		}
+	}
+	return v
+}
+
+// Validate checks the validate tags of a model or request body, failures are
+// returned as validator.ValidationErrors
+func Validate(s interface{}) error {
+	return validate.Struct(s)
+}
+
+// ValidationEnums lists the values accepted by the custom validate tags, e.g.
+// for documenting them
+func ValidationEnums() map[string][]string {
+	permissions := []string{}
+	for _, permission := range rolePermissions[RoleAdmin] {
+		permissions = append(permissions, string(permission))
+	}
+
+	return map[string][]string{
+		"role":       {RoleUser, RoleBarista, RoleTreasurer, RoleManager, RoleAdmin},
+		"permission": permissions,
+		"transaction_status": {
+			TransactionStatusPlaced,
+			TransactionStatusPreparing,
+			TransactionStatusReady,
+			TransactionStatusCompleted,
+			TransactionStatusCancelled,
+		},
+	}
+}
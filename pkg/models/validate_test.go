@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+func TestUserValidate(t *testing.T) {
+	user := User{
+		FirstName: "Jane",
+		LastName:  "Doe",
+		Email:     "jane@example.com",
+		Password:  "password",
+	}
+	assert.NoError(t, user.Validate())
+
+	// every invalid field is reported
+	user = User{
+		FirstName: " ",
+		Email:     "jane",
+		Password:  "short",
+	}
+	err := user.Validate()
+	require.IsType(t, validator.ValidationErrors{}, err)
+
+	failed := map[string]string{}
+	for _, fieldErr := range err.(validator.ValidationErrors) {
+		failed[fieldErr.Field()] = fieldErr.Tag()
+	}
+	assert.Equal(t, map[string]string{
+		"firstName": "notblank",
+		"lastName":  "notblank",
+		"email":     "email",
+		"password":  "min",
+	}, failed)
+}
+
+func TestValidateCustomTags(t *testing.T) {
+	type request struct {
+		Role   string   `json:"role" validate:"role"`
+		Scopes []string `json:"scopes" validate:"dive,permission"`
+		Status string   `json:"status" validate:"transaction_status"`
+	}
+
+	assert.NoError(t, Validate(&request{
+		Role:   RoleBarista,
+		Scopes: []string{string(PermissionMenuEdit)},
+		Status: TransactionStatusReady,
+	}))
+
+	err := Validate(&request{
+		Role:   "superuser",
+		Scopes: []string{string(PermissionMenuEdit), "everything"},
+		Status: "lost",
+	})
+	require.Error(t, err)
+	namespaces := []string{}
+	for _, fieldErr := range err.(validator.ValidationErrors) {
+		namespaces = append(namespaces, fieldErr.Namespace())
+	}
+	assert.Equal(t, []string{"request.role", "request.scopes[1]", "request.status"}, namespaces)
+}
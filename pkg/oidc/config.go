@@ -0,0 +1,16 @@
+package oidc
+
+import (
+	"net/http"
+	"strings"
+)
+
+// NewProviders creates a provider for every config by its lower case name
+func NewProviders(configs []Config, client *http.Client) map[string]*Provider {
+	providers := make(map[string]*Provider, len(configs))
+	for _, config := range configs {
+		config.Name = strings.ToLower(config.Name)
+		providers[config.Name] = NewProvider(config, client)
+	}
+	return providers
+}
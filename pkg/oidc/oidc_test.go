@@ -0,0 +1,133 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURL = "http://localhost:5000/auth/oidc/test/callback"
+
+func newTestProvider(server *test.OIDCServer) *Provider {
+	return NewProvider(Config{
+		Name:         "test",
+		Issuer:       server.URL,
+		ClientID:     test.OIDCClientID,
+		ClientSecret: test.OIDCClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, server.Client())
+}
+
+// login follows the provider login page back to the callback and returns
+// the query parameters the callback receives
+func login(t *testing.T, provider *Provider, state string, nonce string) url.Values {
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce)
+	require.NoError(t, err)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "/auth/oidc/test/callback", callback.Path)
+	return callback.Query()
+}
+
+func TestLoginFlow(t *testing.T) {
+	server := test.NewOIDCServer(t)
+	defer server.Close()
+	server.User = test.OIDCUser{
+		Subject:       "1234",
+		Email:         "test@testtest.test",
+		EmailVerified: true,
+		GivenName:     "Test",
+		FamilyName:    "test",
+	}
+	provider := newTestProvider(server)
+
+	callback := login(t, provider, "state", "nonce")
+	assert.Equal(t, "state", callback.Get("state"))
+
+	claims, err := provider.Exchange(context.Background(), callback.Get("code"), "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, "1234", claims.Subject)
+	assert.Equal(t, "test@testtest.test", claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, "Test", claims.GivenName)
+	assert.Equal(t, "test", claims.FamilyName)
+
+	// codes can only be used once
+	_, err = provider.Exchange(context.Background(), callback.Get("code"), "nonce")
+	assert.Error(t, err)
+}
+
+func TestExchangeNonceMismatch(t *testing.T) {
+	server := test.NewOIDCServer(t)
+	defer server.Close()
+	provider := newTestProvider(server)
+
+	callback := login(t, provider, "state", "nonce")
+
+	_, err := provider.Exchange(context.Background(), callback.Get("code"), "othernonce")
+	assert.Equal(t, ErrNonceMismatch, err)
+}
+
+func TestExchangeInvalidTokens(t *testing.T) {
+	server := test.NewOIDCServer(t)
+	defer server.Close()
+	provider := newTestProvider(server)
+
+	wrongAudience := server.Claims("nonce")
+	wrongAudience["aud"] = []string{"other-client"}
+
+	wrongIssuer := server.Claims("nonce")
+	wrongIssuer["iss"] = "https://example.com"
+
+	expired := server.Claims("nonce")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	for name, claims := range map[string]map[string]interface{}{
+		"audience": wrongAudience,
+		"issuer":   wrongIssuer,
+		"expired":  expired,
+	} {
+		t.Run(name, func(t *testing.T) {
+			code := server.IssueCode(server.SignIDToken(claims))
+			_, err := provider.Exchange(context.Background(), code, "nonce")
+			assert.Equal(t, ErrInvalidIDToken, err)
+		})
+	}
+}
+
+func TestExchangeAudienceList(t *testing.T) {
+	server := test.NewOIDCServer(t)
+	defer server.Close()
+	provider := newTestProvider(server)
+
+	claims := server.Claims("nonce")
+	claims["aud"] = []string{"other-client", test.OIDCClientID}
+	claims["email_verified"] = "true"
+
+	code := server.IssueCode(server.SignIDToken(claims))
+	verified, err := provider.Exchange(context.Background(), code, "nonce")
+	require.NoError(t, err)
+	assert.True(t, verified.EmailVerified)
+}
+
+func TestSecureCallback(t *testing.T) {
+	assert.False(t, NewProvider(Config{RedirectURL: testRedirectURL}, nil).SecureCallback())
+	assert.True(t, NewProvider(Config{RedirectURL: "https://coffee.example.com/auth/oidc/test/callback"}, nil).SecureCallback())
+}
@@ -0,0 +1,388 @@
+// Package openapi builds an OpenAPI 3 document from mux routes and the Go
+// types of their request and response bodies.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const Version = "3.0.3"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower case methods to operations
+type PathItem map[string]*Operation
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+const (
+	securityBearer = "bearerAuth"
+	securityAPIKey = "apiKey"
+)
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationId string                `json:"operationId,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	// permission the caller needs, see models.Permission
+	Permission string `json:"x-permission,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Route describes what a route accepts and returns, the path, path
+// parameters and methods are taken from the mux route
+type Route struct {
+	Summary     string
+	Description string
+	// Auth routes need a bearer token or an API key
+	Auth bool
+	// Permission implies Auth
+	Permission string
+	Query      []*Parameter
+	// Request is a value of the JSON request body type, nil for no body
+	Request interface{}
+	// Status of successful responses, defaults to 200
+	Status int
+	// Response is a value of the JSON response body type, nil for no body
+	Response interface{}
+	// ContentTypes of responses that aren't JSON, documented as binary
+	ContentTypes []string
+}
+
+// Query documents an optional query parameter of type string, integer,
+// number or boolean
+func Query(name, schemaType, description string) *Parameter {
+	return &Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Schema:      &Schema{Type: schemaType},
+	}
+}
+
+// Spec collects documented routes, it's safe to serve while routes are added
+type Spec struct {
+	mu       sync.RWMutex
+	info     Info
+	paths    map[string]PathItem
+	schemas  *schemaBuilder
+	errorRef *Schema
+}
+
+// New creates a spec, error responses of every route are documented with
+// errorBody's type and enums lists the values of custom validate tags
+func New(info Info, errorBody interface{}, enums map[string][]string) *Spec {
+	spec := &Spec{
+		info:    info,
+		paths:   map[string]PathItem{},
+		schemas: newSchemaBuilder(enums),
+	}
+	spec.errorRef = spec.schemas.schemaOf(errorBody)
+	return spec
+}
+
+// Describe documents route for each of its methods
+func (s *Spec) Describe(route *mux.Route, doc Route) {
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		panic(err)
+	}
+	methods, err := route.GetMethods()
+	if err != nil {
+		panic(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, parameters := pathParameters(template)
+	item, ok := s.paths[path]
+	if !ok {
+		item = PathItem{}
+		s.paths[path] = item
+	}
+	for _, method := range methods {
+		item[strings.ToLower(method)] = s.operation(method, path, parameters, &doc)
+	}
+}
+
+func (s *Spec) operation(method, path string, parameters []*Parameter, doc *Route) *Operation {
+	op := &Operation{
+		Summary:     doc.Summary,
+		Description: doc.Description,
+		OperationId: operationId(method, path),
+		Parameters:  append(append([]*Parameter{}, parameters...), doc.Query...),
+		Responses:   map[string]*Response{},
+		Permission:  doc.Permission,
+	}
+
+	// the first path segment is the module
+	if segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2); segments[0] != "" {
+		op.Tags = []string{segments[0]}
+	}
+
+	if doc.Auth || doc.Permission != "" {
+		op.Security = []map[string][]string{
+			{securityBearer: {}},
+			{securityAPIKey: {}},
+		}
+	}
+	if doc.Permission != "" {
+		requires := "Requires the `" + doc.Permission + "` permission."
+		if op.Description != "" {
+			requires = op.Description + "\n\n" + requires
+		}
+		op.Description = requires
+	}
+
+	if doc.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				"application/json": {Schema: s.schemas.schemaOf(doc.Request)},
+			},
+		}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := &Response{Description: http.StatusText(status)}
+	if doc.Response != nil {
+		response.Content = map[string]*MediaType{
+			"application/json": {Schema: s.schemas.schemaOf(doc.Response)},
+		}
+	} else if len(doc.ContentTypes) > 0 {
+		response.Content = map[string]*MediaType{}
+		for _, contentType := range doc.ContentTypes {
+			response.Content[contentType] = &MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+		}
+	}
+	op.Responses[itoa(status)] = response
+	op.Responses["default"] = &Response{
+		Description: "Error",
+		Content: map[string]*MediaType{
+			"application/json": {Schema: s.errorRef},
+		},
+	}
+	return op
+}
+
+// Document returns a snapshot of the spec
+func (s *Spec) Document() *Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	paths := make(map[string]PathItem, len(s.paths))
+	for path, item := range s.paths {
+		copied := make(PathItem, len(item))
+		for method, op := range item {
+			copied[method] = op
+		}
+		paths[path] = copied
+	}
+
+	return &Document{
+		OpenAPI: Version,
+		Info:    s.info,
+		Paths:   paths,
+		Components: Components{
+			Schemas: s.schemas.components(),
+			SecuritySchemes: map[string]*SecurityScheme{
+				securityBearer: {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+					Description:  "Token returned by /auth/login",
+				},
+				securityAPIKey: {
+					Type:        "apiKey",
+					In:          "header",
+					Name:        "X-API-Key",
+					Description: "API key created at /internal/apikeys",
+				},
+			},
+		},
+	}
+}
+
+// Handler serves the spec as JSON
+func (s *Spec) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(s.Document()); err != nil {
+			log.WithError(err).Warn()
+		}
+	}
+}
+
+// Operations lists "METHOD /path" for every documented operation, sorted
+func (d *Document) Operations() []string {
+	operations := []string{}
+	for path, item := range d.Paths {
+		for method := range item {
+			operations = append(operations, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(operations)
+	return operations
+}
+
+// References lists the component references used anywhere in the document
+func (d *Document) References() []string {
+	seen := map[string]bool{}
+	var walk func(schema *Schema)
+	walk = func(schema *Schema) {
+		if schema == nil {
+			return
+		}
+		if schema.Ref != "" {
+			seen[schema.Ref] = true
+		}
+		walk(schema.Items)
+		walk(schema.AdditionalProperties)
+		for _, property := range schema.Properties {
+			walk(property)
+		}
+		for _, option := range append(append([]*Schema{}, schema.AllOf...), schema.OneOf...) {
+			walk(option)
+		}
+	}
+	walkContent := func(content map[string]*MediaType) {
+		for _, mediaType := range content {
+			walk(mediaType.Schema)
+		}
+	}
+
+	for _, item := range d.Paths {
+		for _, op := range item {
+			for _, parameter := range op.Parameters {
+				walk(parameter.Schema)
+			}
+			if op.RequestBody != nil {
+				walkContent(op.RequestBody.Content)
+			}
+			for _, response := range op.Responses {
+				walkContent(response.Content)
+			}
+		}
+	}
+	for _, schema := range d.Components.Schemas {
+		walk(schema)
+	}
+
+	references := []string{}
+	for ref := range seen {
+		references = append(references, ref)
+	}
+	sort.Strings(references)
+	return references
+}
+
+var pathVariable = regexp.MustCompile(`\{([^}:]+)(?::([^}]+))?\}`)
+
+// PathTemplate turns a mux path template into an OpenAPI path, e.g.
+// /apikeys/{apiKeyId:[0-9]+} is /apikeys/{apiKeyId}
+func PathTemplate(template string) string {
+	return pathVariable.ReplaceAllString(template, "{$1}")
+}
+
+// pathParameters turns mux variables like {id:[0-9]+} into OpenAPI path
+// parameters
+func pathParameters(template string) (string, []*Parameter) {
+	parameters := []*Parameter{}
+	for _, match := range pathVariable.FindAllStringSubmatch(template, -1) {
+		schema := &Schema{Type: "string"}
+		if match[2] == "[0-9]+" {
+			schema = &Schema{Type: "integer", Minimum: float64Ptr(0)}
+		} else if match[2] != "" {
+			schema.Pattern = "^" + match[2] + "$"
+		}
+		parameters = append(parameters, &Parameter{
+			Name:     match[1],
+			In:       "path",
+			Required: true,
+			Schema:   schema,
+		})
+	}
+	return PathTemplate(template), parameters
+}
+
+// operationId names operations after their method and path, e.g.
+// GET /purchases/user/{userId} is getPurchasesUserByUserId
+func operationId(method, path string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, "{") {
+			id += "By"
+			segment = strings.Trim(segment, "{}")
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
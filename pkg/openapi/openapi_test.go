@@ -0,0 +1,138 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testError struct {
+	Message string `json:"message"`
+}
+
+type testItem struct {
+	CoffeeId uint   `json:"coffeeId" validate:"required"`
+	Options  string `json:"options" validate:"max=255"`
+}
+
+type testRequest struct {
+	Name     string     `json:"name" validate:"notblank,max=10"`
+	Price    *float64   `json:"price" validate:"omitempty,gt=0"`
+	Role     string     `json:"role" validate:"omitempty,role"`
+	Scopes   []string   `json:"scopes" validate:"min=1,dive,permission"`
+	Items    []testItem `json:"items" validate:"max=100,dive"`
+	UserId   *string    `json:"userId" validate:"omitempty,uuid"`
+	internal string
+}
+
+type testResponse struct {
+	testEmbedded
+	Id        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Secret    string    `json:"-"`
+	Password  string    `json:"password,omitempty" validate:"min=8"`
+}
+
+type testEmbedded struct {
+	Message string `json:"message"`
+}
+
+func newTestSpec() *Spec {
+	return New(Info{Title: "Test", Version: "1"}, testError{}, map[string][]string{
+		"role":       {"user", "admin"},
+		"permission": {"menu:read", "menu:edit"},
+	})
+}
+
+func TestDescribe(t *testing.T) {
+	spec := newTestSpec()
+	router := mux.NewRouter()
+
+	spec.Describe(router.HandleFunc("/coffee/{coffeeId:[0-9]+}", nil).Methods("PATCH", "DELETE"), Route{
+		Summary:    "Change a coffee",
+		Permission: "menu:edit",
+		Query:      []*Parameter{Query("force", "boolean", "")},
+		Request:    testRequest{},
+		Status:     201,
+		Response:   testResponse{},
+	})
+
+	document := spec.Document()
+	assert.Equal(t, []string{"DELETE /coffee/{coffeeId}", "PATCH /coffee/{coffeeId}"}, document.Operations())
+
+	op := document.Paths["/coffee/{coffeeId}"]["patch"]
+	require.NotNil(t, op)
+	assert.Equal(t, "patchCoffeeByCoffeeId", op.OperationId)
+	assert.Equal(t, []string{"coffee"}, op.Tags)
+	assert.Equal(t, "menu:edit", op.Permission)
+	assert.Contains(t, op.Description, "`menu:edit`")
+	assert.Len(t, op.Security, 2)
+
+	require.Len(t, op.Parameters, 2)
+	assert.Equal(t, "path", op.Parameters[0].In)
+	assert.Equal(t, "integer", op.Parameters[0].Schema.Type)
+	assert.Equal(t, "query", op.Parameters[1].In)
+
+	assert.Equal(t, "#/components/schemas/testRequest", op.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/testResponse", op.Responses["201"].Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/testError", op.Responses["default"].Content["application/json"].Schema.Ref)
+
+	for _, ref := range document.References() {
+		assert.Contains(t, document.Components.Schemas, ref[len("#/components/schemas/"):])
+	}
+}
+
+func TestSchemaValidation(t *testing.T) {
+	spec := newTestSpec()
+	spec.schemas.schemaOf(testRequest{})
+	request := spec.Document().Components.Schemas["testRequest"]
+	require.NotNil(t, request)
+
+	assert.Equal(t, []string{"name", "scopes"}, request.Required)
+	assert.NotContains(t, request.Properties, "internal")
+
+	assert.Equal(t, 10, *request.Properties["name"].MaxLength)
+	assert.Equal(t, 0.0, *request.Properties["price"].Minimum)
+	assert.True(t, request.Properties["price"].ExclusiveMinimum)
+	assert.True(t, request.Properties["price"].Nullable)
+	assert.Equal(t, []string{"user", "admin"}, request.Properties["role"].Enum)
+	assert.Equal(t, 1, *request.Properties["scopes"].MinItems)
+	assert.Equal(t, []string{"menu:read", "menu:edit"}, request.Properties["scopes"].Items.Enum)
+	assert.Equal(t, 100, *request.Properties["items"].MaxItems)
+	assert.Equal(t, "uuid", request.Properties["userId"].Format)
+
+	item := spec.Document().Components.Schemas["testItem"]
+	require.NotNil(t, item)
+	assert.Equal(t, []string{"coffeeId"}, item.Required)
+	assert.Equal(t, 255, *item.Properties["options"].MaxLength)
+}
+
+func TestSchemaTypes(t *testing.T) {
+	spec := newTestSpec()
+	spec.schemas.schemaOf(testResponse{})
+	response := spec.Document().Components.Schemas["testResponse"]
+	require.NotNil(t, response)
+
+	// embedded structs are flattened and password is left out when empty
+	assert.Contains(t, response.Properties, "message")
+	assert.NotContains(t, response.Properties, "Secret")
+	assert.Empty(t, response.Required)
+	assert.Equal(t, &Schema{Type: "string", Format: "uuid"}, response.Properties["id"])
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, response.Properties["createdAt"])
+}
+
+func TestOverride(t *testing.T) {
+	spec := newTestSpec()
+	schema := spec.schemas.schemaOf(Override{
+		Value:      testEmbedded{},
+		Properties: map[string]interface{}{"items": []testItem{}},
+	})
+
+	require.Len(t, schema.AllOf, 2)
+	assert.Equal(t, "#/components/schemas/testEmbedded", schema.AllOf[0].Ref)
+	assert.Equal(t, "#/components/schemas/testItem", schema.AllOf[1].Properties["items"].Items.Ref)
+}
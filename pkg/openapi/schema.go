@@ -0,0 +1,345 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     bool               `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// Override documents Value with some of its properties replaced, e.g. the
+// items of a generic list envelope
+type Override struct {
+	Value      interface{}
+	Properties map[string]interface{}
+}
+
+// OneOf documents bodies that can have any of the given types
+type OneOf []interface{}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaBuilder turns Go types into schemas, named structs become components
+// so they're only described once
+type schemaBuilder struct {
+	enums   map[string][]string
+	names   map[reflect.Type]string
+	schemas map[string]*Schema
+}
+
+func newSchemaBuilder(enums map[string][]string) *schemaBuilder {
+	return &schemaBuilder{
+		enums:   enums,
+		names:   map[reflect.Type]string{},
+		schemas: map[string]*Schema{},
+	}
+}
+
+func (b *schemaBuilder) components() map[string]*Schema {
+	components := make(map[string]*Schema, len(b.schemas))
+	for name, schema := range b.schemas {
+		components[name] = schema
+	}
+	return components
+}
+
+func (b *schemaBuilder) schemaOf(v interface{}) *Schema {
+	switch v := v.(type) {
+	case Override:
+		properties := map[string]*Schema{}
+		for name, property := range v.Properties {
+			properties[name] = b.schemaOf(property)
+		}
+		return &Schema{AllOf: []*Schema{
+			b.schemaOf(v.Value),
+			{Type: "object", Properties: properties},
+		}}
+	case OneOf:
+		schema := &Schema{}
+		for _, option := range v {
+			schema.OneOf = append(schema.OneOf, b.schemaOf(option))
+		}
+		return schema
+	}
+	return b.typeSchema(reflect.TypeOf(v))
+}
+
+func (b *schemaBuilder) typeSchema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		schema := b.typeSchema(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		// custom JSON, e.g. postgres.Jsonb, can be anything
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		schema := &Schema{Type: "string"}
+		if t.String() == "uuid.UUID" {
+			schema.Format = "uuid"
+		}
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: float64Ptr(0)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.typeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + b.component(t)}
+	}
+
+	// interfaces can hold anything
+	return &Schema{}
+}
+
+func (b *schemaBuilder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := b.schemas[name]; taken {
+		// same name in another package, e.g. internal.PurchaseResponse
+		pkg := path.Base(t.PkgPath())
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+
+	// registered before the properties are built for recursive types
+	b.names[t] = name
+	b.schemas[name] = &Schema{}
+	*b.schemas[name] = *b.structSchema(t)
+	return name
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{},
+	}
+	b.addFields(schema, t)
+	return schema
+}
+
+// addFields adds the JSON fields of t, embedded structs without a json name
+// are flattened like encoding/json does
+func (b *schemaBuilder) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.SplitN(tag, ",", 2)[0]
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			b.addFields(schema, fieldType)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		// fields left out of the JSON when empty can't be required
+		omitted := strings.Contains(tag, ",omitempty")
+
+		property := b.typeSchema(field.Type)
+		if b.applyValidation(property, field) && !omitted {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// applyValidation documents the validate tag of field, see models.Validate.
+// It reports whether the field is required, i.e. its zero value is invalid.
+func (b *schemaBuilder) applyValidation(schema *Schema, field reflect.StructField) bool {
+	tag := field.Tag.Get("validate")
+	if tag == "" {
+		return false
+	}
+
+	target := schema
+	kind := field.Type.Kind()
+	if kind == reflect.Ptr {
+		kind = field.Type.Elem().Kind()
+	}
+
+	omitEmpty := false
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		parts := strings.SplitN(rule, "=", 2)
+		param := ""
+		if len(parts) == 2 {
+			param = parts[1]
+		}
+
+		switch parts[0] {
+		case "omitempty":
+			omitEmpty = true
+		case "required", "notblank":
+			required = true
+		case "dive":
+			// the remaining rules apply to the elements and don't change
+			// whether the field itself is required
+			elementTag := strings.SplitN(tag, "dive", 2)[1]
+			if target.Items != nil && elementTag != "" {
+				b.applyElementValidation(target.Items, field.Type.Elem(), strings.TrimPrefix(elementTag, ","))
+			}
+			return required && !omitEmpty
+		case "email", "uuid":
+			target.Format = parts[0]
+		case "oneof":
+			target.Enum = strings.Fields(param)
+			required = true
+		case "len":
+			b.applyBounds(target, kind, "min", param)
+			b.applyBounds(target, kind, "max", param)
+			required = required || param != "0"
+		case "min", "gte":
+			b.applyBounds(target, kind, "min", param)
+			required = required || isPositive(param)
+		case "max", "lte":
+			b.applyBounds(target, kind, "max", param)
+		case "gt", "lt":
+			if value, err := strconv.ParseFloat(param, 64); err == nil {
+				if parts[0] == "gt" {
+					target.Minimum = &value
+					target.ExclusiveMinimum = true
+					required = required || value >= 0
+				} else {
+					target.Maximum = &value
+					target.ExclusiveMaximum = true
+				}
+			}
+		default:
+			if values, ok := b.enums[parts[0]]; ok {
+				target.Enum = values
+				required = true
+			}
+		}
+	}
+	return required && !omitEmpty
+}
+
+func (b *schemaBuilder) applyElementValidation(schema *Schema, elem reflect.Type, tag string) {
+	b.applyValidation(schema, reflect.StructField{
+		Type: elem,
+		Tag:  reflect.StructTag(`validate:"` + tag + `"`),
+	})
+}
+
+// applyBounds sets min or max lengths, item counts or values depending on kind
+func (b *schemaBuilder) applyBounds(schema *Schema, kind reflect.Kind, bound, param string) {
+	if schema.Ref != "" {
+		return
+	}
+
+	switch kind {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		value, err := strconv.Atoi(param)
+		if err != nil {
+			return
+		}
+		switch {
+		case kind == reflect.String && bound == "min":
+			schema.MinLength = &value
+		case kind == reflect.String:
+			schema.MaxLength = &value
+		case bound == "min":
+			schema.MinItems = &value
+		default:
+			schema.MaxItems = &value
+		}
+	default:
+		value, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return
+		}
+		if bound == "min" {
+			schema.Minimum = &value
+		} else {
+			schema.Maximum = &value
+		}
+	}
+}
+
+func isPositive(param string) bool {
+	value, err := strconv.ParseFloat(param, 64)
+	return err == nil && value > 0
+}
+
+func float64Ptr(value float64) *float64 {
+	return &value
+}
+
+func itoa(value int) string {
+	return strconv.Itoa(value)
+}
@@ -0,0 +1,55 @@
+package persistence
+
+import (
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/jinzhu/gorm"
+)
+
+func CreateAPIKey(tx *gorm.DB, key *models.APIKey) error {
+	return tx.Create(key).Error
+}
+
+func GetAPIKeyByPrefix(tx *gorm.DB, prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := tx.
+		Where("prefix = ?", prefix).
+		First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func GetAPIKeyByID(tx *gorm.DB, keyId string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := tx.
+		Where("id = ?", keyId).
+		First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func GetAPIKeys(tx *gorm.DB) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	if err := tx.
+		Order("created_at ASC").
+		Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func UpdateAPIKey(tx *gorm.DB, key *models.APIKey) error {
+	return tx.Save(key).Error
+}
+
+// TouchAPIKey records when a key was last used without changing updated_at
+func TouchAPIKey(tx *gorm.DB, keyId uint, usedAt time.Time) error {
+	return tx.
+		Model(&models.APIKey{}).
+		Where("id = ?", keyId).
+		UpdateColumn("last_used_at", usedAt).
+		Error
+}
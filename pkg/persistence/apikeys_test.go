@@ -0,0 +1,72 @@
+package persistence
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAndGetAPIKey(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	testKey := models.APIKey{
+		Name:      "Kiosk",
+		Prefix:    "testprefix",
+		Hash:      "0000000000000000000000000000000000000000000000000000000000000000",
+		CreatedBy: testUserId,
+	}
+	testKey.SetPermissions([]models.Permission{models.PermissionOrdersCreate, models.PermissionOrdersRead})
+
+	err := CreateAPIKey(tx, &testKey)
+	require.NoError(t, err)
+
+	retrievedKey, err := GetAPIKeyByPrefix(tx, testKey.Prefix)
+	require.NoError(t, err)
+	assert.Equal(t, testKey.ID, retrievedKey.ID)
+	assert.Equal(t, testKey.Permissions(), retrievedKey.Permissions())
+
+	retrievedKey, err = GetAPIKeyByID(tx, strconv.FormatUint(uint64(testKey.ID), 10))
+	require.NoError(t, err)
+	assert.Equal(t, testKey.Prefix, retrievedKey.Prefix)
+
+	keys, err := GetAPIKeys(tx)
+	require.NoError(t, err)
+	assert.NotEmpty(t, keys)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
+
+func TestTouchAPIKey(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	testKey := models.APIKey{
+		Name:      "Kiosk",
+		Prefix:    "testprefix",
+		Hash:      "0000000000000000000000000000000000000000000000000000000000000000",
+		CreatedBy: testUserId,
+	}
+
+	err := CreateAPIKey(tx, &testKey)
+	require.NoError(t, err)
+
+	usedAt := time.Now().Truncate(time.Second)
+	err = TouchAPIKey(tx, testKey.ID, usedAt)
+	require.NoError(t, err)
+
+	retrievedKey, err := GetAPIKeyByPrefix(tx, testKey.Prefix)
+	require.NoError(t, err)
+	require.NotNil(t, retrievedKey.LastUsedAt)
+	assert.True(t, usedAt.Equal(*retrievedKey.LastUsedAt))
+	assert.Equal(t, testKey.UpdatedAt.Unix(), retrievedKey.UpdatedAt.Unix())
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
@@ -0,0 +1,70 @@
+package persistence
+
+import (
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/jinzhu/gorm"
+)
+
+func CreateAuditEvent(tx *gorm.DB, event *models.AuditEvent) error {
+	return tx.Create(event).Error
+}
+
+func filterAuditEvents(q *gorm.DB, filter *listing.AuditFilter) *gorm.DB {
+	if filter == nil {
+		return q
+	}
+
+	if filter.ActorId != nil {
+		q = q.Where("actor_id = ?", *filter.ActorId)
+	}
+	if filter.Action != nil {
+		q = q.Where("action = ?", *filter.Action)
+	}
+	if filter.EntityType != nil {
+		q = q.Where("entity_type = ?", *filter.EntityType)
+	}
+	if filter.EntityId != nil {
+		q = q.Where("entity_id = ?", *filter.EntityId)
+	}
+	if filter.From != nil {
+		q = q.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		q = q.Where("created_at < ?", *filter.To)
+	}
+
+	return q
+}
+
+// GetAuditEventsPaginated lists the newest events first
+func GetAuditEventsPaginated(tx *gorm.DB, pageSize int, page int, cursor *listing.Cursor, filter *listing.AuditFilter) ([]*models.AuditEvent, error) {
+	var events []*models.AuditEvent
+	q := filterAuditEvents(tx, filter).
+		Limit(pageSize).
+		Order("created_at DESC").
+		Order("id DESC")
+
+	if cursor != nil {
+		q = q.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	} else {
+		q = q.Offset(page * pageSize)
+	}
+
+	if err := q.Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func CountAuditEvents(tx *gorm.DB, filter *listing.AuditFilter) (int, error) {
+	var count int
+	q := filterAuditEvents(tx.Model(&models.AuditEvent{}), filter)
+
+	if err := q.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
@@ -0,0 +1,62 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/test"
+	"github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAndFilterAuditEvents(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	actorId := testUserId
+	events := []*models.AuditEvent{
+		{
+			ActorId:    &actorId,
+			Action:     models.AuditUserRole,
+			EntityType: models.AuditEntityUser,
+			EntityId:   "test-user",
+			Changes:    postgres.Jsonb{RawMessage: []byte(`{"role":{"before":"user","after":"admin"}}`)},
+			RequestId:  "test-request",
+			IP:         "10.0.0.1",
+		},
+		{
+			Action:     models.AuditLoginLockout,
+			EntityType: models.AuditEntityAccount,
+			EntityId:   "test@test.com",
+			Changes:    postgres.Jsonb{RawMessage: []byte(`{}`)},
+		},
+	}
+	for _, event := range events {
+		require.NoError(t, CreateAuditEvent(tx, event))
+	}
+
+	actorFilter := testUserId.String()
+	filter := &listing.AuditFilter{ActorId: &actorFilter}
+	retrievedEvents, err := GetAuditEventsPaginated(tx, 10, 0, nil, filter)
+	require.NoError(t, err)
+	require.NotEmpty(t, retrievedEvents)
+	assert.Equal(t, events[0].ID, retrievedEvents[0].ID)
+	assert.Equal(t, "test-request", retrievedEvents[0].RequestId)
+
+	entityType := models.AuditEntityAccount
+	entityId := "test@test.com"
+	count, err := CountAuditEvents(tx, &listing.AuditFilter{EntityType: &entityType, EntityId: &entityId})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	future := time.Now().Add(time.Hour)
+	count, err = CountAuditEvents(tx, &listing.AuditFilter{From: &future, EntityId: &entityId})
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
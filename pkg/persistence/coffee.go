@@ -3,6 +3,7 @@ package persistence
 import (
 	"strconv"
 
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/jinzhu/gorm"
 )
@@ -25,13 +26,19 @@ func GetCoffeesByID(tx *gorm.DB, coffeeIds []string) (map[string]*models.Coffee,
 	return coffeesMap, nil
 }
 
-func GetCoffeesPaginated(tx *gorm.DB, pageSize int, page int, inStock *bool) ([]*models.Coffee, error) {
+func GetCoffeesPaginated(tx *gorm.DB, pageSize int, page int, cursor *listing.Cursor, inStock *bool) ([]*models.Coffee, error) {
 	var coffees []*models.Coffee
 	q := tx.Model(models.Coffee{}).
-		Select([]string{"ID", "name", "description", "price", "in_stock"}).
-		Offset(page * pageSize).
+		Select([]string{"ID", "created_at", "name", "description", "price", "in_stock", "stock"}).
 		Limit(pageSize).
-		Order("updated_at ASC")
+		Order("created_at ASC").
+		Order("id ASC")
+
+	if cursor != nil {
+		q = q.Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+	} else {
+		q = q.Offset(page * pageSize)
+	}
 
 	if inStock != nil {
 		q = q.Where("in_stock = ?", *inStock)
@@ -43,10 +50,51 @@ func GetCoffeesPaginated(tx *gorm.DB, pageSize int, page int, inStock *bool) ([]
 	return coffees, nil
 }
 
+func CountCoffees(tx *gorm.DB, inStock *bool) (int, error) {
+	var count int
+	q := tx.Model(&models.Coffee{})
+
+	if inStock != nil {
+		q = q.Where("in_stock = ?", *inStock)
+	}
+	if err := q.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
 func UpdateCoffee(tx *gorm.DB, coffee *models.Coffee) error {
 	return tx.Save(coffee).Error
 }
 
+// AdjustCoffeeStock adds delta to the stock of a coffee if its stock is
+// tracked, keeping the in stock flag in sync with the remaining units. The
+// stock never goes below zero, it returns whether the stock was changed.
+func AdjustCoffeeStock(tx *gorm.DB, coffeeId uint, delta int) (bool, error) {
+	q := tx.Model(&models.Coffee{}).
+		Where("id = ? AND stock IS NOT NULL AND stock + ? >= 0", coffeeId, delta).
+		Updates(map[string]interface{}{
+			"stock":    gorm.Expr("stock + ?", delta),
+			"in_stock": gorm.Expr("stock + ? > 0", delta),
+		})
+	if q.Error != nil {
+		return false, q.Error
+	}
+	return q.RowsAffected > 0, nil
+}
+
+// IsStockTracked returns whether the stock of a coffee is counted
+func IsStockTracked(tx *gorm.DB, coffeeId uint) (bool, error) {
+	var count int
+	if err := tx.Model(&models.Coffee{}).
+		Where("id = ? AND stock IS NOT NULL", coffeeId).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func DeleteCoffee(tx *gorm.DB, coffeeId string) error {
 	return tx.
 		Where("id = ?", coffeeId).
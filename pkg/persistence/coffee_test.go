@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/test"
 	"github.com/jinzhu/gorm"
@@ -11,6 +12,14 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func coffeeIds(coffees []*models.Coffee) []uint {
+	ids := make([]uint, 0, len(coffees))
+	for _, coffee := range coffees {
+		ids = append(ids, coffee.ID)
+	}
+	return ids
+}
+
 func TestCreateCoffee(t *testing.T) {
 	db := test.SetupTestDb(t)
 	tx := db.Begin()
@@ -85,16 +94,62 @@ func TestGetCoffeesPaginated(t *testing.T) {
 	err = CreateCoffee(tx, &testCoffee2)
 	require.NoError(t, err)
 
-	page, err := GetCoffeesPaginated(tx, 1, 0, nil)
+	page, err := GetCoffeesPaginated(tx, 1, 0, nil, nil)
 	require.NoError(t, err)
 	assert.Len(t, page, 1)
 
 	inStock := true
-	page, err = GetCoffeesPaginated(tx, 1, 0, &inStock)
+	page, err = GetCoffeesPaginated(tx, 1, 0, nil, &inStock)
 	require.NoError(t, err)
 	require.Len(t, page, 1)
 	assert.True(t, page[0].InStock)
 
+	// continuing from the last coffee should return the next one
+	var lastCoffee models.Coffee
+	err = tx.Where("id = ?", testCoffee.ID).First(&lastCoffee).Error
+	require.NoError(t, err)
+
+	cursor := listing.Cursor{
+		CreatedAt: lastCoffee.CreatedAt,
+		ID:        strconv.FormatUint(uint64(lastCoffee.ID), 10),
+	}
+	page, err = GetCoffeesPaginated(tx, 10, 0, &cursor, nil)
+	require.NoError(t, err)
+	for _, coffee := range page {
+		assert.NotEqual(t, testCoffee.ID, coffee.ID)
+	}
+	assert.Contains(t, coffeeIds(page), testCoffee2.ID)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
+
+func TestCountCoffees(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	count, err := CountCoffees(tx, nil)
+	require.NoError(t, err)
+
+	testCoffee := models.Coffee{
+		Name:  "Test Coffee",
+		Price: 1.2,
+	}
+	testCoffee.ID = 735799
+
+	err = CreateCoffee(tx, &testCoffee)
+	require.NoError(t, err)
+
+	newCount, err := CountCoffees(tx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, count+1, newCount)
+
+	inStock := true
+	inStockCount, err := CountCoffees(tx, &inStock)
+	require.NoError(t, err)
+	assert.True(t, inStockCount <= newCount)
+	assert.True(t, inStockCount > 0)
+
 	// rollback create because we don't want it to be in our db
 	tx.Rollback()
 }
@@ -130,6 +185,77 @@ func TestUpdateCoffee(t *testing.T) {
 	tx.Rollback()
 }
 
+func TestAdjustCoffeeStock(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	stock := 1
+	testCoffee := models.Coffee{
+		Name:  "Test Coffee",
+		Price: 1.2,
+		Stock: &stock,
+	}
+	testCoffee.ID = 735799
+
+	err := CreateCoffee(tx, &testCoffee)
+	require.NoError(t, err)
+
+	untrackedCoffee := models.Coffee{
+		Name:  "Test Coffee 2",
+		Price: 1.3,
+	}
+	untrackedCoffee.ID = 735800
+
+	err = CreateCoffee(tx, &untrackedCoffee)
+	require.NoError(t, err)
+
+	adjusted, err := AdjustCoffeeStock(tx, testCoffee.ID, -1)
+	require.NoError(t, err)
+	assert.True(t, adjusted)
+
+	var retrievedCoffee models.Coffee
+	err = tx.Where("id = ?", testCoffee.ID).First(&retrievedCoffee).Error
+	require.NoError(t, err)
+	require.NotNil(t, retrievedCoffee.Stock)
+	assert.Equal(t, 0, *retrievedCoffee.Stock)
+	assert.False(t, retrievedCoffee.InStock)
+
+	// the stock can't go below zero
+	adjusted, err = AdjustCoffeeStock(tx, testCoffee.ID, -1)
+	require.NoError(t, err)
+	assert.False(t, adjusted)
+
+	adjusted, err = AdjustCoffeeStock(tx, testCoffee.ID, 2)
+	require.NoError(t, err)
+	assert.True(t, adjusted)
+
+	err = tx.Where("id = ?", testCoffee.ID).First(&retrievedCoffee).Error
+	require.NoError(t, err)
+	require.NotNil(t, retrievedCoffee.Stock)
+	assert.Equal(t, 2, *retrievedCoffee.Stock)
+	assert.True(t, retrievedCoffee.InStock)
+
+	// coffees without tracked stock are left alone
+	adjusted, err = AdjustCoffeeStock(tx, untrackedCoffee.ID, -1)
+	require.NoError(t, err)
+	assert.False(t, adjusted)
+
+	tracked, err := IsStockTracked(tx, untrackedCoffee.ID)
+	require.NoError(t, err)
+	assert.False(t, tracked)
+	tracked, err = IsStockTracked(tx, testCoffee.ID)
+	require.NoError(t, err)
+	assert.True(t, tracked)
+
+	err = tx.Where("id = ?", untrackedCoffee.ID).First(&retrievedCoffee).Error
+	require.NoError(t, err)
+	assert.Nil(t, retrievedCoffee.Stock)
+	assert.True(t, retrievedCoffee.InStock)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
+
 func TestDeleteCoffee(t *testing.T) {
 	db := test.SetupTestDb(t)
 	tx := db.Begin()
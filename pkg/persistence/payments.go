@@ -0,0 +1,21 @@
+package persistence
+
+import (
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/jinzhu/gorm"
+)
+
+func CreatePayment(tx *gorm.DB, payment *models.Payment) error {
+	return tx.Create(payment).Error
+}
+
+func GetPaymentsByTransactionID(tx *gorm.DB, transactionId string) ([]*models.Payment, error) {
+	var payments []*models.Payment
+	if err := tx.
+		Where("transaction_id = ?", transactionId).
+		Order("created_at ASC").
+		Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
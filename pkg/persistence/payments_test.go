@@ -0,0 +1,104 @@
+package persistence
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePayment(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	testUser := models.User{
+		ID:        testUserId,
+		FirstName: "Test",
+		LastName:  "test",
+		Email:     "test@testtest.test",
+	}
+
+	err := CreateUser(tx, &testUser)
+	require.NoError(t, err)
+
+	testTransaction := models.Transaction{
+		UserId: testUserId,
+		Total:  1.2,
+	}
+	testTransaction.ID = 735799
+
+	err = CreateTransaction(tx, &testTransaction)
+	require.NoError(t, err)
+
+	testPayment := models.Payment{
+		TransactionId: testTransaction.ID,
+		Amount:        1.2,
+		Kind:          models.PaymentKindPayment,
+		RecordedBy:    testUserId,
+	}
+
+	err = CreatePayment(tx, &testPayment)
+	require.NoError(t, err)
+
+	var retrievedPayment models.Payment
+	err = tx.Where("id = ?", testPayment.ID).First(&retrievedPayment).Error
+	require.NoError(t, err)
+
+	assert.Equal(t, testPayment.Amount, retrievedPayment.Amount)
+	assert.Equal(t, models.PaymentKindPayment, retrievedPayment.Kind)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
+
+func TestGetPaymentsByTransactionId(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	testUser := models.User{
+		ID:        testUserId,
+		FirstName: "Test",
+		LastName:  "test",
+		Email:     "test@testtest.test",
+	}
+
+	err := CreateUser(tx, &testUser)
+	require.NoError(t, err)
+
+	testTransaction := models.Transaction{
+		UserId: testUserId,
+		Total:  1.2,
+	}
+	testTransaction.ID = 735799
+
+	err = CreateTransaction(tx, &testTransaction)
+	require.NoError(t, err)
+
+	err = CreatePayment(tx, &models.Payment{
+		TransactionId: testTransaction.ID,
+		Amount:        1.2,
+		Kind:          models.PaymentKindPayment,
+		RecordedBy:    testUserId,
+	})
+	require.NoError(t, err)
+
+	err = CreatePayment(tx, &models.Payment{
+		TransactionId: testTransaction.ID,
+		Amount:        1.2,
+		Kind:          models.PaymentKindRefund,
+		RecordedBy:    testUserId,
+	})
+	require.NoError(t, err)
+
+	payments, err := GetPaymentsByTransactionID(tx, strconv.FormatUint(uint64(testTransaction.ID), 10))
+	require.NoError(t, err)
+	require.Len(t, payments, 2)
+	assert.Equal(t, models.PaymentKindPayment, payments[0].Kind)
+	assert.Equal(t, models.PaymentKindRefund, payments[1].Kind)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
@@ -3,7 +3,9 @@ package persistence
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/jinzhu/gorm"
 )
@@ -26,21 +28,115 @@ func GetTransactionsByID(tx *gorm.DB, purchaseIds []string) (map[string]*models.
 	return purchaseMap, nil
 }
 
-func GetTransactionsPaginated(tx *gorm.DB, pageSize int, page int, userId *string, sortKey *string, sortDirection *string) ([]*models.Transaction, error) {
+// GetTransactionForUpdate returns a transaction and locks its row until tx
+// ends, so concurrent changes to it are made one after another
+func GetTransactionForUpdate(tx *gorm.DB, transactionId string) (*models.Transaction, error) {
+	var purchase models.Transaction
+	if err := tx.
+		Set("gorm:query_option", "FOR UPDATE").
+		Where("id = ?", transactionId).
+		First(&purchase).Error; err != nil {
+		return nil, err
+	}
+	return &purchase, nil
+}
+
+// transactionSortColumns whitelists what transactions can be ordered by,
+// user input is never interpolated into the query
+var transactionSortColumns = map[string]string{
+	listing.PurchaseSortCreatedAt:  "created_at",
+	listing.PurchaseSortTotal:      "total",
+	listing.PurchaseSortAmountPaid: "amount_paid",
+	listing.PurchaseSortBalance:    "(total - amount_paid)",
+}
+
+var sortDirections = map[string]string{
+	"asc":  "ASC",
+	"desc": "DESC",
+}
+
+func filterTransactions(q *gorm.DB, filter *listing.PurchaseFilter) (*gorm.DB, error) {
+	if filter == nil {
+		return q, nil
+	}
+
+	if filter.UserId != nil {
+		q = q.Where("user_id = ?", *filter.UserId)
+	}
+	if filter.From != nil {
+		q = q.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		q = q.Where("created_at < ?", *filter.To)
+	}
+	if filter.Status != nil {
+		q = q.Where("status = ?", *filter.Status)
+	}
+	if filter.MinTotal != nil {
+		q = q.Where("total >= ?", *filter.MinTotal)
+	}
+	if filter.CoffeeId != nil {
+		q = q.Where(
+			"EXISTS (SELECT 1 FROM purchase_items WHERE purchase_items.transaction_id = transactions.id AND purchase_items.coffee_id = ? AND purchase_items.deleted_at IS NULL)",
+			*filter.CoffeeId,
+		)
+	}
+	// cancelled transactions have been refunded, nothing is owed on them
+	if filter.PaymentStatus != nil {
+		q = q.Where("status <> ?", models.TransactionStatusCancelled)
+		switch *filter.PaymentStatus {
+		case listing.PaymentStatusPaid:
+			q = q.Where("amount_paid >= total")
+		case listing.PaymentStatusUnpaid:
+			q = q.Where("amount_paid = 0 AND total > 0")
+		case listing.PaymentStatusPartial:
+			q = q.Where("amount_paid > 0 AND amount_paid < total")
+		default:
+			return nil, listing.ErrInvalidPaymentStatus
+		}
+	}
+
+	return q, nil
+}
+
+func GetTransactionsPaginated(tx *gorm.DB, pageSize int, page int, cursor *listing.Cursor, filter *listing.PurchaseFilter, sortKey *string, sortDirection *string) ([]*models.Transaction, error) {
 	var purchases []*models.Transaction
-	q := tx.
-		Offset(page * pageSize).
+	q, err := filterTransactions(tx.Model(&models.Transaction{}), filter)
+	if err != nil {
+		return nil, err
+	}
+	q = q.
 		Limit(pageSize).
 		Preload("Items")
 
-	if userId != nil {
-		q = q.Where("user_id = ?", *userId)
+	column := transactionSortColumns[listing.PurchaseSortCreatedAt]
+	direction := "DESC"
+	if sortKey != nil {
+		var ok bool
+		if column, ok = transactionSortColumns[*sortKey]; !ok {
+			return nil, listing.ErrInvalidSort
+		}
+	}
+	if sortDirection != nil {
+		var ok bool
+		if direction, ok = sortDirections[strings.ToLower(*sortDirection)]; !ok {
+			return nil, listing.ErrInvalidSort
+		}
 	}
+	// ids break ties so pages stay stable
+	q = q.Order(fmt.Sprintf("%s %s, id %s", column, direction, direction))
 
-	if sortKey != nil && sortDirection != nil {
-		q = q.Order(fmt.Sprintf("%s %s", *sortKey, *sortDirection))
+	if cursor != nil {
+		if sortKey != nil && *sortKey != listing.PurchaseSortCreatedAt {
+			return nil, listing.ErrCursorSort
+		}
+		comparison := "<"
+		if direction == "ASC" {
+			comparison = ">"
+		}
+		q = q.Where(fmt.Sprintf("(created_at, id) %s (?, ?)", comparison), cursor.CreatedAt, cursor.ID)
 	} else {
-		q = q.Order("created_at DESC")
+		q = q.Offset(page * pageSize)
 	}
 
 	if err := q.Find(&purchases).Error; err != nil {
@@ -50,6 +146,66 @@ func GetTransactionsPaginated(tx *gorm.DB, pageSize int, page int, userId *strin
 	return purchases, nil
 }
 
+func CountTransactions(tx *gorm.DB, filter *listing.PurchaseFilter) (int, error) {
+	var count int
+	q, err := filterTransactions(tx.Model(&models.Transaction{}), filter)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := q.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CountOutstandingTransactions counts the transactions of a user that still
+// have a balance owing
+func CountOutstandingTransactions(tx *gorm.DB, userId string) (int, error) {
+	var count int
+	if err := tx.Model(&models.Transaction{}).
+		Where("user_id = ? AND status <> ? AND amount_paid < total", userId, models.TransactionStatusCancelled).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func GetPurchaseItemsByTransactionID(tx *gorm.DB, transactionId string) ([]*models.PurchaseItem, error) {
+	var items []*models.PurchaseItem
+	if err := tx.
+		Where("transaction_id = ?", transactionId).
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetPurchaseItemDetailsByTransactionID returns the items of a transaction with
+// their coffee names, including coffees that have since been deleted
+func GetPurchaseItemDetailsByTransactionID(tx *gorm.DB, transactionId string) ([]*models.PurchaseItemDetail, error) {
+	var items []*models.PurchaseItemDetail
+	if err := tx.
+		Table("purchase_items").
+		Select([]string{
+			"purchase_items.id",
+			"purchase_items.transaction_id",
+			"purchase_items.coffee_id",
+			"coffees.name AS coffee_name",
+			"purchase_items.price",
+			"purchase_items.type_option",
+		}).
+		Joins("LEFT JOIN coffees ON coffees.id = purchase_items.coffee_id").
+		Where("purchase_items.transaction_id = ? AND purchase_items.deleted_at IS NULL", transactionId).
+		Order("purchase_items.id ASC").
+		Scan(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 func UpdateTransaction(tx *gorm.DB, purchase *models.Transaction) error {
 	return tx.Save(purchase).Error
 }
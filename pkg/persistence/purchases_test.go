@@ -3,7 +3,9 @@ package persistence
 import (
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/test"
 	"github.com/google/uuid"
@@ -112,15 +114,327 @@ func TestGetTransactionsPaginated(t *testing.T) {
 	err = CreateTransaction(tx, &testTransaction)
 	require.NoError(t, err)
 
-	page, err := GetTransactionsPaginated(tx, 1, 0, nil, nil, nil)
+	page, err := GetTransactionsPaginated(tx, 1, 0, nil, nil, nil, nil)
 	require.NoError(t, err)
 	assert.Len(t, page, 1)
 
 	thisShouldntExist := uuid.New().String()
-	page, err = GetTransactionsPaginated(tx, 1, 0, &thisShouldntExist, nil, nil)
+	page, err = GetTransactionsPaginated(tx, 1, 0, nil, &listing.PurchaseFilter{UserId: &thisShouldntExist}, nil, nil)
 	require.NoError(t, err)
 	assert.Len(t, page, 0)
 
+	// newest first, so nothing comes after the only transaction of the user
+	var retrievedTransaction models.Transaction
+	err = tx.Where("id = ?", testTransaction.ID).First(&retrievedTransaction).Error
+	require.NoError(t, err)
+
+	cursor := listing.Cursor{
+		CreatedAt: retrievedTransaction.CreatedAt,
+		ID:        strconv.FormatUint(uint64(retrievedTransaction.ID), 10),
+	}
+	userId := testUserId.String()
+	userFilter := listing.PurchaseFilter{UserId: &userId}
+	page, err = GetTransactionsPaginated(tx, 1, 0, &cursor, &userFilter, nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, page, 0)
+
+	sortKey := listing.PurchaseSortTotal
+	sortDirection := "asc"
+	page, err = GetTransactionsPaginated(tx, 1, 0, nil, &userFilter, &sortKey, &sortDirection)
+	require.NoError(t, err)
+	assert.Len(t, page, 1)
+
+	_, err = GetTransactionsPaginated(tx, 1, 0, &cursor, nil, &sortKey, &sortDirection)
+	assert.Equal(t, listing.ErrCursorSort, err)
+
+	// sort keys and directions outside the whitelist are rejected
+	injected := "total; DROP TABLE transactions"
+	_, err = GetTransactionsPaginated(tx, 1, 0, nil, nil, &injected, nil)
+	assert.Equal(t, listing.ErrInvalidSort, err)
+	_, err = GetTransactionsPaginated(tx, 1, 0, nil, nil, &sortKey, &injected)
+	assert.Equal(t, listing.ErrInvalidSort, err)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
+
+func TestCountTransactions(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	testUser := models.User{
+		ID:        testUserId,
+		FirstName: "Test",
+		LastName:  "test",
+		Email:     "test@testtest.test",
+	}
+
+	err := CreateUser(tx, &testUser)
+	require.NoError(t, err)
+
+	testTransaction := models.Transaction{
+		UserId: testUserId,
+		Total:  1.2,
+	}
+	testTransaction.ID = 735799
+
+	err = CreateTransaction(tx, &testTransaction)
+	require.NoError(t, err)
+
+	userId := testUserId.String()
+	count, err := CountTransactions(tx, &listing.PurchaseFilter{UserId: &userId})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	thisShouldntExist := uuid.New().String()
+	count, err = CountTransactions(tx, &listing.PurchaseFilter{UserId: &thisShouldntExist})
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
+
+func TestCountOutstandingTransactions(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	testUser := models.User{
+		ID:        testUserId,
+		FirstName: "Test",
+		LastName:  "test",
+		Email:     "test@testtest.test",
+	}
+
+	err := CreateUser(tx, &testUser)
+	require.NoError(t, err)
+
+	paidTransaction := models.Transaction{
+		UserId:     testUserId,
+		AmountPaid: 1.2,
+		Total:      1.2,
+	}
+	paidTransaction.ID = 735799
+
+	err = CreateTransaction(tx, &paidTransaction)
+	require.NoError(t, err)
+
+	unpaidTransaction := models.Transaction{
+		UserId: testUserId,
+		Total:  1.2,
+	}
+	unpaidTransaction.ID = 735800
+
+	err = CreateTransaction(tx, &unpaidTransaction)
+	require.NoError(t, err)
+
+	cancelledTransaction := models.Transaction{
+		UserId: testUserId,
+		Total:  1.2,
+		Status: models.TransactionStatusCancelled,
+	}
+	cancelledTransaction.ID = 735801
+
+	err = CreateTransaction(tx, &cancelledTransaction)
+	require.NoError(t, err)
+
+	count, err := CountOutstandingTransactions(tx, testUserId.String())
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
+
+func TestFilterTransactions(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	testUser := models.User{
+		ID:        testUserId,
+		FirstName: "Test",
+		LastName:  "test",
+		Email:     "test@testtest.test",
+	}
+
+	err := CreateUser(tx, &testUser)
+	require.NoError(t, err)
+
+	testCoffee := models.Coffee{
+		Name:  "Test Coffee",
+		Price: 1.2,
+	}
+	testCoffee.ID = 735799
+
+	err = CreateCoffee(tx, &testCoffee)
+	require.NoError(t, err)
+
+	paidTransaction := models.Transaction{
+		UserId:     testUserId,
+		AmountPaid: 1.2,
+		Total:      1.2,
+		Items: []*models.PurchaseItem{
+			{CoffeeId: testCoffee.ID, Price: testCoffee.Price},
+		},
+	}
+	paidTransaction.ID = 735799
+
+	err = CreateTransaction(tx, &paidTransaction)
+	require.NoError(t, err)
+
+	partialTransaction := models.Transaction{
+		UserId:     testUserId,
+		AmountPaid: 1,
+		Total:      5,
+	}
+	partialTransaction.ID = 735800
+
+	err = CreateTransaction(tx, &partialTransaction)
+	require.NoError(t, err)
+
+	// refunded when it was cancelled, it isn't unpaid
+	cancelledTransaction := models.Transaction{
+		UserId: testUserId,
+		Total:  3,
+		Status: models.TransactionStatusCancelled,
+	}
+	cancelledTransaction.ID = 735801
+
+	err = CreateTransaction(tx, &cancelledTransaction)
+	require.NoError(t, err)
+
+	userId := testUserId.String()
+	count := func(filter listing.PurchaseFilter) int {
+		filter.UserId = &userId
+		count, err := CountTransactions(tx, &filter)
+		require.NoError(t, err)
+		return count
+	}
+
+	paid := listing.PaymentStatusPaid
+	partial := listing.PaymentStatusPartial
+	unpaid := listing.PaymentStatusUnpaid
+	assert.Equal(t, 1, count(listing.PurchaseFilter{PaymentStatus: &paid}))
+	assert.Equal(t, 1, count(listing.PurchaseFilter{PaymentStatus: &partial}))
+	assert.Equal(t, 0, count(listing.PurchaseFilter{PaymentStatus: &unpaid}))
+
+	minTotal := 2.0
+	assert.Equal(t, 2, count(listing.PurchaseFilter{MinTotal: &minTotal}))
+
+	assert.Equal(t, 1, count(listing.PurchaseFilter{CoffeeId: &testCoffee.ID}))
+
+	tomorrow := time.Now().Add(24 * time.Hour)
+	assert.Equal(t, 0, count(listing.PurchaseFilter{From: &tomorrow}))
+	assert.Equal(t, 3, count(listing.PurchaseFilter{To: &tomorrow}))
+
+	invalid := "sort of paid"
+	_, err = CountTransactions(tx, &listing.PurchaseFilter{PaymentStatus: &invalid})
+	assert.Equal(t, listing.ErrInvalidPaymentStatus, err)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
+
+func TestGetPurchaseItemsByTransactionId(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	testUser := models.User{
+		ID:        testUserId,
+		FirstName: "Test",
+		LastName:  "test",
+		Email:     "test@testtest.test",
+	}
+
+	err := CreateUser(tx, &testUser)
+	require.NoError(t, err)
+
+	testCoffee := models.Coffee{
+		Name:  "Test Coffee",
+		Price: 1.2,
+	}
+	testCoffee.ID = 735799
+
+	err = CreateCoffee(tx, &testCoffee)
+	require.NoError(t, err)
+
+	testTransaction := models.Transaction{
+		UserId: testUserId,
+		Total:  1.2,
+		Items: []*models.PurchaseItem{
+			{
+				CoffeeId:   testCoffee.ID,
+				Price:      testCoffee.Price,
+				TypeOption: "latte",
+			},
+		},
+	}
+	testTransaction.ID = 735799
+
+	err = CreateTransaction(tx, &testTransaction)
+	require.NoError(t, err)
+
+	items, err := GetPurchaseItemsByTransactionID(tx, strconv.FormatUint(uint64(testTransaction.ID), 10))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, testCoffee.ID, items[0].CoffeeId)
+	assert.Equal(t, "latte", items[0].TypeOption)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
+
+func TestGetPurchaseItemDetailsByTransactionId(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	testUser := models.User{
+		ID:        testUserId,
+		FirstName: "Test",
+		LastName:  "test",
+		Email:     "test@testtest.test",
+	}
+
+	err := CreateUser(tx, &testUser)
+	require.NoError(t, err)
+
+	testCoffee := models.Coffee{
+		Name:  "Test Coffee",
+		Price: 1.2,
+	}
+	testCoffee.ID = 735799
+
+	err = CreateCoffee(tx, &testCoffee)
+	require.NoError(t, err)
+
+	testTransaction := models.Transaction{
+		UserId: testUserId,
+		Total:  1.2,
+		Items: []*models.PurchaseItem{
+			{
+				CoffeeId:   testCoffee.ID,
+				Price:      testCoffee.Price,
+				TypeOption: "latte",
+			},
+		},
+	}
+	testTransaction.ID = 735799
+
+	err = CreateTransaction(tx, &testTransaction)
+	require.NoError(t, err)
+
+	// names of deleted coffees should still be returned
+	err = DeleteCoffee(tx, strconv.FormatUint(uint64(testCoffee.ID), 10))
+	require.NoError(t, err)
+
+	items, err := GetPurchaseItemDetailsByTransactionID(tx, strconv.FormatUint(uint64(testTransaction.ID), 10))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, testCoffee.ID, items[0].CoffeeId)
+	assert.Equal(t, testCoffee.Name, items[0].CoffeeName)
+	assert.Equal(t, testCoffee.Price, items[0].Price)
+	assert.Equal(t, "latte", items[0].TypeOption)
+
 	// rollback create because we don't want it to be in our db
 	tx.Rollback()
 }
@@ -0,0 +1,49 @@
+package persistence
+
+import (
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/jinzhu/gorm"
+)
+
+func CreateRecoveryCodes(tx *gorm.DB, codes []*models.RecoveryCode) error {
+	for _, code := range codes {
+		if err := tx.Create(code).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func DeleteRecoveryCodes(tx *gorm.DB, userId string) error {
+	return tx.
+		Unscoped().
+		Where("user_id = ?", userId).
+		Delete(models.RecoveryCode{}).
+		Error
+}
+
+// UseRecoveryCode marks an unused code as used, returning false if there was
+// no such code
+func UseRecoveryCode(tx *gorm.DB, userId string, hash string, usedAt time.Time) (bool, error) {
+	result := tx.
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", userId, hash).
+		UpdateColumn("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func CountUnusedRecoveryCodes(tx *gorm.DB, userId string) (int, error) {
+	var count int
+	if err := tx.
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userId).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,63 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseRecoveryCode(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	testUser := models.User{
+		ID:        testUserId,
+		FirstName: "Test",
+		LastName:  "test",
+		Email:     "test@testtest.test",
+	}
+
+	err := CreateUser(tx, &testUser)
+	require.NoError(t, err)
+
+	err = CreateRecoveryCodes(tx, []*models.RecoveryCode{
+		{UserId: testUserId, Hash: "a"},
+		{UserId: testUserId, Hash: "b"},
+	})
+	require.NoError(t, err)
+
+	count, err := CountUnusedRecoveryCodes(tx, testUserId.String())
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	used, err := UseRecoveryCode(tx, testUserId.String(), "a", time.Now())
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	// codes can only be used once
+	used, err = UseRecoveryCode(tx, testUserId.String(), "a", time.Now())
+	require.NoError(t, err)
+	assert.False(t, used)
+
+	used, err = UseRecoveryCode(tx, testUserId.String(), "c", time.Now())
+	require.NoError(t, err)
+	assert.False(t, used)
+
+	count, err = CountUnusedRecoveryCodes(tx, testUserId.String())
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	err = DeleteRecoveryCodes(tx, testUserId.String())
+	require.NoError(t, err)
+
+	count, err = CountUnusedRecoveryCodes(tx, testUserId.String())
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
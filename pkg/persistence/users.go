@@ -1,6 +1,9 @@
 package persistence
 
 import (
+	"strings"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/jinzhu/gorm"
 )
@@ -36,14 +39,35 @@ func GetUsersByID(tx *gorm.DB, userIds []string) (map[string]*models.User, error
 	return usersMap, nil
 }
 
-func GetUsersPaginated(tx *gorm.DB, pageSize int, page int, role *string) ([]*models.User, error) {
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func filterUsers(q *gorm.DB, filter *listing.UserFilter) *gorm.DB {
+	if filter == nil {
+		return q
+	}
+
+	if filter.Role != nil {
+		q = q.Where("role = ?", *filter.Role)
+	}
+	if filter.Search != nil {
+		prefix := likeEscaper.Replace(strings.ToLower(*filter.Search)) + "%"
+		q = q.Where("LOWER(first_name) LIKE ? OR LOWER(last_name) LIKE ? OR LOWER(email) LIKE ?", prefix, prefix, prefix)
+	}
+
+	return q
+}
+
+func GetUsersPaginated(tx *gorm.DB, pageSize int, page int, cursor *listing.Cursor, filter *listing.UserFilter) ([]*models.User, error) {
 	var users []*models.User
-	q := tx.
-		Offset(page * pageSize).
-		Limit(pageSize)
+	q := filterUsers(tx, filter).
+		Limit(pageSize).
+		Order("created_at ASC").
+		Order("id ASC")
 
-	if role != nil {
-		q = q.Where("role = ?", *role)
+	if cursor != nil {
+		q = q.Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+	} else {
+		q = q.Offset(page * pageSize)
 	}
 
 	if err := q.Find(&users).Error; err != nil {
@@ -56,6 +80,17 @@ func GetUsersPaginated(tx *gorm.DB, pageSize int, page int, role *string) ([]*mo
 	return users, nil
 }
 
+func CountUsers(tx *gorm.DB, filter *listing.UserFilter) (int, error) {
+	var count int
+	q := filterUsers(tx.Model(&models.User{}), filter)
+
+	if err := q.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
 func UpdateUser(tx *gorm.DB, user *models.User) error {
 	return tx.Save(user).Error
 }
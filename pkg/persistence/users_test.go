@@ -3,6 +3,7 @@ package persistence
 import (
 	"testing"
 
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/test"
 	"github.com/jinzhu/gorm"
@@ -106,10 +107,66 @@ func TestGetUsersPaginated(t *testing.T) {
 	err := CreateUser(tx, &testUser)
 	require.NoError(t, err)
 
-	page, err := GetUsersPaginated(tx, 1, 0, nil)
+	page, err := GetUsersPaginated(tx, 1, 0, nil, nil)
 	require.NoError(t, err)
 	assert.Len(t, page, 1)
 
+	var retrievedUser models.User
+	err = tx.Where("id = ?", testUser.ID).First(&retrievedUser).Error
+	require.NoError(t, err)
+
+	cursor := listing.Cursor{
+		CreatedAt: retrievedUser.CreatedAt,
+		ID:        retrievedUser.ID.String(),
+	}
+	page, err = GetUsersPaginated(tx, 100, 0, &cursor, nil)
+	require.NoError(t, err)
+	for _, user := range page {
+		assert.NotEqual(t, testUser.ID, user.ID)
+	}
+
+	search := "TEST@testtest"
+	page, err = GetUsersPaginated(tx, 100, 0, nil, &listing.UserFilter{Search: &search})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, testUser.ID, page[0].ID)
+
+	// wildcards in the search are matched literally
+	search = "%"
+	page, err = GetUsersPaginated(tx, 100, 0, nil, &listing.UserFilter{Search: &search})
+	require.NoError(t, err)
+	assert.Len(t, page, 0)
+
+	// rollback create because we don't want it to be in our db
+	tx.Rollback()
+}
+
+func TestCountUsers(t *testing.T) {
+	db := test.SetupTestDb(t)
+	tx := db.Begin()
+
+	count, err := CountUsers(tx, nil)
+	require.NoError(t, err)
+
+	testUser := models.User{
+		ID:        testUserId,
+		FirstName: "Test",
+		LastName:  "test",
+		Email:     "test@testtest.test",
+	}
+
+	err = CreateUser(tx, &testUser)
+	require.NoError(t, err)
+
+	newCount, err := CountUsers(tx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, count+1, newCount)
+
+	role := "thisroledoesntexist"
+	roleCount, err := CountUsers(tx, &listing.UserFilter{Role: &role})
+	require.NoError(t, err)
+	assert.Equal(t, 0, roleCount)
+
 	// rollback create because we don't want it to be in our db
 	tx.Rollback()
 }
@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// Limit is a token bucket, Burst requests can be made at once and tokens
+// refill at Rate per second. A zero Limit doesn't limit anything.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func PerSecond(n int) Limit {
+	return Limit{Rate: float64(n), Burst: n}
+}
+
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+func PerHour(n int) Limit {
+	return Limit{Rate: float64(n) / 3600, Burst: n}
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Burst <= 0 || l.Rate <= 0
+}
+
+var errInvalidLimit = errors.New(`invalid rate limit, expected "{n}/s", "{n}/m", "{n}/h" or "off"`)
+
+// ParseLimit reads limits formatted as "60/m", "10/s", "1000/h" or "off"
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(strings.ToLower(value))
+	if value == "off" {
+		return Limit{}, nil
+	}
+
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return Limit{}, errInvalidLimit
+	}
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n <= 0 {
+		return Limit{}, errInvalidLimit
+	}
+
+	switch parts[1] {
+	case "s":
+		return PerSecond(n), nil
+	case "m":
+		return PerMinute(n), nil
+	case "h":
+		return PerHour(n), nil
+	}
+	return Limit{}, errInvalidLimit
+}
+
+// Result of taking a token from a bucket
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// how long until a request will be allowed, 0 if this one was
+	RetryAfter time.Duration
+	// how long until the bucket is full again
+	Reset time.Duration
+}
+
+func newResult(limit Limit, allowed bool, tokens float64) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secondsToDuration((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / limit.Rate)
+	}
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// refill returns the tokens in a bucket after elapsed time
+func refill(limit Limit, tokens float64, elapsed time.Duration) float64 {
+	if elapsed > 0 {
+		tokens += elapsed.Seconds() * limit.Rate
+	}
+	return math.Min(tokens, float64(limit.Burst))
+}
+
+// the bucket expires once it would be full again, full and missing buckets
+// are the same
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil or updated == nil then
+	tokens = burst
+	updated = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - updated) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "updated", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+func (s *RedisStore) Take(key string, limit Limit) (Result, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	values, err := takeScript.Run(s.client, []string{key}, limit.Rate, limit.Burst, now).Result()
+	if err != nil {
+		return Result{}, err
+	}
+
+	reply, ok := values.([]interface{})
+	if !ok || len(reply) != 2 {
+		return Result{}, fmt.Errorf("unexpected rate limit reply %v", values)
+	}
+	allowed, _ := reply[0].(int64)
+	tokensValue, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(tokensValue, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(limit, allowed == 1, tokens), nil
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	// when the bucket refills, it can be dropped after
+	full time.Time
+}
+
+func (s *MemoryStore) Take(key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.operations++
+	if s.operations >= sweepInterval {
+		s.sweep(now)
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = bucket
+	}
+
+	bucket.tokens = refill(limit, bucket.tokens, now.Sub(bucket.updated))
+	bucket.updated = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+
+	result := newResult(limit, allowed, bucket.tokens)
+	bucket.full = now.Add(result.Reset)
+	return result, nil
+}
+
+func (s *fallbackStore) Take(key string, limit Limit) (Result, error) {
+	result, err := s.primary.Take(key, limit)
+	if err != nil {
+		s.warn(err)
+		return s.fallback.Take(key, limit)
+	}
+	return result, nil
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("60/m")
+	require.NoError(t, err)
+	assert.Equal(t, PerMinute(60), limit)
+
+	limit, err = ParseLimit(" 10/S ")
+	require.NoError(t, err)
+	assert.Equal(t, PerSecond(10), limit)
+
+	limit, err = ParseLimit("1000/h")
+	require.NoError(t, err)
+	assert.Equal(t, PerHour(1000), limit)
+
+	limit, err = ParseLimit("off")
+	require.NoError(t, err)
+	assert.True(t, limit.Unlimited())
+
+	for _, value := range []string{"", "60", "0/m", "-1/m", "ten/m", "60/d"} {
+		_, err := ParseLimit(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := PerSecond(2)
+
+	result, err := store.Take("key", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Limit)
+	assert.Equal(t, 1, result.Remaining)
+	assert.Equal(t, 500*time.Millisecond, result.Reset)
+
+	result, err = store.Take("key", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result, err = store.Take("key", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	assert.Equal(t, time.Second, result.Reset)
+
+	// other keys have their own bucket
+	result, err = store.Take("other", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// one token refills every half second
+	now = now.Add(500 * time.Millisecond)
+	result, err = store.Take("key", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// buckets never hold more than the burst
+	now = now.Add(time.Hour)
+	result, err = store.Take("key", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Remaining)
+}
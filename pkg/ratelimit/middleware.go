@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/api/util"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// KeyFunc identifies who a request counts against
+type KeyFunc func(r *http.Request) string
+
+// Limiter creates rate limit middlewares sharing a store
+type Limiter struct {
+	store     Store
+	key       KeyFunc
+	overrides map[string]Limit
+}
+
+// NewLimiter limits requests by key, overrides replace the default limits of
+// named middlewares
+func NewLimiter(store Store, key KeyFunc, overrides map[string]Limit) *Limiter {
+	return &Limiter{
+		store:     store,
+		key:       key,
+		overrides: overrides,
+	}
+}
+
+// Middleware limits requests to limit per key, each name has its own buckets.
+// Store errors don't block requests.
+func (l *Limiter) Middleware(name string, limit Limit) mux.MiddlewareFunc {
+	if override, ok := l.overrides[name]; ok {
+		limit = override
+	}
+
+	return func(next http.Handler) http.Handler {
+		if limit.Unlimited() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := l.store.Take("ratelimit:"+name+":"+l.key(r), limit)
+			if err != nil {
+				log.WithError(err).Warn("Error checking rate limit")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				util.RespondError(w, util.TooManyRequests("Too many requests, try again later"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// ParseOverrides parses limits by middleware name, e.g. "menu": "120/m"
+func ParseOverrides(overrides map[string]string) (map[string]Limit, error) {
+	limits := make(map[string]Limit, len(overrides))
+	for name, value := range overrides {
+		limit, err := ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %s: %v", name, err)
+		}
+		limits[strings.ToLower(name)] = limit
+	}
+	return limits, nil
+}
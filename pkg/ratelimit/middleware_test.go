@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), func(r *http.Request) string {
+		return r.Header.Get("X-Caller")
+	}, nil)
+	handler := limiter.Middleware("test", PerMinute(2))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(caller string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Caller", caller)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, request("a").Code)
+
+	w = request("a")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, request("b").Code)
+}
+
+func TestMiddlewareOverrides(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), func(r *http.Request) string { return "" }, map[string]Limit{
+		"off": {},
+	})
+	handler := limiter.Middleware("off", PerMinute(1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestParseOverrides(t *testing.T) {
+	limits, err := ParseOverrides(map[string]string{"MENU": "5/s", "orders": "off"})
+	assert.NoError(t, err)
+	assert.Equal(t, PerSecond(5), limits["menu"])
+	assert.True(t, limits["orders"].Unlimited())
+
+	_, err = ParseOverrides(map[string]string{"orders": "sometimes"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,229 @@
+// Package ratelimit tracks request counts in Redis, falling back to memory
+// when Redis isn't configured or can't be reached.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+// Store keeps counters that expire, shared between server instances when
+// backed by Redis
+type Store interface {
+	// Increment adds one to key and returns the new count, the key expires
+	// after window from the first increment
+	Increment(key string, window time.Duration) (int64, error)
+	// Set creates key with a count of one that expires after ttl
+	Set(key string, ttl time.Duration) error
+	// TTL returns how long key has left, 0 if it doesn't exist
+	TTL(key string) (time.Duration, error)
+	Delete(keys ...string) error
+	// Take removes a token from the bucket at key
+	Take(key string, limit Limit) (Result, error)
+}
+
+// NewStore uses Redis when a client is given and memory otherwise
+func NewStore(client *redis.Client) Store {
+	memory := NewMemoryStore()
+	if client == nil {
+		return memory
+	}
+	return &fallbackStore{
+		primary:  NewRedisStore(client),
+		fallback: memory,
+	}
+}
+
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// the expiry is only set on the first increment so the window doesn't slide
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+func (s *RedisStore) Increment(key string, window time.Duration) (int64, error) {
+	return incrementScript.Run(s.client, []string{key}, window.Milliseconds()).Int64()
+}
+
+func (s *RedisStore) Set(key string, ttl time.Duration) error {
+	return s.client.Set(key, 1, ttl).Err()
+}
+
+func (s *RedisStore) TTL(key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// negative values mean the key doesn't exist or has no expiry
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Delete(keys ...string) error {
+	return s.client.Del(keys...).Err()
+}
+
+type memoryEntry struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// MemoryStore keeps counters and buckets for a single server instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	buckets map[string]*memoryBucket
+	now     func() time.Time
+	// expired entries are removed every sweepInterval operations
+	operations int
+}
+
+const sweepInterval = 1000
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]*memoryEntry{},
+		buckets: map[string]*memoryBucket{},
+		now:     time.Now,
+	}
+}
+
+// entry returns the live entry for key, must be called with the lock held
+func (s *MemoryStore) entry(key string, now time.Time) *memoryEntry {
+	s.operations++
+	if s.operations >= sweepInterval {
+		s.sweep(now)
+	}
+
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		return nil
+	}
+	return e
+}
+
+// sweep removes expired entries and full buckets, must be called with the
+// lock held
+func (s *MemoryStore) sweep(now time.Time) {
+	s.operations = 0
+	for key, e := range s.entries {
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+	for key, bucket := range s.buckets {
+		if !now.Before(bucket.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func (s *MemoryStore) Increment(key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	e := s.entry(key, now)
+	if e == nil {
+		e = &memoryEntry{expiresAt: now.Add(window)}
+		s.entries[key] = e
+	}
+	e.count++
+	return e.count, nil
+}
+
+func (s *MemoryStore) Set(key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = &memoryEntry{count: 1, expiresAt: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) TTL(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	e := s.entry(key, now)
+	if e == nil {
+		return 0, nil
+	}
+	return e.expiresAt.Sub(now), nil
+}
+
+func (s *MemoryStore) Delete(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// fallbackStore uses memory while Redis is failing so limits keep working,
+// counts are per instance until Redis is back
+type fallbackStore struct {
+	primary  Store
+	fallback Store
+}
+
+func (s *fallbackStore) warn(err error) {
+	log.WithError(err).Warn("Rate limit store unavailable, using memory")
+}
+
+func (s *fallbackStore) Increment(key string, window time.Duration) (int64, error) {
+	count, err := s.primary.Increment(key, window)
+	if err != nil {
+		s.warn(err)
+		return s.fallback.Increment(key, window)
+	}
+	return count, nil
+}
+
+func (s *fallbackStore) Set(key string, ttl time.Duration) error {
+	if err := s.primary.Set(key, ttl); err != nil {
+		s.warn(err)
+		return s.fallback.Set(key, ttl)
+	}
+	return nil
+}
+
+func (s *fallbackStore) TTL(key string) (time.Duration, error) {
+	// keys written to memory during an outage still apply once Redis is back
+	fallbackTTL, _ := s.fallback.TTL(key)
+	ttl, err := s.primary.TTL(key)
+	if err != nil {
+		s.warn(err)
+		return fallbackTTL, nil
+	}
+	if fallbackTTL > ttl {
+		return fallbackTTL, nil
+	}
+	return ttl, nil
+}
+
+func (s *fallbackStore) Delete(keys ...string) error {
+	// keys may have been written to memory during an outage
+	s.fallback.Delete(keys...)
+	if err := s.primary.Delete(keys...); err != nil {
+		s.warn(err)
+	}
+	return nil
+}
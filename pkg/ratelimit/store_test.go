@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreIncrement(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	for i := int64(1); i <= 3; i++ {
+		count, err := store.Increment("key", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, i, count)
+	}
+
+	// the window doesn't slide with increments
+	now = now.Add(30 * time.Second)
+	ttl, err := store.TTL("key")
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, ttl)
+
+	now = now.Add(30 * time.Second)
+	count, err := store.Increment("key", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMemoryStoreSetAndDelete(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	ttl, err := store.TTL("lock")
+	require.NoError(t, err)
+	assert.Zero(t, ttl)
+
+	require.NoError(t, store.Set("lock", time.Minute))
+	ttl, err = store.TTL("lock")
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+
+	require.NoError(t, store.Delete("lock"))
+	ttl, err = store.TTL("lock")
+	require.NoError(t, err)
+	assert.Zero(t, ttl)
+
+	require.NoError(t, store.Set("lock", time.Minute))
+	now = now.Add(time.Minute)
+	ttl, err = store.TTL("lock")
+	require.NoError(t, err)
+	assert.Zero(t, ttl)
+}
+
+type failingStore struct{}
+
+var errUnavailable = errors.New("unavailable")
+
+func (failingStore) Increment(string, time.Duration) (int64, error) { return 0, errUnavailable }
+func (failingStore) Set(string, time.Duration) error                { return errUnavailable }
+func (failingStore) TTL(string) (time.Duration, error)              { return 0, errUnavailable }
+func (failingStore) Delete(...string) error                         { return errUnavailable }
+func (failingStore) Take(string, Limit) (Result, error)             { return Result{}, errUnavailable }
+
+func TestFallbackStore(t *testing.T) {
+	store := &fallbackStore{
+		primary:  failingStore{},
+		fallback: NewMemoryStore(),
+	}
+
+	count, err := store.Increment("key", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	count, err = store.Increment("key", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	require.NoError(t, store.Set("lock", time.Minute))
+	ttl, err := store.TTL("lock")
+	require.NoError(t, err)
+	assert.True(t, ttl > 0)
+
+	require.NoError(t, store.Delete("lock"))
+	ttl, err = store.TTL("lock")
+	require.NoError(t, err)
+	assert.Zero(t, ttl)
+}
@@ -0,0 +1,72 @@
+package receipts
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	texttemplate "text/template"
+)
+
+// width of the plain text receipt in characters
+const lineWidth = 40
+
+var templateFuncs = map[string]interface{}{
+	"money": func(amount float64) string {
+		return fmt.Sprintf("$%.2f", amount)
+	},
+	"line": func(left string, right string) string {
+		padding := lineWidth - len(left) - len(right)
+		if padding < 1 {
+			padding = 1
+		}
+		return left + strings.Repeat(" ", padding) + right
+	},
+}
+
+// Generator renders receipts from templates
+type Generator struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// NewGenerator creates a generator using the default receipt templates
+func NewGenerator() (*Generator, error) {
+	return NewGeneratorFromTemplates(htmlTemplate, textTemplate)
+}
+
+// NewGeneratorFromTemplates creates a generator using custom templates, both
+// templates are executed with a *Receipt and can use the money and line functions
+func NewGeneratorFromTemplates(html string, text string) (*Generator, error) {
+	htmlTmpl, err := htmltemplate.New("receipt.html").Funcs(templateFuncs).Parse(html)
+	if err != nil {
+		return nil, err
+	}
+	textTmpl, err := texttemplate.New("receipt.txt").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Generator{
+		html: htmlTmpl,
+		text: textTmpl,
+	}, nil
+}
+
+func (g *Generator) HTML(w io.Writer, receipt *Receipt) error {
+	return g.html.Execute(w, receipt)
+}
+
+func (g *Generator) Text(w io.Writer, receipt *Receipt) error {
+	return g.text.Execute(w, receipt)
+}
+
+// PDF renders the plain text receipt into a PDF document
+func (g *Generator) PDF(w io.Writer, receipt *Receipt) error {
+	var text bytes.Buffer
+	if err := g.Text(&text, receipt); err != nil {
+		return err
+	}
+	return writePDF(w, strings.Split(strings.TrimRight(text.String(), "\n"), "\n"))
+}
@@ -0,0 +1,67 @@
+package receipts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+)
+
+type Line struct {
+	Name    string
+	Options string
+	Price   float64
+}
+
+// Receipt holds everything shown on a customer receipt for a transaction
+type Receipt struct {
+	ShopName      string
+	TransactionId uint
+	Date          time.Time
+	Status        string
+	CustomerName  string
+	CustomerEmail string
+
+	Items        []Line
+	Total        float64
+	AmountPaid   float64
+	BalanceOwing float64
+}
+
+// New builds a receipt for a transaction, items without a coffee name fall
+// back to a generic name
+func New(shopName string, transaction *models.Transaction, items []*models.PurchaseItemDetail, user *models.User) *Receipt {
+	receipt := Receipt{
+		ShopName:      shopName,
+		TransactionId: transaction.ID,
+		Date:          transaction.CreatedAt,
+		Status:        transaction.Status,
+		Total:         transaction.Total,
+		AmountPaid:    transaction.AmountPaid,
+		Items:         make([]Line, 0, len(items)),
+	}
+
+	if user != nil {
+		receipt.CustomerName = user.FirstName + " " + user.LastName
+		receipt.CustomerEmail = user.Email
+	}
+
+	for _, item := range items {
+		name := item.CoffeeName
+		if name == "" {
+			name = fmt.Sprintf("Coffee #%d", item.CoffeeId)
+		}
+		receipt.Items = append(receipt.Items, Line{
+			Name:    name,
+			Options: item.TypeOption,
+			Price:   item.Price,
+		})
+	}
+
+	// nothing is owed on cancelled orders
+	if !transaction.IsCancelled() && receipt.Total > receipt.AmountPaid {
+		receipt.BalanceOwing = receipt.Total - receipt.AmountPaid
+	}
+
+	return &receipt
+}
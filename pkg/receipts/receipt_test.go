@@ -0,0 +1,109 @@
+package receipts
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testReceipt(status string) *Receipt {
+	transaction := models.Transaction{
+		UserId:     uuid.New(),
+		AmountPaid: 1,
+		Total:      2.5,
+		Status:     status,
+	}
+	transaction.ID = 42
+	transaction.CreatedAt = time.Date(2019, 10, 2, 9, 30, 0, 0, time.UTC)
+
+	items := []*models.PurchaseItemDetail{
+		{CoffeeId: 1, CoffeeName: "House Blend", Price: 1.25, TypeOption: "latte"},
+		{CoffeeId: 2, Price: 1.25},
+	}
+	user := models.User{
+		FirstName: "Test",
+		LastName:  "User",
+		Email:     "test@testtest.test",
+	}
+
+	return New("Test Shop", &transaction, items, &user)
+}
+
+func TestNew(t *testing.T) {
+	receipt := testReceipt(models.TransactionStatusPlaced)
+
+	require.Len(t, receipt.Items, 2)
+	assert.Equal(t, "House Blend", receipt.Items[0].Name)
+	assert.Equal(t, "latte", receipt.Items[0].Options)
+	assert.Equal(t, "Coffee #2", receipt.Items[1].Name)
+	assert.Equal(t, "Test User", receipt.CustomerName)
+	assert.Equal(t, 1.5, receipt.BalanceOwing)
+
+	cancelled := testReceipt(models.TransactionStatusCancelled)
+	assert.Equal(t, float64(0), cancelled.BalanceOwing)
+}
+
+func TestRenderHTML(t *testing.T) {
+	generator, err := NewGenerator()
+	require.NoError(t, err)
+
+	var html bytes.Buffer
+	err = generator.HTML(&html, testReceipt(models.TransactionStatusPlaced))
+	require.NoError(t, err)
+
+	assert.Contains(t, html.String(), "Test Shop")
+	assert.Contains(t, html.String(), "Receipt #42")
+	assert.Contains(t, html.String(), "House Blend")
+	assert.Contains(t, html.String(), "$1.50")
+	assert.NotContains(t, html.String(), "cancelled")
+}
+
+func TestRenderText(t *testing.T) {
+	generator, err := NewGenerator()
+	require.NoError(t, err)
+
+	var text bytes.Buffer
+	err = generator.Text(&text, testReceipt(models.TransactionStatusCancelled))
+	require.NoError(t, err)
+
+	assert.Contains(t, text.String(), "This order was cancelled.")
+	for _, line := range strings.Split(text.String(), "\n") {
+		if strings.HasPrefix(line, "Total") {
+			assert.Len(t, line, lineWidth)
+			assert.True(t, strings.HasSuffix(line, "$2.50"))
+		}
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	generator, err := NewGenerator()
+	require.NoError(t, err)
+
+	var pdf bytes.Buffer
+	err = generator.PDF(&pdf, testReceipt(models.TransactionStatusPlaced))
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(pdf.String(), "%PDF-1.4"))
+	assert.True(t, strings.HasSuffix(pdf.String(), "%%EOF\n"))
+	assert.Contains(t, pdf.String(), "(House Blend")
+}
+
+func TestWritePDFMultiplePages(t *testing.T) {
+	lines := make([]string, linesPerPage*2+1)
+	for i := range lines {
+		lines[i] = "line (with parens)"
+	}
+
+	var pdf bytes.Buffer
+	err := writePDF(&pdf, lines)
+	require.NoError(t, err)
+
+	assert.Contains(t, pdf.String(), "/Count 3")
+	assert.Contains(t, pdf.String(), `(line \(with parens\)) Tj`)
+}
@@ -0,0 +1,50 @@
+package receipts
+
+const htmlTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.ShopName}} - Receipt #{{.TransactionId}}</title>
+</head>
+<body style="font-family: sans-serif; max-width: 480px; margin: auto;">
+<h1>{{.ShopName}}</h1>
+<p>
+Receipt #{{.TransactionId}}<br>
+{{.Date.Format "Jan 2, 2006 3:04 PM"}}{{if .CustomerName}}<br>
+{{.CustomerName}}{{end}}
+</p>
+{{if eq .Status "cancelled"}}<p><strong>This order was cancelled.</strong></p>
+{{end}}<table style="width: 100%; border-collapse: collapse;">
+<thead>
+<tr><th style="text-align: left;">Item</th><th style="text-align: right;">Price</th></tr>
+</thead>
+<tbody>
+{{range .Items}}<tr>
+<td>{{.Name}}{{if .Options}}<br><small>{{.Options}}</small>{{end}}</td>
+<td style="text-align: right;">{{money .Price}}</td>
+</tr>
+{{end}}</tbody>
+<tfoot>
+<tr><th style="text-align: left;">Total</th><td style="text-align: right;">{{money .Total}}</td></tr>
+<tr><th style="text-align: left;">Amount Paid</th><td style="text-align: right;">{{money .AmountPaid}}</td></tr>
+<tr><th style="text-align: left;">Balance Owing</th><td style="text-align: right;">{{money .BalanceOwing}}</td></tr>
+</tfoot>
+</table>
+</body>
+</html>
+`
+
+const textTemplate = `{{.ShopName}}
+Receipt #{{.TransactionId}}
+{{.Date.Format "Jan 2, 2006 3:04 PM"}}{{if .CustomerName}}
+{{.CustomerName}}{{end}}
+{{if eq .Status "cancelled"}}
+This order was cancelled.
+{{end}}
+{{range .Items}}{{line .Name (money .Price)}}
+{{if .Options}}  {{.Options}}
+{{end}}{{end}}
+{{line "Total" (money .Total)}}
+{{line "Amount Paid" (money .AmountPaid)}}
+{{line "Balance Owing" (money .BalanceOwing)}}
+`
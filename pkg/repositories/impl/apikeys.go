@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/persistence"
+	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/jinzhu/gorm"
+)
+
+// lastUsedResolution limits how often last_used_at is written for busy keys
+const lastUsedResolution = time.Minute
+
+type APIKeyRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) repository_interfaces.APIKeyRepository {
+	return &APIKeyRepositoryImpl{
+		db: db,
+	}
+}
+
+func (repo *APIKeyRepositoryImpl) CreateAPIKey(tx *gorm.DB, key *models.APIKey) error {
+	return persistence.CreateAPIKey(tx, key)
+}
+
+func (repo *APIKeyRepositoryImpl) GetAPIKeyByPrefix(tx *gorm.DB, prefix string) (*models.APIKey, error) {
+	return persistence.GetAPIKeyByPrefix(tx, prefix)
+}
+
+func (repo *APIKeyRepositoryImpl) GetAPIKeyById(tx *gorm.DB, keyId string) (*models.APIKey, error) {
+	return persistence.GetAPIKeyByID(tx, keyId)
+}
+
+func (repo *APIKeyRepositoryImpl) GetAPIKeys(tx *gorm.DB) ([]*models.APIKey, error) {
+	return persistence.GetAPIKeys(tx)
+}
+
+func (repo *APIKeyRepositoryImpl) RevokeAPIKey(tx *gorm.DB, key *models.APIKey) error {
+	if key.IsRevoked() {
+		return nil
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	return persistence.UpdateAPIKey(tx, key)
+}
+
+func (repo *APIKeyRepositoryImpl) TouchAPIKey(tx *gorm.DB, key *models.APIKey, usedAt time.Time) error {
+	if key.LastUsedAt != nil && usedAt.Sub(*key.LastUsedAt) < lastUsedResolution {
+		return nil
+	}
+	if err := persistence.TouchAPIKey(tx, key.ID, usedAt); err != nil {
+		return err
+	}
+	key.LastUsedAt = &usedAt
+	return nil
+}
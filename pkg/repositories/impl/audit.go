@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"strconv"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/persistence"
+	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/jinzhu/gorm"
+)
+
+type AuditRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) repository_interfaces.AuditRepository {
+	return &AuditRepositoryImpl{
+		db: db,
+	}
+}
+
+func (repo *AuditRepositoryImpl) CreateAuditEvent(tx *gorm.DB, event *models.AuditEvent) error {
+	return persistence.CreateAuditEvent(tx, event)
+}
+
+func (repo *AuditRepositoryImpl) GetAuditEventsPaginated(tx *gorm.DB, query *repository_interfaces.AuditPageQuery) ([]*models.AuditEvent, *repository_interfaces.PageInfo, error) {
+	// fetch an extra row to find out if there's another page
+	events, err := persistence.GetAuditEventsPaginated(tx, query.PageSize+1, query.Page, query.Cursor, &query.AuditFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	count, err := persistence.CountAuditEvents(tx, &query.AuditFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pageInfo, n := newPageInfo(count, len(events), query.PageSize, func(i int) *listing.Cursor {
+		return &listing.Cursor{
+			CreatedAt: events[i].CreatedAt,
+			ID:        strconv.FormatUint(uint64(events[i].ID), 10),
+		}
+	})
+	return events[:n], pageInfo, nil
+}
@@ -3,92 +3,166 @@ package repository
 import (
 	"encoding/base64"
 	"encoding/json"
+	"strconv"
 	"time"
 
+	"github.com/ericklikan/dollar-coffee-backend/pkg/cache"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/dbtx"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/persistence"
 	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
-	"github.com/go-redis/redis/v7"
 	"github.com/jinzhu/gorm"
 	log "github.com/sirupsen/logrus"
 )
 
-const redisExpiryTime = 24
-const redisMenuKey = "menu"
+// menuCacheGroup holds every cached page of the menu, it also labels the
+// cache metrics
+const menuCacheGroup = "menu"
 
 type CoffeeRepositoryImpl struct {
-	db    *gorm.DB
-	redis *redis.Client
+	db        *gorm.DB
+	menuCache *cache.Group
 }
 
-func NewCoffeeRepository(db *gorm.DB, redis *redis.Client) repository_interfaces.CoffeeRepository {
+// NewCoffeeRepository caches pages of the menu in menuCache for menuTTL
+func NewCoffeeRepository(db *gorm.DB, menuCache cache.Cache, menuTTL time.Duration) repository_interfaces.CoffeeRepository {
 	return &CoffeeRepositoryImpl{
-		db:    db,
-		redis: redis,
+		db:        db,
+		menuCache: cache.NewGroup(menuCache, menuCacheGroup, menuTTL),
 	}
 }
 
+// invalidateMenu drops every cached page of the menu once tx commits, so
+// requests reading the menu before then can't cache the old rows again
+func (repo *CoffeeRepositoryImpl) invalidateMenu(tx *gorm.DB) {
+	dbtx.AfterCommit(tx, func() {
+		if err := repo.menuCache.Invalidate(); err != nil {
+			log.WithError(err).Warn("Error invalidating menu cache")
+		}
+	})
+}
+
 func (repo *CoffeeRepositoryImpl) CreateCoffee(tx *gorm.DB, coffee *models.Coffee) error {
-	// invalidate cache
-	repo.redis.Del(redisMenuKey)
-	return persistence.CreateCoffee(tx, coffee)
+	if err := persistence.CreateCoffee(tx, coffee); err != nil {
+		return err
+	}
+	repo.invalidateMenu(tx)
+	return nil
 }
 
 func (repo *CoffeeRepositoryImpl) GetCoffeesByIds(tx *gorm.DB, coffeeIds []string) (map[string]*models.Coffee, error) {
 	return persistence.GetCoffeesByID(tx, coffeeIds)
 }
 
-func (repo *CoffeeRepositoryImpl) GetCoffeesPaginated(tx *gorm.DB, query *repository_interfaces.CoffeePageQuery) ([]*models.Coffee, error) {
+func (repo *CoffeeRepositoryImpl) GetCoffeesPaginated(tx *gorm.DB, query *repository_interfaces.CoffeePageQuery) ([]*models.Coffee, *repository_interfaces.PageInfo, error) {
+	page, err := repo.getCoffeesPage(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	coffees := page.Coffees
+	pageInfo, n := newPageInfo(page.TotalCount, len(coffees), query.PageSize, func(i int) *listing.Cursor {
+		return &listing.Cursor{
+			CreatedAt: coffees[i].CreatedAt,
+			ID:        strconv.FormatUint(uint64(coffees[i].ID), 10),
+		}
+	})
+	return coffees[:n], pageInfo, nil
+}
+
+// coffeePage is what gets cached for each page of the menu
+type coffeePage struct {
+	// Coffees has an extra row at the end if there is another page
+	Coffees    []*models.Coffee
+	TotalCount int
+}
+
+// getCoffeesPage returns the coffees for a page plus an extra row if there is
+// another page, cached by the configured cache
+func (repo *CoffeeRepositoryImpl) getCoffeesPage(query *repository_interfaces.CoffeePageQuery) (*coffeePage, error) {
 	logger := log.WithFields(log.Fields{
 		"Repository": "CoffeeRepository",
 	})
 
-	// retrieve redis key
+	// every query is cached separately
 	jsonString, err := json.Marshal(query)
 	if err != nil {
 		return nil, err
 	}
 	encodedQuery := base64.StdEncoding.EncodeToString([]byte(jsonString))
 
-	coffeePage, err := repo.redis.HGet(redisMenuKey, encodedQuery).Result()
-	if err != nil || len(coffeePage) == 0 {
-		// Don't fail request if redis doesn't work
-		logger.WithError(err).Warn("Redis Error")
-
-		newCoffeePage, err := persistence.GetCoffeesPaginated(tx, query.PageSize, query.Page, query.InStock)
+	cachedPage, err := repo.menuCache.Get(encodedQuery, func() ([]byte, error) {
+		// pages are shared with every request, so they are read outside of
+		// the caller's transaction and only ever hold committed rows
+		coffees, err := persistence.GetCoffeesPaginated(repo.db, query.PageSize+1, query.Page, query.Cursor, query.InStock)
 		if err != nil {
 			return nil, err
 		}
-		newCoffeePageJson, err := json.Marshal(newCoffeePage)
+		count, err := persistence.CountCoffees(repo.db, query.InStock)
 		if err != nil {
-			logger.WithError(err).Warn("Error marshalling struct to json")
-			return newCoffeePage, nil
+			return nil, err
 		}
-
-		repo.redis.HSet(redisMenuKey, encodedQuery, newCoffeePageJson)
-		repo.redis.Expire(redisMenuKey, redisExpiryTime*time.Hour)
-		return newCoffeePage, nil
+		return json.Marshal(&coffeePage{
+			Coffees:    coffees,
+			TotalCount: count,
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	logger.Debug("Fetching from redis")
-	var coffeePageResult []*models.Coffee
-	err = json.Unmarshal([]byte(coffeePage), &coffeePageResult)
+	var coffeePageResult coffeePage
+	err = json.Unmarshal(cachedPage, &coffeePageResult)
 	if err != nil {
 		logger.WithError(err).Warn("Error unmarshalling page from json")
 		return nil, err
 	}
 
-	return coffeePageResult, nil
+	return &coffeePageResult, nil
 }
 
 func (repo *CoffeeRepositoryImpl) UpdateCoffee(tx *gorm.DB, coffee *models.Coffee) error {
-	// invalidate cache
-	repo.redis.Del(redisMenuKey)
-	return persistence.UpdateCoffee(tx, coffee)
+	if err := persistence.UpdateCoffee(tx, coffee); err != nil {
+		return err
+	}
+	repo.invalidateMenu(tx)
+	return nil
+}
+
+func (repo *CoffeeRepositoryImpl) AdjustStock(tx *gorm.DB, adjustments map[uint]int) error {
+	// the menu only changes for coffees with tracked stock
+	changed := false
+	for coffeeId, delta := range adjustments {
+		if delta == 0 {
+			continue
+		}
+		adjusted, err := persistence.AdjustCoffeeStock(tx, coffeeId, delta)
+		if err != nil {
+			return err
+		}
+		if !adjusted && delta < 0 {
+			// untracked coffees are never out of stock
+			tracked, err := persistence.IsStockTracked(tx, coffeeId)
+			if err != nil {
+				return err
+			}
+			if tracked {
+				return repository_interfaces.ErrOutOfStock
+			}
+		}
+		changed = changed || adjusted
+	}
+	if changed {
+		repo.invalidateMenu(tx)
+	}
+	return nil
 }
 
 func (repo *CoffeeRepositoryImpl) DeleteCoffee(tx *gorm.DB, coffeeId string) error {
-	// invalidate cache
-	repo.redis.Del(redisMenuKey)
-	return persistence.DeleteCoffee(tx, coffeeId)
+	if err := persistence.DeleteCoffee(tx, coffeeId); err != nil {
+		return err
+	}
+	repo.invalidateMenu(tx)
+	return nil
 }
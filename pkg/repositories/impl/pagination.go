@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+)
+
+// newPageInfo builds the page info of a listing that fetched pageSize+1 rows
+// to find out if there's another page, and returns how many of the rows
+// belong to the page. cursorAt builds the cursor of the row at an index, it
+// is nil for listings that can't be continued with a cursor.
+func newPageInfo(totalCount, rows, pageSize int, cursorAt func(i int) *listing.Cursor) (*repository_interfaces.PageInfo, int) {
+	pageInfo := &repository_interfaces.PageInfo{
+		TotalCount: totalCount,
+	}
+	if rows <= pageSize {
+		return pageInfo, rows
+	}
+
+	pageInfo.HasMore = true
+	if cursorAt != nil {
+		pageInfo.NextCursor = cursorAt(pageSize - 1)
+	}
+	return pageInfo, pageSize
+}
@@ -1,19 +1,27 @@
 package repository
 
 import (
+	"strconv"
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/persistence"
 	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 )
 
 type TransactionsRepositoryImpl struct {
 	db *gorm.DB
+	// puts the items of cancelled transactions back into stock
+	coffeeRepository repository_interfaces.CoffeeRepository
 }
 
-func NewTransactionsRepository(db *gorm.DB) repository_interfaces.TransactionsRepository {
+func NewTransactionsRepository(db *gorm.DB, coffeeRepository repository_interfaces.CoffeeRepository) repository_interfaces.TransactionsRepository {
 	return &TransactionsRepositoryImpl{
-		db: db,
+		db:               db,
+		coffeeRepository: coffeeRepository,
 	}
 }
 
@@ -25,8 +33,46 @@ func (repo *TransactionsRepositoryImpl) GetTransactionsByIds(tx *gorm.DB, transa
 	return persistence.GetTransactionsByID(tx, transactionIds)
 }
 
-func (repo *TransactionsRepositoryImpl) GetTransactionsPaginated(tx *gorm.DB, query *repository_interfaces.PurchasePageQuery) ([]*models.Transaction, error) {
-	return persistence.GetTransactionsPaginated(tx, query.PageSize, query.Page, query.UserId, query.Sort, query.SortDirection)
+func (repo *TransactionsRepositoryImpl) GetTransactionForUpdate(tx *gorm.DB, transactionId string) (*models.Transaction, error) {
+	return persistence.GetTransactionForUpdate(tx, transactionId)
+}
+
+func (repo *TransactionsRepositoryImpl) GetTransactionsPaginated(tx *gorm.DB, query *repository_interfaces.PurchasePageQuery) ([]*models.Transaction, *repository_interfaces.PageInfo, error) {
+	// fetch an extra row to find out if there's another page
+	purchases, err := persistence.GetTransactionsPaginated(tx, query.PageSize+1, query.Page, query.Cursor, &query.PurchaseFilter, query.Sort, query.SortDirection)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	count, err := persistence.CountTransactions(tx, &query.PurchaseFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// cursors can only continue listings sorted by created_at
+	var cursorAt func(i int) *listing.Cursor
+	if query.Sort == nil || *query.Sort == listing.PurchaseSortCreatedAt {
+		cursorAt = func(i int) *listing.Cursor {
+			return &listing.Cursor{
+				CreatedAt: purchases[i].CreatedAt,
+				ID:        strconv.FormatUint(uint64(purchases[i].ID), 10),
+			}
+		}
+	}
+	pageInfo, n := newPageInfo(count, len(purchases), query.PageSize, cursorAt)
+	return purchases[:n], pageInfo, nil
+}
+
+func (repo *TransactionsRepositoryImpl) CountOutstandingTransactions(tx *gorm.DB, userId string) (int, error) {
+	return persistence.CountOutstandingTransactions(tx, userId)
+}
+
+func (repo *TransactionsRepositoryImpl) GetTransactionItems(tx *gorm.DB, purchaseId string) ([]*models.PurchaseItem, error) {
+	return persistence.GetPurchaseItemsByTransactionID(tx, purchaseId)
+}
+
+func (repo *TransactionsRepositoryImpl) GetTransactionItemDetails(tx *gorm.DB, purchaseId string) ([]*models.PurchaseItemDetail, error) {
+	return persistence.GetPurchaseItemDetailsByTransactionID(tx, purchaseId)
 }
 
 func (repo *TransactionsRepositoryImpl) UpdateTransaction(tx *gorm.DB, purchase *models.Transaction) error {
@@ -36,3 +82,51 @@ func (repo *TransactionsRepositoryImpl) UpdateTransaction(tx *gorm.DB, purchase
 func (repo *TransactionsRepositoryImpl) DeleteTransaction(tx *gorm.DB, purchaseId string) error {
 	return persistence.DeleteTransaction(tx, purchaseId)
 }
+
+func (repo *TransactionsRepositoryImpl) CancelTransaction(tx *gorm.DB, purchase *models.Transaction, cancelledBy uuid.UUID, reason string) error {
+	if purchase.IsCancelled() {
+		return repository_interfaces.ErrAlreadyCancelled
+	}
+
+	items, err := persistence.GetPurchaseItemsByTransactionID(tx, strconv.FormatUint(uint64(purchase.ID), 10))
+	if err != nil {
+		return err
+	}
+	stockAdjustments := make(map[uint]int)
+	for _, item := range items {
+		stockAdjustments[item.CoffeeId]++
+	}
+	if err := repo.coffeeRepository.AdjustStock(tx, stockAdjustments); err != nil {
+		return err
+	}
+
+	if purchase.AmountPaid > 0 {
+		refund := models.Payment{
+			TransactionId: purchase.ID,
+			Amount:        purchase.AmountPaid,
+			Kind:          models.PaymentKindRefund,
+			RecordedBy:    cancelledBy,
+			Note:          reason,
+		}
+		if err := persistence.CreatePayment(tx, &refund); err != nil {
+			return err
+		}
+		purchase.AmountPaid = 0
+	}
+
+	now := time.Now()
+	purchase.Status = models.TransactionStatusCancelled
+	purchase.CancelledAt = &now
+	purchase.CancelledBy = &cancelledBy
+	purchase.CancellationReason = reason
+
+	return persistence.UpdateTransaction(tx, purchase)
+}
+
+func (repo *TransactionsRepositoryImpl) CreatePayment(tx *gorm.DB, payment *models.Payment) error {
+	return persistence.CreatePayment(tx, payment)
+}
+
+func (repo *TransactionsRepositoryImpl) GetTransactionPayments(tx *gorm.DB, purchaseId string) ([]*models.Payment, error) {
+	return persistence.GetPaymentsByTransactionID(tx, purchaseId)
+}
@@ -1,9 +1,13 @@
 package repository
 
 import (
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/persistence"
 	repository_interfaces "github.com/ericklikan/dollar-coffee-backend/pkg/repositories/interfaces"
+	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 )
 
@@ -29,8 +33,25 @@ func (repo *UserRepositoryImpl) GetUsersByIds(tx *gorm.DB, userIds []string) (ma
 	return persistence.GetUsersByID(tx, userIds)
 }
 
-func (repo *UserRepositoryImpl) GetUsersPaginated(tx *gorm.DB, query *repository_interfaces.UsersPageQuery) ([]*models.User, error) {
-	return persistence.GetUsersPaginated(tx, query.PageSize, query.Page, query.Role)
+func (repo *UserRepositoryImpl) GetUsersPaginated(tx *gorm.DB, query *repository_interfaces.UsersPageQuery) ([]*models.User, *repository_interfaces.PageInfo, error) {
+	// fetch an extra row to find out if there's another page
+	users, err := persistence.GetUsersPaginated(tx, query.PageSize+1, query.Page, query.Cursor, &query.UserFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	count, err := persistence.CountUsers(tx, &query.UserFilter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pageInfo, n := newPageInfo(count, len(users), query.PageSize, func(i int) *listing.Cursor {
+		return &listing.Cursor{
+			CreatedAt: users[i].CreatedAt,
+			ID:        users[i].ID.String(),
+		}
+	})
+	return users[:n], pageInfo, nil
 }
 
 func (repo *UserRepositoryImpl) UpdateUser(tx *gorm.DB, user *models.User) error {
@@ -40,3 +61,30 @@ func (repo *UserRepositoryImpl) UpdateUser(tx *gorm.DB, user *models.User) error
 func (repo *UserRepositoryImpl) DeleteUser(tx *gorm.DB, userId string) error {
 	return persistence.DeleteUser(tx, userId)
 }
+
+func (repo *UserRepositoryImpl) ReplaceRecoveryCodes(tx *gorm.DB, userId uuid.UUID, hashes []string) error {
+	if err := persistence.DeleteRecoveryCodes(tx, userId.String()); err != nil {
+		return err
+	}
+
+	codes := make([]*models.RecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		codes = append(codes, &models.RecoveryCode{
+			UserId: userId,
+			Hash:   hash,
+		})
+	}
+	return persistence.CreateRecoveryCodes(tx, codes)
+}
+
+func (repo *UserRepositoryImpl) DeleteRecoveryCodes(tx *gorm.DB, userId string) error {
+	return persistence.DeleteRecoveryCodes(tx, userId)
+}
+
+func (repo *UserRepositoryImpl) UseRecoveryCode(tx *gorm.DB, userId string, hash string) (bool, error) {
+	return persistence.UseRecoveryCode(tx, userId, hash, time.Now())
+}
+
+func (repo *UserRepositoryImpl) CountUnusedRecoveryCodes(tx *gorm.DB, userId string) (int, error) {
+	return persistence.CountUnusedRecoveryCodes(tx, userId)
+}
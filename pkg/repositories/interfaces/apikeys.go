@@ -0,0 +1,17 @@
+package repository_interfaces
+
+import (
+	"time"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/jinzhu/gorm"
+)
+
+type APIKeyRepository interface {
+	CreateAPIKey(tx *gorm.DB, key *models.APIKey) error
+	GetAPIKeyByPrefix(tx *gorm.DB, prefix string) (*models.APIKey, error)
+	GetAPIKeyById(tx *gorm.DB, keyId string) (*models.APIKey, error)
+	GetAPIKeys(tx *gorm.DB) ([]*models.APIKey, error)
+	RevokeAPIKey(tx *gorm.DB, key *models.APIKey) error
+	TouchAPIKey(tx *gorm.DB, key *models.APIKey, usedAt time.Time) error
+}
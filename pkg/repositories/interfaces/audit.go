@@ -0,0 +1,18 @@
+package repository_interfaces
+
+import (
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/jinzhu/gorm"
+)
+
+type AuditPageQuery struct {
+	PageQuery
+	listing.AuditFilter
+}
+
+// AuditRepository only appends events, they can't be changed once written
+type AuditRepository interface {
+	CreateAuditEvent(tx *gorm.DB, event *models.AuditEvent) error
+	GetAuditEventsPaginated(tx *gorm.DB, query *AuditPageQuery) ([]*models.AuditEvent, *PageInfo, error)
+}
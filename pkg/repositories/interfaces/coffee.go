@@ -1,10 +1,15 @@
 package repository_interfaces
 
 import (
+	"errors"
+
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
 	"github.com/jinzhu/gorm"
 )
 
+// ErrOutOfStock is returned when there isn't enough stock of a coffee left
+var ErrOutOfStock = errors.New("out of stock")
+
 type CoffeePageQuery struct {
 	PageQuery
 
@@ -14,7 +19,10 @@ type CoffeePageQuery struct {
 type CoffeeRepository interface {
 	CreateCoffee(tx *gorm.DB, coffee *models.Coffee) error
 	GetCoffeesByIds(tx *gorm.DB, coffeeIds []string) (map[string]*models.Coffee, error)
-	GetCoffeesPaginated(tx *gorm.DB, query *CoffeePageQuery) ([]*models.Coffee, error)
+	GetCoffeesPaginated(tx *gorm.DB, query *CoffeePageQuery) ([]*models.Coffee, *PageInfo, error)
 	UpdateCoffee(tx *gorm.DB, coffee *models.Coffee) error
+	// AdjustStock adds the given deltas, keyed by coffee id, to the stock of tracked coffees.
+	// It returns ErrOutOfStock when a tracked coffee doesn't have enough stock left.
+	AdjustStock(tx *gorm.DB, adjustments map[uint]int) error
 	DeleteCoffee(tx *gorm.DB, coffeeId string) error
 }
@@ -1,6 +1,23 @@
 package repository_interfaces
 
+import (
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
+)
+
 type PageQuery struct {
 	Page     int
 	PageSize int
+
+	// Cursor continues a listing after the last item of the previous page,
+	// Page is ignored when a cursor is given
+	Cursor *listing.Cursor
+}
+
+type PageInfo struct {
+	// TotalCount is the number of items matching the query across all pages
+	TotalCount int
+	HasMore    bool
+
+	// NextCursor points at the last item of the page, nil if there are no more items
+	NextCursor *listing.Cursor
 }
@@ -1,14 +1,21 @@
 package repository_interfaces
 
 import (
+	"errors"
+
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 )
 
+// ErrAlreadyCancelled is returned when cancelling a transaction twice
+var ErrAlreadyCancelled = errors.New("transaction is already cancelled")
+
 type PurchasePageQuery struct {
 	PageQuery
+	listing.PurchaseFilter
 
-	UserId        *string
 	Sort          *string
 	SortDirection *string //If you want to query with sort direction you need a sort key
 }
@@ -16,7 +23,21 @@ type PurchasePageQuery struct {
 type TransactionsRepository interface {
 	CreateTransaction(tx *gorm.DB, transaction *models.Transaction) error
 	GetTransactionsByIds(tx *gorm.DB, transactionIds []string) (map[string]*models.Transaction, error)
-	GetTransactionsPaginated(tx *gorm.DB, query *PurchasePageQuery) ([]*models.Transaction, error)
+	// GetTransactionForUpdate returns a transaction and locks it until tx ends, it has to be
+	// used to read transactions that are changed in tx
+	GetTransactionForUpdate(tx *gorm.DB, transactionId string) (*models.Transaction, error)
+	GetTransactionsPaginated(tx *gorm.DB, query *PurchasePageQuery) ([]*models.Transaction, *PageInfo, error)
+	// CountOutstandingTransactions counts the transactions of a user that still have a balance owing
+	CountOutstandingTransactions(tx *gorm.DB, userId string) (int, error)
+	GetTransactionItems(tx *gorm.DB, transactionId string) ([]*models.PurchaseItem, error)
+	// GetTransactionItemDetails returns the items of a transaction joined with their coffee names
+	GetTransactionItemDetails(tx *gorm.DB, transactionId string) ([]*models.PurchaseItemDetail, error)
 	UpdateTransaction(tx *gorm.DB, transaction *models.Transaction) error
+	// CancelTransaction marks a transaction read with GetTransactionForUpdate as cancelled, puts
+	// its items back into stock and refunds anything paid on it. It returns ErrAlreadyCancelled
+	// for cancelled transactions.
+	CancelTransaction(tx *gorm.DB, transaction *models.Transaction, cancelledBy uuid.UUID, reason string) error
+	CreatePayment(tx *gorm.DB, payment *models.Payment) error
+	GetTransactionPayments(tx *gorm.DB, transactionId string) ([]*models.Payment, error)
 	DeleteTransaction(tx *gorm.DB, transactionId string) error
 }
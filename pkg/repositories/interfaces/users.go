@@ -1,21 +1,29 @@
 package repository_interfaces
 
 import (
+	"github.com/ericklikan/dollar-coffee-backend/pkg/listing"
 	"github.com/ericklikan/dollar-coffee-backend/pkg/models"
+	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 )
 
 type UsersPageQuery struct {
 	PageQuery
-
-	Role *string
+	listing.UserFilter
 }
 
 type UserRepository interface {
 	CreateUser(tx *gorm.DB, user *models.User) error
 	GetUserByEmail(tx *gorm.DB, email string) (*models.User, error)
 	GetUsersByIds(tx *gorm.DB, userIds []string) (map[string]*models.User, error)
-	GetUsersPaginated(tx *gorm.DB, query *UsersPageQuery) ([]*models.User, error)
+	GetUsersPaginated(tx *gorm.DB, query *UsersPageQuery) ([]*models.User, *PageInfo, error)
 	UpdateUser(tx *gorm.DB, user *models.User) error
 	DeleteUser(tx *gorm.DB, userId string) error
+
+	// ReplaceRecoveryCodes removes all recovery codes of the user and stores
+	// the new hashes
+	ReplaceRecoveryCodes(tx *gorm.DB, userId uuid.UUID, hashes []string) error
+	DeleteRecoveryCodes(tx *gorm.DB, userId string) error
+	UseRecoveryCode(tx *gorm.DB, userId string, hash string) (bool, error)
+	CountUnusedRecoveryCodes(tx *gorm.DB, userId string) (int, error)
 }
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	OIDCClientID     = "test-client"
+	OIDCClientSecret = "test-secret"
+	oidcKeyId        = "test-key"
+)
+
+// OIDCUser is who the stand-in provider logs in as
+type OIDCUser struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// OIDCServer is a local stand-in for an OpenID Connect provider. Its
+// authorization endpoint logs in as User straight away and redirects back
+// with a code. Close it once the test is done.
+type OIDCServer struct {
+	*httptest.Server
+	User OIDCUser
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]string
+}
+
+func NewOIDCServer(t *testing.T) *OIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := &OIDCServer{
+		key:   key,
+		codes: make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", server.discoveryHandler)
+	mux.HandleFunc("/jwks", server.jwksHandler)
+	mux.HandleFunc("/authorize", server.authorizeHandler)
+	mux.HandleFunc("/token", server.tokenHandler)
+	server.Server = httptest.NewServer(mux)
+
+	return server
+}
+
+// SignIDToken signs any claims with the server key, for tests of invalid tokens
+func (s *OIDCServer) SignIDToken(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = oidcKeyId
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// IssueCode returns a code the token endpoint exchanges for idToken
+func (s *OIDCServer) IssueCode(idToken string) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	code := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes[code] = idToken
+	return code
+}
+
+// Claims returns the claims the server issues for User
+func (s *OIDCServer) Claims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            s.URL,
+		"sub":            s.User.Subject,
+		"aud":            OIDCClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          s.User.Email,
+		"email_verified": s.User.EmailVerified,
+		"given_name":     s.User.GivenName,
+		"family_name":    s.User.FamilyName,
+	}
+}
+
+func (s *OIDCServer) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *OIDCServer) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kid": oidcKeyId,
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			},
+		},
+	})
+}
+
+func (s *OIDCServer) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	if params.Get("client_id") != OIDCClientID || params.Get("response_type") != "code" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	code := s.IssueCode(s.SignIDToken(s.Claims(params.Get("nonce"))))
+
+	redirect, err := url.Parse(params.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := redirect.Query()
+	query.Set("code", code)
+	query.Set("state", params.Get("state"))
+	redirect.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *OIDCServer) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok || clientId != OIDCClientID || clientSecret != OIDCClientSecret {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	idToken, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "invalid grant", http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}